@@ -0,0 +1,915 @@
+// Command tcpraw is the CLI for the tcpraw file transfer tool; all of the
+// logic lives in the packages under pkg.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"tcpraw/pkg/client"
+	"tcpraw/pkg/protocol"
+	"tcpraw/pkg/server"
+	"tcpraw/pkg/store"
+)
+
+// parseMixed parses args with fs but, unlike fs.Parse alone, keeps going
+// after positional arguments, so flags may appear before or after them in
+// any mix. Every subcommand goes through it, which also gives each one -h /
+// --help and an error on unknown flags for free (the flag sets use
+// ExitOnError). The positional arguments are returned in order.
+func parseMixed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for len(args) > 0 {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	return positional
+}
+
+// parseLongTermDuration parses e.g. "7d", "24h" to seconds. Max 30 days. Returns 0 if invalid.
+func parseLongTermDuration(s string) (uint32, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	var mult time.Duration
+	if strings.HasSuffix(s, "d") {
+		mult = 24 * time.Hour
+		s = s[:len(s)-1]
+	} else if strings.HasSuffix(s, "h") {
+		mult = time.Hour
+		s = s[:len(s)-1]
+	} else {
+		return 0, fmt.Errorf("long-term: use e.g. 7d or 24h")
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("long-term: positive number required")
+	}
+	d := time.Duration(n) * mult
+	max := 30 * 24 * time.Hour
+	if d > max {
+		d = max
+	}
+	return uint32(d.Seconds()), nil
+}
+
+// parseNotBeforeDuration parses the -notbefore embargo, e.g. "30m", "2h" or
+// "1d", to seconds. The server rejects embargoes that outlast the blob.
+func parseNotBeforeDuration(s string) (uint32, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("notbefore: use e.g. 30m, 2h or 1d")
+		}
+		return uint32(n) * 24 * 60 * 60, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("notbefore: use e.g. 30m, 2h or 1d")
+	}
+	return uint32(d.Seconds()), nil
+}
+
+// Exit codes, so scripts wrapping tcpraw can branch on the failure class
+// instead of grepping stderr:
+//
+//	0  success
+//	1  generic failure (usage, configuration, server error)
+//	2  network failure (dial, server list fetch, connection lost)
+//	3  code not found or expired
+//	4  checksum mismatch after decrypt
+//	5  file too large for the server or its disk
+//	6  rate-limited or banned by the server
+//
+// Public servers deliberately answer rate-limited downloads like unknown
+// codes, so those surface as 3.
+const (
+	exitGeneric     = 1
+	exitNetwork     = 2
+	exitNotFound    = 3
+	exitChecksum    = 4
+	exitTooLarge    = 5
+	exitRateLimited = 6
+)
+
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, client.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, client.ErrChecksumMismatch):
+		return exitChecksum
+	case errors.Is(err, client.ErrTooLarge):
+		return exitTooLarge
+	case errors.Is(err, client.ErrRateLimited):
+		return exitRateLimited
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return exitNetwork
+	}
+	return exitGeneric
+}
+
+// fail reports err with the usual prefix and exits with its class code.
+func fail(prefix string, err error) {
+	fmt.Fprintf(os.Stderr, "%s: %s\n", prefix, client.Red(err.Error()))
+	os.Exit(exitCode(err))
+}
+
+// Version – change only here; the remote check compares against the signed
+// update manifest (see update.go).
+var Version = "1.2.1"
+
+func main() {
+	serverCmd := flag.NewFlagSet("server", flag.ExitOnError)
+	serverID := serverCmd.Int("id", 0, "server id 0–9 (first digit of generated codes)")
+	serverPort := serverCmd.String("port", "9999", "listen port")
+	serverDir := serverCmd.String("dir", "./data", "directory for stored encrypted blobs")
+	serverWeb := serverCmd.String("web", "", "web port for browser download page (e.g. 8080); empty = disabled")
+	serverMaxSizeMB := serverCmd.Int64("maxsize", 0, "max upload size in MB (0 = use default from code)")
+	serverIOLimit := serverCmd.Int64("iolimit", 0, "max aggregate disk bandwidth for transfers in MB/s (0 = unlimited)")
+	serverLongTerm := serverCmd.Bool("longterm", false, "allow long-term storage (client -longterm=e.g. 7d; max 150 MB)")
+	serverTLSCert := serverCmd.String("tlscert", "", "TLS certificate file; enables TLS on the listener (requires -tlskey)")
+	serverTLSKey := serverCmd.String("tlskey", "", "TLS private key file")
+	serverClientCA := serverCmd.String("clientca", "", "CA file for client certificates; uploads then require a verified client cert")
+	serverMTLSDl := serverCmd.Bool("mtls-downloads", false, "also require a client certificate for downloads (needs -clientca)")
+	serverSecret := serverCmd.String("secret", "", "shared secret; requests must carry a timestamped HMAC (client -secret)")
+	serverScanClamd := serverCmd.String("scan-clamd", "", "clamd address (host:port or unix socket) to scan code-encrypted uploads")
+	serverScanCmd := serverCmd.String("scan-cmd", "", "external scan command; gets plaintext file as argument, exit 1 = infected")
+	serverDenyExt := serverCmd.String("deny-ext", "", "comma-separated file extensions to reject, e.g. exe,scr,bat")
+	serverDenyMIME := serverCmd.String("deny-mime", "", "comma-separated MIME patterns to reject, e.g. application/x-dosexec,video/*")
+	serverMaxName := serverCmd.Int("maxname", 0, "max upload filename length in bytes (0 = no limit)")
+	serverAdminToken := serverCmd.String("admintoken", "", "token for /admin/* endpoints on the web port (empty = disabled)")
+	serverStats := serverCmd.Duration("stats", 10*time.Minute, "interval between stats log lines (0 = disabled)")
+	serverTTL := serverCmd.Duration("ttl", store.StorageDuration, "how long uploads are kept (echoed to clients)")
+	serverCleanup := serverCmd.Duration("cleanup", server.CleanupInterval, "interval between expiry sweeps")
+	serverRLAttempts := serverCmd.Int("rl-attempts", server.RateLimitAttempts, "sustained download attempts allowed per IP per window (burst capacity is a fifth of this)")
+	serverRLWindow := serverCmd.Duration("rl-window", server.RateLimitWindow, "rate-limit window")
+	serverBan := serverCmd.Duration("ban", server.BanDuration, "how long an explicitly banned IP stays banned")
+	serverWebhook := serverCmd.String("webhook", "", "URL receiving JSON POSTs for ban, throttle and rejection events (empty = disabled)")
+	serverTelemetry := serverCmd.String("telemetry", "", "opt-in anonymous usage metrics endpoint: coarse counters, OS/arch and version only (empty = disabled)")
+	serverHookCmd := serverCmd.String("hook-cmd", "", "command run once per server event (upload_complete, download, expire, reject); details in TCPRAW_* env vars")
+	serverGateway := serverCmd.Bool("gateway", false, "web port serves any network code: codes not stored here are fetched from the owning server and streamed")
+	serverNoBench := serverCmd.Bool("nobench", false, "refuse bench requests (servers/bench report N/A for this node)")
+	serverBenchMax := serverCmd.Int("benchmax", 30, "longest bench stream a client may request, seconds per phase")
+	serverBenchLimit := serverCmd.Int("benchlimit", 6, "bench requests allowed per IP per rate-limit window; 0 = unlimited")
+	serverDurable := serverCmd.Bool("durable", false, "fsync data and index before acking uploads (slower, survives power loss)")
+	serverShared := serverCmd.Bool("shared", false, "share the data dir with other server processes (locked index, SO_REUSEPORT listener)")
+	serverOnion := serverCmd.String("onion", "", "publish as a v3 onion service via this Tor control port (e.g. 127.0.0.1:9051); key kept in <dir>/onion.key")
+	serverPipe := serverCmd.String("pipe", "", `also listen on a Windows named pipe, e.g. \\.\pipe\tcpraw (local IPC)`)
+	serverProxyProto := serverCmd.Bool("proxyproto", false, "require HAProxy PROXY protocol v1/v2 headers on the listener (for deployments behind load balancers)")
+	serverNoDelay := serverCmd.Bool("nodelay", true, "set TCP_NODELAY on connections (false = let Nagle batch writes)")
+	serverKeepAlive := serverCmd.Duration("keepalive", 0, "TCP keepalive probe period (0 = Go default, negative = off)")
+	serverTCPTimeout := serverCmd.Duration("tcp-timeout", 0, "drop connections with data unacked this long (Linux TCP_USER_TIMEOUT; 0 = kernel default)")
+
+	clientSendCmd := flag.NewFlagSet("send", flag.ExitOnError)
+	clientSendServerID := clientSendCmd.Int("server", -1, "server id 0–9 to use (default: auto-probe)")
+	clientSendLongTerm := clientSendCmd.String("longterm", "", "store for e.g. 7d or 24h (max 150 MB; server must support -longterm)")
+	clientSendNotBefore := clientSendCmd.String("notbefore", "", "timed release: refuse downloads for e.g. 30m, 2h or 1d after upload")
+	clientSendBlake3 := clientSendCmd.Bool("blake3", false, "checksum with BLAKE3 (multi-core, faster on big files); receivers need an up-to-date client")
+	clientSendZip := clientSendCmd.Bool("zip", false, "pack file or directory into tar.gz before sending")
+	clientSendManifest := clientSendCmd.Bool("manifest", false, "pack a directory into an uncompressed tar with an entry manifest, so get -only can fetch single files")
+	clientSendLinks := clientSendCmd.String("links", client.SymlinksKeep, "symlink handling when packing a directory: keep, follow or skip")
+	clientSendLocal := clientSendCmd.Bool("local", false, "local LAN send mode")
+	clientSendTLS := clientSendCmd.Bool("tls", false, "connect over TLS (private servers)")
+	clientSendTor := clientSendCmd.String("tor", "", "dial through this SOCKS5 proxy (e.g. 127.0.0.1:9050); required for .onion addresses")
+	clientSendV4 := clientSendCmd.Bool("4", false, "force IPv4 when dialing servers and fetching the address list")
+	clientSendV6 := clientSendCmd.Bool("6", false, "force IPv6 when dialing servers and fetching the address list")
+	clientSendTLSCert := clientSendCmd.String("tlscert", "", "client certificate file for mTLS servers")
+	clientSendTLSKey := clientSendCmd.String("tlskey", "", "client private key file for mTLS servers")
+	clientSendTLSCA := clientSendCmd.String("tlsca", "", "CA file to trust for the server certificate")
+	clientSendSecret := clientSendCmd.String("secret", "", "shared secret for servers running with -secret")
+	clientSendPassword := clientSendCmd.String("password", "", "require this password on download (stored hashed on server)")
+	clientSendSign := clientSendCmd.String("sign", "", "Ed25519 key file (from tcpraw keygen -sign) to sign the upload with")
+	clientSendTo := clientSendCmd.String("to", "", "recipient X25519 public key file; only the matching identity key can decrypt")
+	clientSendWAN := clientSendCmd.Bool("wan", false, "tune chunk and buffer sizes for high-latency gigabit paths")
+	clientSendRefresh := clientSendCmd.Bool("refresh", false, "ignore cached server list and probe results")
+	clientSendNoDelay := clientSendCmd.Bool("nodelay", true, "set TCP_NODELAY on connections (false = let Nagle batch writes)")
+	clientSendKeepAlive := clientSendCmd.Duration("keepalive", 0, "TCP keepalive probe period (0 = Go default, negative = off)")
+	clientSendTCPTimeout := clientSendCmd.Duration("tcp-timeout", 0, "drop connections with data unacked this long (Linux TCP_USER_TIMEOUT; 0 = kernel default)")
+	clientSendNoColor := clientSendCmd.Bool("no-color", false, "disable colored output (also honours NO_COLOR)")
+	clientGetCmd := flag.NewFlagSet("get", flag.ExitOnError)
+	var clientGetOut string
+	clientGetCmd.StringVar(&clientGetOut, "o", "", "output file (default: name from server)")
+	clientGetCmd.StringVar(&clientGetOut, "output", "", "output file (alias for -o)")
+	clientGetLocal := clientGetCmd.Bool("local", false, "local LAN receive mode")
+	clientGetUnzip := clientGetCmd.Bool("unzip", false, "after download, extract tar.gz and remove archive")
+	clientGetTLS := clientGetCmd.Bool("tls", false, "connect over TLS (private servers)")
+	clientGetTor := clientGetCmd.String("tor", "", "dial through this SOCKS5 proxy (e.g. 127.0.0.1:9050); required for .onion addresses")
+	clientGetV4 := clientGetCmd.Bool("4", false, "force IPv4 when dialing servers and fetching the address list")
+	clientGetV6 := clientGetCmd.Bool("6", false, "force IPv6 when dialing servers and fetching the address list")
+	clientGetTLSCert := clientGetCmd.String("tlscert", "", "client certificate file for mTLS servers")
+	clientGetTLSKey := clientGetCmd.String("tlskey", "", "client private key file for mTLS servers")
+	clientGetTLSCA := clientGetCmd.String("tlsca", "", "CA file to trust for the server certificate")
+	clientGetSecret := clientGetCmd.String("secret", "", "shared secret for servers running with -secret")
+	clientGetPassword := clientGetCmd.String("password", "", "download password (prompted if needed and not given)")
+	clientGetVerifySigner := clientGetCmd.String("verify-signer", "", "Ed25519 public key file; refuse files not signed by this key")
+	clientGetIdentity := clientGetCmd.String("identity", "", "X25519 identity key file for recipient-encrypted uploads")
+	clientGetPake := clientGetCmd.Bool("pake", false, "fetch via SPAKE2 handshake; the code never travels on the wire")
+	clientGetParallel := clientGetCmd.Int("parallel", 1, "connections for chunked downloads (1 = single stream)")
+	clientGetOnly := clientGetCmd.String("only", "", "extract only bundle entries matching this glob (directory sent with -manifest); -o names the target directory")
+	clientGetWAN := clientGetCmd.Bool("wan", false, "tune chunk and buffer sizes for high-latency gigabit paths")
+	clientGetRefresh := clientGetCmd.Bool("refresh", false, "ignore cached server list and probe results")
+	clientGetNoDelay := clientGetCmd.Bool("nodelay", true, "set TCP_NODELAY on connections (false = let Nagle batch writes)")
+	clientGetKeepAlive := clientGetCmd.Duration("keepalive", 0, "TCP keepalive probe period (0 = Go default, negative = off)")
+	clientGetTCPTimeout := clientGetCmd.Duration("tcp-timeout", 0, "drop connections with data unacked this long (Linux TCP_USER_TIMEOUT; 0 = kernel default)")
+	clientGetNoColor := clientGetCmd.Bool("no-color", false, "disable colored output (also honours NO_COLOR)")
+
+	updateCmd := flag.NewFlagSet("update", flag.ExitOnError)
+	updateTLS := updateCmd.Bool("tls", false, "connect over TLS (private servers)")
+	updateTLSCert := updateCmd.String("tlscert", "", "client certificate file for mTLS servers")
+	updateTLSKey := updateCmd.String("tlskey", "", "client private key file for mTLS servers")
+	updateTLSCA := updateCmd.String("tlsca", "", "CA file to trust for the server certificate")
+	updateSecret := updateCmd.String("secret", "", "shared secret for servers running with -secret")
+	updateTor := updateCmd.String("tor", "", "dial through this SOCKS5 proxy (e.g. 127.0.0.1:9050); required for .onion addresses")
+	updateV4 := updateCmd.Bool("4", false, "force IPv4 when dialing servers and fetching the address list")
+	updateV6 := updateCmd.Bool("6", false, "force IPv6 when dialing servers and fetching the address list")
+	updateWAN := updateCmd.Bool("wan", false, "tune chunk and buffer sizes for high-latency gigabit paths")
+	updateRefresh := updateCmd.Bool("refresh", false, "ignore cached server list and probe results")
+	updateNoDelay := updateCmd.Bool("nodelay", true, "set TCP_NODELAY on connections (false = let Nagle batch writes)")
+	updateNoColor := updateCmd.Bool("no-color", false, "disable colored output (also honours NO_COLOR)")
+
+	appendCmd := flag.NewFlagSet("append", flag.ExitOnError)
+	appendTLS := appendCmd.Bool("tls", false, "connect over TLS (private servers)")
+	appendTLSCert := appendCmd.String("tlscert", "", "client certificate file for mTLS servers")
+	appendTLSKey := appendCmd.String("tlskey", "", "client private key file for mTLS servers")
+	appendTLSCA := appendCmd.String("tlsca", "", "CA file to trust for the server certificate")
+	appendSecret := appendCmd.String("secret", "", "shared secret for servers running with -secret")
+	appendTor := appendCmd.String("tor", "", "dial through this SOCKS5 proxy (e.g. 127.0.0.1:9050); required for .onion addresses")
+	appendV4 := appendCmd.Bool("4", false, "force IPv4 when dialing servers and fetching the address list")
+	appendV6 := appendCmd.Bool("6", false, "force IPv6 when dialing servers and fetching the address list")
+	appendWAN := appendCmd.Bool("wan", false, "tune chunk and buffer sizes for high-latency gigabit paths")
+	appendRefresh := appendCmd.Bool("refresh", false, "ignore cached server list and probe results")
+	appendNoDelay := appendCmd.Bool("nodelay", true, "set TCP_NODELAY on connections (false = let Nagle batch writes)")
+	appendNoColor := appendCmd.Bool("no-color", false, "disable colored output (also honours NO_COLOR)")
+
+	lsCmd := flag.NewFlagSet("ls", flag.ExitOnError)
+	lsTLS := lsCmd.Bool("tls", false, "connect over TLS (private servers)")
+	lsTLSCert := lsCmd.String("tlscert", "", "client certificate file for mTLS servers")
+	lsTLSKey := lsCmd.String("tlskey", "", "client private key file for mTLS servers")
+	lsTLSCA := lsCmd.String("tlsca", "", "CA file to trust for the server certificate")
+	lsSecret := lsCmd.String("secret", "", "shared secret for servers running with -secret")
+	lsTor := lsCmd.String("tor", "", "dial through this SOCKS5 proxy (e.g. 127.0.0.1:9050); required for .onion addresses")
+	lsV4 := lsCmd.Bool("4", false, "force IPv4 when dialing servers and fetching the address list")
+	lsV6 := lsCmd.Bool("6", false, "force IPv6 when dialing servers and fetching the address list")
+	lsIdentity := lsCmd.String("identity", "", "X25519 identity key file for recipient-encrypted uploads")
+	lsRefresh := lsCmd.Bool("refresh", false, "ignore cached server list and probe results")
+	lsNoColor := lsCmd.Bool("no-color", false, "disable colored output (also honours NO_COLOR)")
+
+	checkCmd := flag.NewFlagSet("check", flag.ExitOnError)
+	checkTLS := checkCmd.Bool("tls", false, "connect over TLS (private servers)")
+	checkTLSCert := checkCmd.String("tlscert", "", "client certificate file for mTLS servers")
+	checkTLSKey := checkCmd.String("tlskey", "", "client private key file for mTLS servers")
+	checkTLSCA := checkCmd.String("tlsca", "", "CA file to trust for the server certificate")
+	checkSecret := checkCmd.String("secret", "", "shared secret for servers running with -secret")
+	checkTor := checkCmd.String("tor", "", "dial through this SOCKS5 proxy (e.g. 127.0.0.1:9050); required for .onion addresses")
+	checkV4 := checkCmd.Bool("4", false, "force IPv4 when dialing servers and fetching the address list")
+	checkV6 := checkCmd.Bool("6", false, "force IPv6 when dialing servers and fetching the address list")
+	checkRefresh := checkCmd.Bool("refresh", false, "ignore cached server list and probe results")
+	checkNoColor := checkCmd.Bool("no-color", false, "disable colored output (also honours NO_COLOR)")
+
+	secureSendCmd := flag.NewFlagSet("secure send", flag.ExitOnError)
+	secureSendServerID := secureSendCmd.Int("server", -1, "server id 0–9 to use (default: auto-probe)")
+	secureSendLongTerm := secureSendCmd.String("longterm", "", "store for e.g. 7d or 24h (max 150 MB; server must support -longterm)")
+	secureSendZip := secureSendCmd.Bool("zip", false, "pack file or directory into tar.gz before sending")
+	secureSendLinks := secureSendCmd.String("links", client.SymlinksKeep, "symlink handling when packing a directory: keep, follow or skip")
+	secureSendWAN := secureSendCmd.Bool("wan", false, "tune chunk and buffer sizes for high-latency gigabit paths")
+	secureSendRefresh := secureSendCmd.Bool("refresh", false, "ignore cached server list and probe results")
+	secureSendNoColor := secureSendCmd.Bool("no-color", false, "disable colored output (also honours NO_COLOR)")
+
+	serversCmd := flag.NewFlagSet("servers", flag.ExitOnError)
+	serversRefresh := serversCmd.Bool("refresh", false, "ignore cached server list and probe results")
+	serversNoColor := serversCmd.Bool("no-color", false, "disable colored output (also honours NO_COLOR)")
+	serversHistory := serversCmd.Bool("history", false, "summarise past benchmark runs per server instead of benchmarking now")
+
+	benchCmd := flag.NewFlagSet("bench", flag.ExitOnError)
+	benchDirection := benchCmd.String("direction", "both", "what to measure: down, up or both")
+	benchDuration := benchCmd.Int("duration", 2, "seconds per measured direction (1–30)")
+
+	if len(os.Args) < 2 {
+		// On a terminal, drop into the interactive wizard instead of dumping
+		// usage (and making two network calls) at someone who just typed the
+		// command they were told to install.
+		if isTTY(os.Stdin) && isTTY(os.Stdout) {
+			runWizard()
+			return
+		}
+		printUsage()
+		printTotalNetworkStorage()
+		printVersionCheck()
+		os.Exit(1)
+	}
+
+	// Shortcut mode: tcpraw <file> -local
+	if len(os.Args) >= 3 && hasArg(os.Args[1:], "-local") && os.Args[1] != "get" && os.Args[1] != "send" && os.Args[1] != "server" && os.Args[1] != "secure" && os.Args[1] != "servers" {
+		if err := client.RunLocalSender(os.Args[1]); err != nil {
+			fail("local", err)
+		}
+		return
+	}
+
+	switch os.Args[1] {
+	case "server":
+		if len(os.Args) > 2 && os.Args[2] == "verify" {
+			verifyCmd := flag.NewFlagSet("server verify", flag.ExitOnError)
+			verifyDir := verifyCmd.String("dir", "./data", "directory for stored encrypted blobs")
+			verifyQuarantine := verifyCmd.Bool("quarantine", false, "flag corrupt blobs so a running server never serves them")
+			_ = verifyCmd.Parse(os.Args[3:])
+			if err := store.VerifyDir(*verifyDir, *verifyQuarantine); err != nil {
+				fmt.Fprintf(os.Stderr, "server verify: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+		parseMixed(serverCmd, os.Args[2:])
+		id := *serverID
+		if id < 0 || id > 9 {
+			fmt.Fprintln(os.Stderr, "server id must be 0–9")
+			os.Exit(1)
+		}
+		maxBlob := server.MaxBlobSize
+		if *serverMaxSizeMB > 0 {
+			maxBlob = *serverMaxSizeMB * 1024 * 1024
+		}
+		if *serverIOLimit > 0 {
+			server.DiskIOLimit.Store(*serverIOLimit * 1024 * 1024)
+		}
+		if *serverSecret != "" {
+			protocol.ProtocolSecret = []byte(*serverSecret)
+		}
+		server.ScanClamdAddr = *serverScanClamd
+		server.ScanCommand = *serverScanCmd
+		server.SetUploadPolicy(server.ParsePolicyList(*serverDenyExt),
+			server.ParsePolicyList(*serverDenyMIME), *serverMaxName)
+		server.AdminToken = *serverAdminToken
+		server.Version = Version
+		server.StatsInterval = *serverStats
+		if *serverTTL > 0 {
+			store.StorageDuration = *serverTTL
+		}
+		if *serverCleanup > 0 {
+			server.CleanupInterval = *serverCleanup
+		}
+		if *serverRLAttempts > 0 {
+			server.RateLimitAttempts = *serverRLAttempts
+		}
+		if *serverRLWindow > 0 {
+			server.RateLimitWindow = *serverRLWindow
+		}
+		if *serverBan > 0 {
+			server.BanDuration = *serverBan
+		}
+		server.WebhookURL = *serverWebhook
+		server.TelemetryURL = *serverTelemetry
+		server.HookCommand = *serverHookCmd
+		server.GatewayMode = *serverGateway
+		server.BenchDisabled = *serverNoBench
+		server.BenchMaxSeconds = *serverBenchMax
+		server.BenchPerIPLimit = *serverBenchLimit
+		store.DurableUploads = *serverDurable
+		store.SharedDir = *serverShared
+		server.TorControlAddr = *serverOnion
+		server.NamedPipePath = *serverPipe
+		server.ProxyProtocol = *serverProxyProto
+		protocol.TCPNoDelay = *serverNoDelay
+		protocol.TCPKeepAlive = *serverKeepAlive
+		protocol.TCPUserTimeout = *serverTCPTimeout
+		if *serverTLSCert != "" || *serverTLSKey != "" {
+			cfg, err := protocol.LoadServerTLSConfig(*serverTLSCert, *serverTLSKey, *serverClientCA)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "server: %v\n", err)
+				os.Exit(1)
+			}
+			protocol.ServerTLSConfig = cfg
+			protocol.ServerMTLSDownloads = *serverMTLSDl
+		} else if *serverClientCA != "" || *serverMTLSDl {
+			fmt.Fprintln(os.Stderr, "server: -clientca/-mtls-downloads need -tlscert and -tlskey")
+			os.Exit(1)
+		}
+		if err := server.RunServer(id, *serverPort, *serverDir, *serverWeb, maxBlob, *serverLongTerm); err != nil {
+			fmt.Fprintf(os.Stderr, "server: %v\n", err)
+			os.Exit(1)
+		}
+	case "send":
+		client.CancelOnInterrupt()
+		args := parseMixed(clientSendCmd, os.Args[2:])
+		if *clientSendNoColor {
+			client.DisableColor()
+		}
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, "usage: tcpraw send <file> [host:port]")
+			os.Exit(1)
+		}
+		if *clientSendLocal {
+			if err := client.RunLocalSender(args[0]); err != nil {
+				fail("local", err)
+			}
+			return
+		}
+		addr := ""
+		if len(args) >= 2 {
+			addr = args[1]
+		}
+		if *clientSendSecret != "" {
+			protocol.ProtocolSecret = []byte(*clientSendSecret)
+		}
+		protocol.TorSOCKSAddr = *clientSendTor
+		if err := protocol.SetIPFamily(*clientSendV4, *clientSendV6); err != nil {
+			fail("client", err)
+		}
+		if *clientSendTLS || *clientSendTLSCert != "" || *clientSendTLSCA != "" {
+			cfg, err := protocol.LoadClientTLSConfig(*clientSendTLSCert, *clientSendTLSKey, *clientSendTLSCA)
+			if err != nil {
+				fail("client", err)
+			}
+			protocol.ClientTLSConfig = cfg
+		}
+		longTermSec := uint32(0)
+		if *clientSendWAN {
+			protocol.ApplyWANProfile()
+		}
+		protocol.TCPNoDelay = *clientSendNoDelay
+		protocol.TCPKeepAlive = *clientSendKeepAlive
+		protocol.TCPUserTimeout = *clientSendTCPTimeout
+		protocol.RefreshCache = *clientSendRefresh
+		if *clientSendLongTerm != "" {
+			sec, err := parseLongTermDuration(*clientSendLongTerm)
+			if err != nil {
+				fail("client", err)
+			}
+			longTermSec = sec
+		}
+		notBeforeSec := uint32(0)
+		if *clientSendNotBefore != "" {
+			sec, err := parseNotBeforeDuration(*clientSendNotBefore)
+			if err != nil {
+				fail("client", err)
+			}
+			notBeforeSec = sec
+		}
+		var sendPath string
+		var cleanup func()
+		var err error
+		if *clientSendManifest {
+			sendPath, cleanup, err = client.PrepareManifestSendPath(args[0], *clientSendLinks)
+		} else {
+			sendPath, cleanup, err = client.PrepareSendPath(args[0], *clientSendZip, *clientSendLinks)
+		}
+		if err != nil {
+			fail("client", err)
+		}
+		if cleanup != nil {
+			defer cleanup()
+		}
+		if err := client.RunClientSend(sendPath, addr, *clientSendServerID, longTermSec, *clientSendPassword, *clientSendSign, *clientSendTo, notBeforeSec, *clientSendBlake3); err != nil {
+			fail("client", err)
+		}
+	case "get":
+		client.CancelOnInterrupt()
+		args := parseMixed(clientGetCmd, os.Args[2:])
+		if *clientGetNoColor {
+			client.DisableColor()
+		}
+		if *clientGetLocal {
+			if err := client.RunLocalReceiver(); err != nil {
+				fail("local", err)
+			}
+			return
+		}
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, "usage: tcpraw get <6-digit-code> [-o file] [-unzip]")
+			os.Exit(1)
+		}
+		code := args[0]
+		if *clientGetSecret != "" {
+			protocol.ProtocolSecret = []byte(*clientGetSecret)
+		}
+		protocol.TorSOCKSAddr = *clientGetTor
+		if err := protocol.SetIPFamily(*clientGetV4, *clientGetV6); err != nil {
+			fail("client", err)
+		}
+		if *clientGetTLS || *clientGetTLSCert != "" || *clientGetTLSCA != "" {
+			cfg, err := protocol.LoadClientTLSConfig(*clientGetTLSCert, *clientGetTLSKey, *clientGetTLSCA)
+			if err != nil {
+				fail("client", err)
+			}
+			protocol.ClientTLSConfig = cfg
+		}
+		if *clientGetWAN {
+			protocol.ApplyWANProfile()
+		}
+		protocol.TCPNoDelay = *clientGetNoDelay
+		protocol.TCPKeepAlive = *clientGetKeepAlive
+		protocol.TCPUserTimeout = *clientGetTCPTimeout
+		protocol.RefreshCache = *clientGetRefresh
+		if *clientGetOnly != "" {
+			outDir := clientGetOut
+			if outDir == "" {
+				outDir = "."
+			}
+			if err := client.RunClientGetOnly(code, *clientGetOnly, outDir, *clientGetIdentity); err != nil {
+				fail("client", err)
+			}
+			return
+		}
+		if err := client.RunClientGet(code, clientGetOut, *clientGetUnzip, *clientGetPassword, *clientGetVerifySigner, *clientGetIdentity, *clientGetPake, *clientGetParallel); err != nil {
+			fail("client", err)
+		}
+	case "update":
+		client.CancelOnInterrupt()
+		args := parseMixed(updateCmd, os.Args[2:])
+		if *updateNoColor {
+			client.DisableColor()
+		}
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: tcpraw update <6-digit-code> <file>")
+			os.Exit(1)
+		}
+		if *updateSecret != "" {
+			protocol.ProtocolSecret = []byte(*updateSecret)
+		}
+		protocol.TorSOCKSAddr = *updateTor
+		if err := protocol.SetIPFamily(*updateV4, *updateV6); err != nil {
+			fail("client", err)
+		}
+		if *updateTLS || *updateTLSCert != "" || *updateTLSCA != "" {
+			cfg, err := protocol.LoadClientTLSConfig(*updateTLSCert, *updateTLSKey, *updateTLSCA)
+			if err != nil {
+				fail("client", err)
+			}
+			protocol.ClientTLSConfig = cfg
+		}
+		if *updateWAN {
+			protocol.ApplyWANProfile()
+		}
+		protocol.TCPNoDelay = *updateNoDelay
+		protocol.RefreshCache = *updateRefresh
+		if err := client.RunClientUpdate(args[0], args[1]); err != nil {
+			fail("client", err)
+		}
+	case "append":
+		client.CancelOnInterrupt()
+		args := parseMixed(appendCmd, os.Args[2:])
+		if *appendNoColor {
+			client.DisableColor()
+		}
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "usage: tcpraw append <6-digit-code> <owner-token> <file>")
+			os.Exit(1)
+		}
+		if *appendSecret != "" {
+			protocol.ProtocolSecret = []byte(*appendSecret)
+		}
+		protocol.TorSOCKSAddr = *appendTor
+		if err := protocol.SetIPFamily(*appendV4, *appendV6); err != nil {
+			fail("client", err)
+		}
+		if *appendTLS || *appendTLSCert != "" || *appendTLSCA != "" {
+			cfg, err := protocol.LoadClientTLSConfig(*appendTLSCert, *appendTLSKey, *appendTLSCA)
+			if err != nil {
+				fail("client", err)
+			}
+			protocol.ClientTLSConfig = cfg
+		}
+		if *appendWAN {
+			protocol.ApplyWANProfile()
+		}
+		protocol.TCPNoDelay = *appendNoDelay
+		protocol.RefreshCache = *appendRefresh
+		if err := client.RunClientAppend(args[0], args[1], args[2]); err != nil {
+			fail("client", err)
+		}
+	case "ls":
+		args := parseMixed(lsCmd, os.Args[2:])
+		if *lsNoColor {
+			client.DisableColor()
+		}
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, "usage: tcpraw ls <6-digit-code>")
+			os.Exit(1)
+		}
+		if *lsSecret != "" {
+			protocol.ProtocolSecret = []byte(*lsSecret)
+		}
+		protocol.TorSOCKSAddr = *lsTor
+		if err := protocol.SetIPFamily(*lsV4, *lsV6); err != nil {
+			fail("client", err)
+		}
+		if *lsTLS || *lsTLSCert != "" || *lsTLSCA != "" {
+			cfg, err := protocol.LoadClientTLSConfig(*lsTLSCert, *lsTLSKey, *lsTLSCA)
+			if err != nil {
+				fail("client", err)
+			}
+			protocol.ClientTLSConfig = cfg
+		}
+		protocol.RefreshCache = *lsRefresh
+		if err := client.RunClientList(args[0], *lsIdentity); err != nil {
+			fail("client", err)
+		}
+	case "check":
+		args := parseMixed(checkCmd, os.Args[2:])
+		if *checkNoColor {
+			client.DisableColor()
+		}
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, "usage: tcpraw check <6-digit-code>")
+			os.Exit(1)
+		}
+		if *checkSecret != "" {
+			protocol.ProtocolSecret = []byte(*checkSecret)
+		}
+		protocol.TorSOCKSAddr = *checkTor
+		if err := protocol.SetIPFamily(*checkV4, *checkV6); err != nil {
+			fail("client", err)
+		}
+		if *checkTLS || *checkTLSCert != "" || *checkTLSCA != "" {
+			cfg, err := protocol.LoadClientTLSConfig(*checkTLSCert, *checkTLSKey, *checkTLSCA)
+			if err != nil {
+				fail("client", err)
+			}
+			protocol.ClientTLSConfig = cfg
+		}
+		protocol.RefreshCache = *checkRefresh
+		if err := client.RunClientCheck(args[0]); err != nil {
+			fail("client", err)
+		}
+	case "version", "--version", "-version":
+		versionCmd := flag.NewFlagSet("version", flag.ExitOnError)
+		versionCheck := versionCmd.Bool("check", false, "also query the signed update manifest and report whether an update exists")
+		versionChannel := versionCmd.String("channel", "stable", "release channel to check against (stable, beta)")
+		parseMixed(versionCmd, os.Args[2:])
+		printVersion()
+		if *versionCheck {
+			remote, art, err := latestVersion(*versionChannel, 5*time.Second)
+			if err != nil {
+				// No unsigned fallback: a version notice that cannot be
+				// verified is how a compromised mirror plants fake
+				// upgrade prompts.
+				fmt.Fprintf(os.Stderr, "version: signed manifest check failed: %v\n", err)
+				os.Exit(exitNetwork)
+			}
+			if versionLess(Version, remote) {
+				fmt.Printf("update available on %s: %s\n", *versionChannel, remote)
+				if art != nil {
+					fmt.Printf("  %s (sha256 %s)\n", art.URL, art.SHA256)
+				}
+			} else {
+				fmt.Println("up to date")
+			}
+		}
+	case "keygen":
+		keygenCmd := flag.NewFlagSet("keygen", flag.ExitOnError)
+		keygenSign := keygenCmd.Bool("sign", false, "generate an Ed25519 signing keypair instead of an X25519 identity")
+		keygenOut := keygenCmd.String("o", "", "output file for the private key (public key goes to <file>.pub)")
+		parseMixed(keygenCmd, os.Args[2:])
+		out := *keygenOut
+		var err error
+		if *keygenSign {
+			if out == "" {
+				out = "tcpraw_sign"
+			}
+			err = protocol.RunKeygen(out)
+		} else {
+			if out == "" {
+				out = "tcpraw_id"
+			}
+			err = protocol.RunKeygenX25519(out)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "keygen: %v\n", err)
+			os.Exit(1)
+		}
+	case "servers":
+		parseMixed(serversCmd, os.Args[2:])
+		if *serversNoColor {
+			client.DisableColor()
+		}
+		protocol.RefreshCache = *serversRefresh
+		if *serversHistory {
+			if err := client.RunClientServersHistory(); err != nil {
+				fail("servers", err)
+			}
+			return
+		}
+		if err := client.RunClientServers(); err != nil {
+			fail("servers", err)
+		}
+	case "bench":
+		args := parseMixed(benchCmd, os.Args[2:])
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, "usage: tcpraw bench <host:port> [-direction down|up|both] [-duration sec]")
+			os.Exit(1)
+		}
+		if err := client.RunClientBench(args[0], *benchDirection, *benchDuration); err != nil {
+			fail("bench", err)
+		}
+	case "selftest":
+		if err := runSelfTest(); err != nil {
+			fmt.Fprintf(os.Stderr, "selftest: %v\n", err)
+			os.Exit(1)
+		}
+	case "secure":
+		client.CancelOnInterrupt()
+		if len(os.Args) < 3 {
+			printUsage()
+			printTotalNetworkStorage()
+			printVersionCheck()
+			os.Exit(1)
+		}
+		if os.Args[2] != "send" {
+			printUsage()
+			printTotalNetworkStorage()
+			printVersionCheck()
+			os.Exit(1)
+		}
+		args := parseMixed(secureSendCmd, os.Args[3:])
+		if *secureSendNoColor {
+			client.DisableColor()
+		}
+		if len(args) < 1 {
+			fmt.Fprintln(os.Stderr, "usage: tcpraw secure send <file> [host:port]")
+			os.Exit(1)
+		}
+		addr := ""
+		if len(args) >= 2 {
+			addr = args[1]
+		}
+		if *secureSendWAN {
+			protocol.ApplyWANProfile()
+		}
+		protocol.RefreshCache = *secureSendRefresh
+		longTermSec := uint32(0)
+		if *secureSendLongTerm != "" {
+			sec, err := parseLongTermDuration(*secureSendLongTerm)
+			if err != nil {
+				fail("client", err)
+			}
+			longTermSec = sec
+		}
+		sendPath, cleanup, err := client.PrepareSendPath(args[0], *secureSendZip, *secureSendLinks)
+		if err != nil {
+			fail("client", err)
+		}
+		if cleanup != nil {
+			defer cleanup()
+		}
+		if err := client.RunClientSecureSend(sendPath, addr, *secureSendServerID, longTermSec); err != nil {
+			fail("client", err)
+		}
+	default:
+		printUsage()
+		printTotalNetworkStorage()
+		printVersionCheck()
+		os.Exit(1)
+	}
+}
+
+// printVersion reports the build: semantic version, the git commit and time
+// stamped in by the Go toolchain when built from a checkout, the Go version,
+// and the wire formats this binary speaks.
+func printVersion() {
+	fmt.Printf("tcpraw %s\n", Version)
+	commit, built, modified := "unknown", "unknown", false
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				commit = s.Value
+				if len(commit) > 12 {
+					commit = commit[:12]
+				}
+			case "vcs.time":
+				built = s.Value
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+	}
+	if modified {
+		commit += " (modified)"
+	}
+	fmt.Printf("  commit:   %s\n", commit)
+	fmt.Printf("  built:    %s\n", built)
+	fmt.Printf("  go:       %s\n", runtime.Version())
+	fmt.Printf("  protocol: download formats %d–%d, upload header marker 0x%X (versioned keys)\n",
+		protocol.FormatPlain, protocol.FormatChunkedV, protocol.UploadVersionMarker)
+}
+
+func printTotalNetworkStorage() {
+	total := client.GetTotalNetworkStorage(3 * time.Second)
+	const gb = 1024 * 1024 * 1024
+	if total == 0 {
+		fmt.Println("Total network storage: N/A")
+		return
+	}
+	gbF := float64(total) / float64(gb)
+	fmt.Printf("Total network storage: %.2f GB\n", gbF)
+}
+
+func printVersionCheck() {
+	// Only the signed manifest may announce a version; a check that fails
+	// (offline, tampered, unsigned) stays silent rather than echo whatever
+	// an unauthenticated URL serves.
+	remote, _, err := latestVersion("stable", 3*time.Second)
+	if err != nil || remote == "" {
+		return
+	}
+	remote = strings.TrimSpace(remote)
+	if versionLess(Version, remote) {
+		fmt.Printf("New version available: %s (you have %s)\n", remote, Version)
+	}
+}
+
+// versionLess returns true if a < b (e.g. "1.1.5" < "1.1.6").
+func versionLess(a, b string) bool {
+	partsA := strings.Split(strings.TrimSpace(a), ".")
+	partsB := strings.Split(strings.TrimSpace(b), ".")
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var na, nb int
+		if i < len(partsA) {
+			na, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			nb, _ = strconv.Atoi(partsB[i])
+		}
+		if na < nb {
+			return true
+		}
+		if na > nb {
+			return false
+		}
+	}
+	return false
+}
+
+func printUsage() {
+	fmt.Println("tcpraw – TCP file send/receive; client generates 6-digit code, data encrypted on server")
+	fmt.Println()
+	fmt.Println("  server  – listen for uploads; store encrypted data")
+	fmt.Println("  servers – test each server: ping, free space, 2s download & 2s upload")
+	fmt.Println("  bench   – same measurement against one host:port of your choosing (before publishing a node)")
+	fmt.Println("  send    – generate code, encrypt file, upload; you get the 6-digit code")
+	fmt.Println("  get     – download by code; decrypt with same code (or with key for secure uploads)")
+	fmt.Println("  update  – re-upload a changed file under its existing code, sending only changed chunks")
+	fmt.Println("  append  – grow an already-sent file under its code, sending only the new tail (needs the owner token)")
+	fmt.Println("  ls      – list a manifest bundle's contents (names, sizes, total) without downloading it")
+	fmt.Println("  check   – verify a code exists and its stored payload is intact, without downloading it")
+	fmt.Println("  secure send – encrypt with your own 256-bit key; server assigns code; use get + key to download")
+	fmt.Println("  keygen  – generate an X25519 identity for send -to / get -identity (-sign: Ed25519 signing keypair)")
+	fmt.Println("  version – print version, build and protocol details (-check: compare with the published version)")
+	fmt.Println("  selftest – start a throwaway in-process server and run send/get round trips (verify a build)")
+	fmt.Println()
+	fmt.Println("Usage:")
+	fmt.Println("  tcpraw server [-id=0] [-port=9999] [-dir=./data] [-web=8080] [-maxsize=0]")
+	fmt.Println("    -id=ID       server id 0–9 (first digit of generated codes); default 0")
+	fmt.Println("    -web=PORT    serve download page in browser (no client needed)")
+	fmt.Println("    -maxsize=MB  max upload size in MB (0 = default from code)")
+	fmt.Println("  tcpraw send [-server=0-9] [-local] <file> [host:port]   (-server = use that server id; host:port = override)")
+	fmt.Println("  tcpraw secure send [-server=0-9] <file> [host:port]")
+	fmt.Println("  tcpraw get <6-digit-code> [-o file] [-parallel N]")
+	fmt.Println("  tcpraw send -manifest <dir>; tcpraw get <code> -only 'docs/*.pdf'   (fetch single files from a bundle)")
+	fmt.Println("  tcpraw ls <6-digit-code>")
+	fmt.Println("  tcpraw check <6-digit-code>")
+	fmt.Println("  tcpraw update <6-digit-code> <file>")
+	fmt.Println("  tcpraw append <6-digit-code> <owner-token> <file>")
+	fmt.Println("  tcpraw <file> -local")
+	fmt.Println("  tcpraw get -local")
+	fmt.Println("  tcpraw servers   (benchmark each server: 2s download, 2s upload of random data)")
+	fmt.Println("  tcpraw bench <host:port> [-direction down|up|both] [-duration sec]")
+	fmt.Println()
+	fmt.Println("Servers are read from the address list (first digit of code = server id).")
+	fmt.Printf("Data kept %v, cleanup every %v, max upload %d MB, rate limit %d codes/%v sustained\n",
+		store.StorageDuration, server.CleanupInterval, server.MaxBlobSize/(1024*1024), server.RateLimitAttempts, server.RateLimitWindow)
+	fmt.Println()
+	fmt.Println("Example:")
+	fmt.Println("  tcpraw server -port=9999")
+	fmt.Println("  tcpraw send document.pdf")
+	fmt.Println("  tcpraw get 482917 -o myfile.pdf")
+	fmt.Println()
+	fmt.Println("Exit codes: 1 generic, 2 network, 3 code not found/expired, 4 checksum mismatch,")
+	fmt.Println("  5 file too large, 6 rate-limited (130 = interrupted)")
+}
+
+func hasArg(args []string, flag string) bool {
+	for _, a := range args {
+		if a == flag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"tcpraw/pkg/client"
+)
+
+// runWizard is what a bare `tcpraw` drops into when attached to a terminal:
+// a short interactive prompt for the two things a first-time user wants —
+// send a file and get one by code — so someone who was just told to
+// "install tcpraw" is not greeted by a usage dump and exit 1.
+func runWizard() {
+	in := bufio.NewReader(os.Stdin)
+	fmt.Printf("tcpraw %s – send and receive files with 6-digit codes\n\n", Version)
+	fmt.Println("  1) send a file")
+	fmt.Println("  2) get a file by code")
+	fmt.Println("  q) quit (run `tcpraw -h` for the full usage)")
+	for {
+		fmt.Print("\n> ")
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch strings.TrimSpace(line) {
+		case "1", "send", "s":
+			wizardSend(in)
+			return
+		case "2", "get", "g":
+			wizardGet(in)
+			return
+		case "q", "quit", "":
+			return
+		default:
+			fmt.Println("enter 1, 2 or q")
+		}
+	}
+}
+
+// prompt reads one trimmed line after printing label; empty on EOF.
+func prompt(in *bufio.Reader, label string) string {
+	fmt.Print(label)
+	line, _ := in.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+func wizardSend(in *bufio.Reader) {
+	path := prompt(in, "file or directory to send: ")
+	if path == "" {
+		return
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		fail("client", err)
+	}
+	zip := fi.IsDir()
+	client.CancelOnInterrupt()
+	sendPath, cleanup, err := client.PrepareSendPath(path, zip, client.SymlinksKeep)
+	if err != nil {
+		fail("client", err)
+	}
+	if cleanup != nil {
+		defer cleanup()
+	}
+	if err := client.RunClientSend(sendPath, "", -1, 0, "", "", "", 0, false); err != nil {
+		fail("client", err)
+	}
+	fmt.Println("Tell the recipient to run: tcpraw get <code>  (or just `tcpraw` and choose 2)")
+}
+
+func wizardGet(in *bufio.Reader) {
+	code := prompt(in, "6-digit code: ")
+	if code == "" {
+		return
+	}
+	client.CancelOnInterrupt()
+	if err := client.RunClientGet(code, "", false, "", "", "", false, 1); err != nil {
+		fail("client", err)
+	}
+}
+
+// isTTY reports whether f is attached to a terminal.
+func isTTY(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -4,6 +4,13 @@ go 1.24
 
 toolchain go1.24.2
 
-require github.com/klauspost/pgzip v1.2.6
+require (
+	github.com/klauspost/pgzip v1.2.6
+	golang.org/x/crypto v0.33.0
+	golang.org/x/text v0.22.0
+)
 
-require github.com/klauspost/compress v1.18.5 // indirect
+require (
+	github.com/klauspost/compress v1.18.5 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+)
@@ -0,0 +1,562 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+
+	crand "crypto/rand"
+
+	"tcpraw/pkg/protocol"
+)
+
+// The Run* functions in this package drive the interactive CLI and print
+// their progress. The Client type below exposes the same transfers as a
+// library: methods take a context, never write to stdout, and fail with the
+// typed errors here so callers can branch on the outcome instead of
+// matching message strings.
+var (
+	ErrNotFound          = errors.New("tcpraw: code unknown or expired")
+	ErrPasswordRequired  = errors.New("tcpraw: download requires a password")
+	ErrPolicyRejected    = errors.New("tcpraw: rejected by server policy")
+	ErrChecksumMismatch  = errors.New("tcpraw: checksum mismatch after decrypt")
+	ErrServer            = errors.New("tcpraw: server error")
+	ErrSecureKeyRequired = errors.New("tcpraw: transfer was secure-sent and needs its key")
+	ErrTooLarge          = errors.New("tcpraw: file too large")
+	ErrRateLimited       = errors.New("tcpraw: rate-limited by server")
+)
+
+// AutoServerID makes a Client probe the public list for the fastest server.
+const AutoServerID = -1
+
+// A Client performs tcpraw transfers programmatically. The zero value talks
+// to listed server 0; set Addr for a specific server (bypassing the list) or
+// ServerID to pick a listed server / AutoServerID to probe for the fastest.
+type Client struct {
+	Addr     string // explicit host:port; empty = use the public server list
+	ServerID int    // list id 0-9 when Addr is empty; AutoServerID probes
+}
+
+// SendOptions carries the optional per-upload settings of Send and
+// SecureSend; the zero value matches the CLI defaults.
+type SendOptions struct {
+	Password   string // require this password on download (code uploads only)
+	TTLSeconds uint32 // long-term retention request; 0 = server default
+}
+
+// ServerInfo is what Info reports about a server.
+type ServerInfo struct {
+	FreeBytes uint64 // free disk space on the server's data directory
+}
+
+// guardConn applies ctx to conn: an existing deadline becomes the socket
+// deadline, and cancellation closes the connection to unblock any read or
+// write. The returned stop must be deferred.
+func guardConn(ctx context.Context, conn net.Conn) (stop func() bool) {
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	return context.AfterFunc(ctx, func() { conn.Close() })
+}
+
+// ctxErr prefers the context's error once it is cancelled, so callers see
+// context.Canceled / DeadlineExceeded instead of "use of closed connection".
+func ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// dial resolves the target server (explicit address, listed id, or probe)
+// and returns the connection plus the server id used for code generation.
+func (c *Client) dial(ctx context.Context, fileSize int64) (net.Conn, int, error) {
+	if c.Addr != "" {
+		conn, err := protocol.DialServer(c.Addr, protocol.DialTimeout)
+		if err != nil {
+			return nil, 0, ctxErr(ctx, err)
+		}
+		return conn, 0, nil
+	}
+	if c.ServerID >= 0 && c.ServerID <= 9 {
+		addrs, err := protocol.FetchServerList()
+		if err != nil {
+			return nil, 0, fmt.Errorf("fetch server list: %w", err)
+		}
+		if addrs[c.ServerID] == "" {
+			return nil, 0, fmt.Errorf("server %d not in list", c.ServerID)
+		}
+		conn, err := protocol.DialServer(addrs[c.ServerID], protocol.DialTimeout)
+		if err != nil {
+			return nil, 0, ctxErr(ctx, err)
+		}
+		return conn, c.ServerID, nil
+	}
+	conn, serverID, err := tryServersFromList(fileSize)
+	if err != nil {
+		return nil, 0, ctxErr(ctx, err)
+	}
+	return conn, serverID, nil
+}
+
+// statusErr maps a non-OK upload status to its typed error.
+func statusErr(status byte) error {
+	switch status {
+	case protocol.StatusPolicyRejected:
+		return ErrPolicyRejected
+	default:
+		return ErrServer
+	}
+}
+
+// Send uploads path code-encrypted, like the CLI send command, and returns
+// the 6-digit download code.
+func (c *Client) Send(ctx context.Context, path string, opts SendOptions) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("path is a directory, not a file")
+	}
+	size := info.Size()
+	if opts.TTLSeconds > 0 && size > protocol.LongTermMaxBytes {
+		return "", fmt.Errorf("%w: long-term uploads limited to %d MB", ErrTooLarge, protocol.LongTermMaxBytes/(1024*1024))
+	}
+
+	conn, serverID, err := c.dial(ctx, size)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	defer guardConn(ctx, conn)()
+
+	code := protocol.GenerateCodeWithServerID(serverID)
+	keyVersion := protocol.CurrentKeyVersion
+	keyMaterial, err := protocol.NewKeySalt()
+	if err != nil {
+		return "", fmt.Errorf("key salt: %w", err)
+	}
+	key, err := protocol.DeriveTransferKey(code, keyVersion, keyMaterial)
+	if err != nil {
+		return "", fmt.Errorf("derive key: %w", err)
+	}
+
+	chunkBuf := make([]byte, protocol.UploadChunkSize)
+	hasher := protocol.NewIntegrityHasher(key, keyVersion)
+	var chunkSums []byte
+	if protocol.HeaderHasChunkSums(keyVersion) {
+		// Chunk boundaries mirror getChunk below: one Read per chunk.
+		var idx uint64
+		for {
+			n, err := f.Read(chunkBuf)
+			if n > 0 {
+				hasher.Write(chunkBuf[:n])
+				chunkSums = append(chunkSums, protocol.ChunkSum(key, idx, chunkBuf[:n])...)
+				idx++
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", ctxErr(ctx, fmt.Errorf("read file: %w", err))
+			}
+		}
+	} else if _, err := io.CopyBuffer(hasher, f, chunkBuf); err != nil {
+		return "", ctxErr(ctx, fmt.Errorf("read file: %w", err))
+	}
+	plaintextChecksum := hasher.Sum(nil)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	bw := bufio.NewWriterSize(conn, protocol.BufSize)
+	msgType := byte(protocol.MsgUpload)
+	if opts.Password != "" {
+		msgType = protocol.MsgUploadPw
+	}
+	if err := protocol.WriteMessageTypeAuth(bw, msgType); err != nil {
+		return "", ctxErr(ctx, err)
+	}
+	if opts.Password != "" {
+		if err := protocol.WritePasswordFrame(bw, opts.Password); err != nil {
+			return "", ctxErr(ctx, err)
+		}
+	}
+	numChunks := uint32((size + int64(protocol.UploadChunkSize) - 1) / int64(protocol.UploadChunkSize))
+	meta := protocol.NewFileMeta(info.ModTime(), uint32(info.Mode().Perm()))
+	getChunk := func() ([]byte, error) {
+		n, err := f.Read(chunkBuf)
+		if n > 0 {
+			return chunkBuf[:n], nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	if err := protocol.WriteEncryptedUploadChunked(bw, code, filepath.Base(path), size, opts.TTLSeconds, numChunks, plaintextChecksum, chunkSums, keyVersion, keyMaterial, key, nil, nil, &meta, getChunk, nil); err != nil {
+		return "", ctxErr(ctx, fmt.Errorf("send: %w", err))
+	}
+	if err := bw.Flush(); err != nil {
+		return "", ctxErr(ctx, err)
+	}
+	status, err := protocol.ReadStatus(conn)
+	if err != nil {
+		return "", ctxErr(ctx, fmt.Errorf("read response: %w", err))
+	}
+	if status != protocol.StatusOK {
+		return "", statusErr(status)
+	}
+	return code, nil
+}
+
+// SecureSend uploads path sealed with a random key, like the CLI secure
+// send command. It returns the code and the key; without the key the file
+// cannot be decrypted, so the caller must deliver it out of band.
+func (c *Client) SecureSend(ctx context.Context, path string, opts SendOptions) (code string, key []byte, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", nil, err
+	}
+	if info.IsDir() {
+		return "", nil, fmt.Errorf("path is a directory, not a file")
+	}
+	size := info.Size()
+	if size == 0 {
+		return "", nil, fmt.Errorf("file is empty")
+	}
+	if opts.TTLSeconds > 0 && size > protocol.LongTermMaxBytes {
+		return "", nil, fmt.Errorf("%w: long-term uploads limited to %d MB", ErrTooLarge, protocol.LongTermMaxBytes/(1024*1024))
+	}
+
+	key = make([]byte, protocol.SecureKeySize)
+	if _, err := io.ReadFull(crand.Reader, key); err != nil {
+		return "", nil, fmt.Errorf("generate key: %w", err)
+	}
+
+	conn, _, err := c.dial(ctx, size)
+	if err != nil {
+		return "", nil, err
+	}
+	defer conn.Close()
+	defer guardConn(ctx, conn)()
+
+	bw := bufio.NewWriterSize(conn, protocol.BufSize)
+	if err := protocol.WriteMessageTypeAuth(bw, protocol.MsgSecureUpload); err != nil {
+		return "", nil, ctxErr(ctx, err)
+	}
+	// Always the chunked form: it streams from disk regardless of size.
+	if _, err := bw.Write([]byte{1}); err != nil {
+		return "", nil, ctxErr(ctx, err)
+	}
+	chunkBuf := make([]byte, protocol.UploadChunkSize)
+	hasher := sha256.New()
+	if _, err := io.CopyBuffer(hasher, f, chunkBuf); err != nil {
+		return "", nil, fmt.Errorf("read file: %w", err)
+	}
+	plaintextChecksum := hasher.Sum(nil)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", nil, err
+	}
+	numChunks := uint32((size + int64(protocol.UploadChunkSize) - 1) / int64(protocol.UploadChunkSize))
+	if err := protocol.WriteSecureUploadChunkedHeader(bw, filepath.Base(path), size, opts.TTLSeconds, numChunks, plaintextChecksum); err != nil {
+		return "", nil, ctxErr(ctx, fmt.Errorf("send header: %w", err))
+	}
+	var chunkIndex uint64
+	for {
+		n, err := f.Read(chunkBuf)
+		if n > 0 {
+			nonce, sealed, encErr := protocol.EncryptChunkAt(key, chunkIndex, chunkBuf[:n])
+			if encErr != nil {
+				return "", nil, fmt.Errorf("encrypt chunk: %w", encErr)
+			}
+			if err := protocol.WriteChunk(bw, nonce, sealed); err != nil {
+				return "", nil, ctxErr(ctx, fmt.Errorf("write chunk: %w", err))
+			}
+			chunkIndex++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("read file: %w", err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return "", nil, ctxErr(ctx, err)
+	}
+	status, code, err := protocol.ReadCodeResponse(conn)
+	if err != nil {
+		return "", nil, ctxErr(ctx, fmt.Errorf("read response: %w", err))
+	}
+	if status != protocol.StatusOK {
+		return "", nil, statusErr(status)
+	}
+	return code, key, nil
+}
+
+// Get downloads and decrypts the upload behind code into w, returning the
+// original filename. Secure-sent uploads need their key and fail with
+// ErrSecureKeyRequired; password-protected ones with ErrPasswordRequired.
+func (c *Client) Get(ctx context.Context, code string, w io.Writer) (name string, err error) {
+	if !protocol.ValidCode(code) {
+		return "", protocol.ErrMalformedCode
+	}
+	addr := c.Addr
+	if addr == "" {
+		serverID := int(code[0] - '0')
+		addrs, err := protocol.FetchServerList()
+		if err != nil {
+			return "", fmt.Errorf("fetch server list: %w", err)
+		}
+		if addrs[serverID] == "" {
+			return "", fmt.Errorf("server %d not in list", serverID)
+		}
+		addr = addrs[serverID]
+	}
+
+	conn, br, status, err := openDownload(addr, code, "")
+	if err != nil {
+		return "", ctxErr(ctx, err)
+	}
+	defer conn.Close()
+	defer guardConn(ctx, conn)()
+
+	switch status {
+	case protocol.StatusOK:
+	case protocol.StatusNotFound:
+		return "", ErrNotFound
+	case protocol.StatusPasswordRequired:
+		return "", ErrPasswordRequired
+	default:
+		return "", ErrServer
+	}
+
+	formatByte := make([]byte, 1)
+	if _, err := io.ReadFull(br, formatByte); err != nil {
+		return "", ctxErr(ctx, fmt.Errorf("read format: %w", err))
+	}
+	format := formatByte[0]
+	keyVersion := protocol.KeyVersionSHA256
+	var kdfSalt []byte
+	if format == protocol.FormatPlainV || format == protocol.FormatChunkedV {
+		verBuf := make([]byte, 1)
+		if _, err := io.ReadFull(br, verBuf); err != nil {
+			return "", ctxErr(ctx, fmt.Errorf("read key version: %w", err))
+		}
+		keyVersion = verBuf[0]
+		if size := protocol.HeaderSaltSize(keyVersion); size > 0 {
+			kdfSalt = make([]byte, size)
+			if _, err := io.ReadFull(br, kdfSalt); err != nil {
+				return "", ctxErr(ctx, fmt.Errorf("read key salt: %w", err))
+			}
+		}
+		if protocol.HeaderHasSignFrame(keyVersion) {
+			if _, _, err := protocol.ReadSignatureFrame(br); err != nil {
+				return "", ctxErr(ctx, fmt.Errorf("read signer frame: %w", err))
+			}
+		}
+		if protocol.HeaderHasMetaFrame(keyVersion) {
+			// The library writes into an io.Writer, so there is no file to
+			// restore metadata onto; the frame still has to leave the stream.
+			if _, err := protocol.ReadRawMetaFrame(br); err != nil {
+				return "", ctxErr(ctx, fmt.Errorf("read metadata frame: %w", err))
+			}
+		}
+		if format == protocol.FormatPlainV {
+			format = protocol.FormatPlain
+		} else {
+			format = protocol.FormatChunked
+		}
+	}
+
+	switch format {
+	case protocol.FormatSecure, protocol.FormatSecureChunked:
+		return "", ErrSecureKeyRequired
+	case protocol.FormatPlain:
+		name, plaintextChecksum, nonce, sealed, err := protocol.ReadEncryptedBlob(br, nil)
+		if err != nil {
+			return "", ctxErr(ctx, fmt.Errorf("read encrypted blob: %w", err))
+		}
+		key, err := protocol.ResolveTransferKey(code, keyVersion, kdfSalt, "")
+		if err != nil {
+			return "", fmt.Errorf("derive key: %w", err)
+		}
+		plaintext, err := protocol.DecryptWithKey(key, nonce, sealed)
+		if err != nil {
+			return "", fmt.Errorf("decrypt: %w", err)
+		}
+		tagHasher := protocol.NewIntegrityHasher(key, keyVersion)
+		tagHasher.Write(plaintext)
+		if !protocol.ChecksumEqual(tagHasher.Sum(nil), plaintextChecksum) {
+			return "", ErrChecksumMismatch
+		}
+		if _, err := w.Write(plaintext); err != nil {
+			return "", err
+		}
+		return name, nil
+	case protocol.FormatChunked:
+		name, totalPlainLen, numChunks, plaintextChecksum, err := protocol.ReadEncryptedBlobChunkedHeader(br)
+		if err != nil {
+			return "", ctxErr(ctx, fmt.Errorf("read blob header: %w", err))
+		}
+		var chunkSums []byte
+		if protocol.HeaderHasChunkSums(keyVersion) {
+			chunkSums = make([]byte, int64(numChunks)*protocol.ChunkSumSize)
+			if _, err := io.ReadFull(br, chunkSums); err != nil {
+				return "", ctxErr(ctx, fmt.Errorf("read chunk sums: %w", err))
+			}
+		}
+		key, err := protocol.ResolveTransferKey(code, keyVersion, kdfSalt, "")
+		if err != nil {
+			return "", fmt.Errorf("derive key: %w", err)
+		}
+		hasher := protocol.NewIntegrityHasher(key, keyVersion)
+		_, _, err = downloadChunksPipelined(br, w, numChunks, totalPlainLen, hasher, func(i uint32, nonce, sealed []byte) ([]byte, error) {
+			var pt []byte
+			var err error
+			if protocol.ChunkStreamAAD(keyVersion) {
+				pt, err = protocol.DecryptChunkStream(key, uint64(i), i == numChunks-1, nonce, sealed)
+			} else {
+				pt, err = protocol.DecryptWithKey(key, nonce, sealed)
+			}
+			if err == nil && chunkSums != nil && !protocol.VerifyChunkSum(key, uint64(i), pt, chunkSums[int64(i)*protocol.ChunkSumSize:int64(i+1)*protocol.ChunkSumSize]) {
+				return nil, fmt.Errorf("%w – chunk %d failed its checksum", ErrChecksumMismatch, i)
+			}
+			return pt, err
+		}, nil)
+		if err != nil {
+			return "", ctxErr(ctx, err)
+		}
+		if !protocol.ChecksumEqual(hasher.Sum(nil), plaintextChecksum) {
+			return "", ErrChecksumMismatch
+		}
+		return name, nil
+	default:
+		return "", fmt.Errorf("unknown download format %d", format)
+	}
+}
+
+// GetSecure downloads a secure-sent upload into w using the key returned by
+// SecureSend, returning the original filename. Code-encrypted uploads fail
+// with an error directing the caller to Get.
+func (c *Client) GetSecure(ctx context.Context, code string, key []byte, w io.Writer) (name string, err error) {
+	if !protocol.ValidCode(code) {
+		return "", protocol.ErrMalformedCode
+	}
+	if len(key) != protocol.SecureKeySize {
+		return "", fmt.Errorf("key must be %d bytes", protocol.SecureKeySize)
+	}
+	addr := c.Addr
+	if addr == "" {
+		serverID := int(code[0] - '0')
+		addrs, err := protocol.FetchServerList()
+		if err != nil {
+			return "", fmt.Errorf("fetch server list: %w", err)
+		}
+		if addrs[serverID] == "" {
+			return "", fmt.Errorf("server %d not in list", serverID)
+		}
+		addr = addrs[serverID]
+	}
+
+	conn, br, status, err := openDownload(addr, code, "")
+	if err != nil {
+		return "", ctxErr(ctx, err)
+	}
+	defer conn.Close()
+	defer guardConn(ctx, conn)()
+
+	switch status {
+	case protocol.StatusOK:
+	case protocol.StatusNotFound:
+		return "", ErrNotFound
+	case protocol.StatusPasswordRequired:
+		return "", ErrPasswordRequired
+	default:
+		return "", ErrServer
+	}
+
+	formatByte := make([]byte, 1)
+	if _, err := io.ReadFull(br, formatByte); err != nil {
+		return "", ctxErr(ctx, fmt.Errorf("read format: %w", err))
+	}
+	switch formatByte[0] {
+	case protocol.FormatSecure:
+		name, plaintextChecksum, nonce, sealed, err := protocol.ReadEncryptedBlob(br, nil)
+		if err != nil {
+			return "", ctxErr(ctx, fmt.Errorf("read encrypted blob: %w", err))
+		}
+		plaintext, err := protocol.DecryptWithKey(key, nonce, sealed)
+		if err != nil {
+			return "", fmt.Errorf("decrypt: %w", err)
+		}
+		sum := sha256.Sum256(plaintext)
+		if !protocol.ChecksumEqual(sum[:], plaintextChecksum) {
+			return "", ErrChecksumMismatch
+		}
+		if _, err := w.Write(plaintext); err != nil {
+			return "", err
+		}
+		return name, nil
+	case protocol.FormatSecureChunked:
+		name, totalPlainLen, numChunks, plaintextChecksum, err := protocol.ReadEncryptedBlobChunkedHeader(br)
+		if err != nil {
+			return "", ctxErr(ctx, fmt.Errorf("read blob header: %w", err))
+		}
+		hasher := sha256.New()
+		_, _, err = downloadChunksPipelined(br, w, numChunks, totalPlainLen, hasher, func(_ uint32, nonce, sealed []byte) ([]byte, error) {
+			return protocol.DecryptWithKey(key, nonce, sealed)
+		}, nil)
+		if err != nil {
+			return "", ctxErr(ctx, err)
+		}
+		if !protocol.ChecksumEqual(hasher.Sum(nil), plaintextChecksum) {
+			return "", ErrChecksumMismatch
+		}
+		return name, nil
+	default:
+		return "", fmt.Errorf("tcpraw: not a secure-sent upload (format %d); use Get", formatByte[0])
+	}
+}
+
+// Info queries the target server's free disk space (the same request the
+// CLI probe uses).
+func (c *Client) Info(ctx context.Context) (ServerInfo, error) {
+	conn, _, err := c.dial(ctx, 0)
+	if err != nil {
+		return ServerInfo{}, err
+	}
+	defer conn.Close()
+	defer guardConn(ctx, conn)()
+
+	if err := protocol.WriteMessageTypeAuth(conn, protocol.MsgTest); err != nil {
+		return ServerInfo{}, ctxErr(ctx, err)
+	}
+	if err := protocol.WriteTestRequest(conn, 0); err != nil {
+		return ServerInfo{}, ctxErr(ctx, err)
+	}
+	var free uint64
+	if err := binary.Read(conn, binary.BigEndian, &free); err != nil {
+		return ServerInfo{}, ctxErr(ctx, fmt.Errorf("read response: %w", err))
+	}
+	return ServerInfo{FreeBytes: free}, nil
+}
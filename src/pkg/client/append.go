@@ -0,0 +1,172 @@
+package client
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"tcpraw/pkg/protocol"
+)
+
+// Append (tcpraw append <code> <owner-token> <file>): deliver the grown
+// version of an already-sent file under its existing code, sending only the
+// new tail. The local file must be a pure extension of what was uploaded —
+// every stored chunk except the last has to digest identically — and the
+// owner token printed at send time proves the caller is the original
+// uploader. The old final chunk re-uploads alongside the new chunks: its
+// final-chunk AAD ties the stored record to the end of the file.
+
+func RunClientAppend(code, tokenHex, filePath string) error {
+	if !protocol.ValidCode(code) {
+		return fmt.Errorf("code must be 6 digits")
+	}
+	token, err := hex.DecodeString(tokenHex)
+	if err != nil || len(token) != protocol.OwnerTokenSize {
+		return fmt.Errorf("owner token must be %d hex characters", protocol.OwnerTokenSize*2)
+	}
+	serverID := int(code[0] - '0')
+	addrs, err := protocol.FetchServerList()
+	if err != nil {
+		return fmt.Errorf("fetch server list: %w", err)
+	}
+	if addrs[serverID] == "" {
+		return fmt.Errorf("server %d not in list", serverID)
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("read file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat file: %w", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("path is a directory")
+	}
+	size := info.Size()
+	if size == 0 {
+		return fmt.Errorf("file is empty")
+	}
+
+	conn, err := protocol.DialServer(addrs[serverID], protocol.DialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	registerTransferConn(conn)
+
+	bw := bufio.NewWriterSize(conn, protocol.BufSize)
+	if err := protocol.WriteMessageTypeAuth(bw, protocol.MsgAppend); err != nil {
+		return err
+	}
+	if err := protocol.WriteDownloadRequest(bw, code); err != nil {
+		return err
+	}
+	if _, err := bw.Write(token); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	br := bufio.NewReaderSize(conn, protocol.BufSize)
+	status, err := protocol.ReadStatus(br)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	switch status {
+	case protocol.StatusOK:
+	case protocol.StatusNotFound:
+		return ErrNotFound
+	default:
+		return fmt.Errorf("append refused: bad owner token, or the blob cannot take appends")
+	}
+	keyVersion, salt, chunkLen, oldTotal, oldNum, gen, oldSums, err := protocol.ReadDeltaSignature(br)
+	if err != nil {
+		return fmt.Errorf("read signature: %w", err)
+	}
+	if size < int64(oldTotal) {
+		return fmt.Errorf("file is smaller than the stored blob (%s < %s); use tcpraw update to replace content",
+			protocol.FormatBytes(float64(size)), protocol.FormatBytes(float64(oldTotal)))
+	}
+	key, err := protocol.DeriveTransferKey(code, keyVersion, salt)
+	if err != nil {
+		return fmt.Errorf("derive key: %w", err)
+	}
+	// A single-chunk blob re-uploads in full anyway, so chunk the grown file
+	// at the current upload size instead of the stored one.
+	if oldNum <= 1 {
+		chunkLen = uint32(protocol.UploadChunkSize)
+	}
+
+	// Pass 1: digest the whole file, checking that the stored chunks are an
+	// untouched prefix; everything from the old final chunk on is sent.
+	numChunks := uint32((size + int64(chunkLen) - 1) / int64(chunkLen))
+	hasher := protocol.NewIntegrityHasher(key, keyVersion)
+	chunkSums := make([]byte, 0, int64(numChunks)*protocol.ChunkSumSize)
+	buf := make([]byte, chunkLen)
+	for i := uint32(0); i < numChunks; i++ {
+		n, err := readChunkAt(f, buf, int64(i)*int64(chunkLen))
+		if err != nil {
+			return fmt.Errorf("read file: %w", err)
+		}
+		hasher.Write(buf[:n])
+		sum := protocol.ChunkSum(key, uint64(i), buf[:n])
+		chunkSums = append(chunkSums, sum...)
+		if oldNum > 0 && i < oldNum-1 &&
+			!protocol.VerifyChunkSum(key, uint64(i), buf[:n], oldSums[int64(i)*protocol.ChunkSumSize:int64(i+1)*protocol.ChunkSumSize]) {
+			return fmt.Errorf("chunk %d differs from the stored blob; the file is not a pure extension (use tcpraw update)", i)
+		}
+	}
+	checksum := hasher.Sum(nil)
+	first := uint32(0)
+	if oldNum > 1 {
+		first = oldNum - 1
+	}
+
+	fmt.Fprintf(os.Stderr, "info: appending %s (%d of %d chunks sent)\n",
+		protocol.FormatBytes(float64(size)-float64(oldTotal)), numChunks-first, numChunks)
+
+	// Pass 2: encrypt and send the tail.
+	if err := protocol.WriteDeltaHeader(bw, uint64(size), numChunks, checksum, chunkSums, numChunks-first); err != nil {
+		return fmt.Errorf("send: %w", err)
+	}
+	start := time.Now()
+	var sent int64
+	for i := first; i < numChunks; i++ {
+		n, err := readChunkAt(f, buf, int64(i)*int64(chunkLen))
+		if err != nil {
+			return fmt.Errorf("read file: %w", err)
+		}
+		nonce, sealed, err := protocol.EncryptChunkStreamGen(key, gen, uint64(i), i == numChunks-1, buf[:n])
+		if err != nil {
+			return fmt.Errorf("encrypt chunk %d: %w", i, err)
+		}
+		if err := protocol.WriteDeltaChunk(bw, i, nonce, sealed); err != nil {
+			return fmt.Errorf("send: %w", err)
+		}
+		sent += int64(n)
+		if elapsed := time.Since(start).Seconds(); elapsed >= 0.001 {
+			fmt.Fprintf(os.Stderr, "\r  speed: %s/s  |  sent: %s  ",
+				protocol.FormatBytes(float64(sent)/elapsed), protocol.FormatBytes(float64(sent)))
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+	fmt.Fprintln(os.Stderr)
+
+	fmt.Fprintln(os.Stderr, "info: waiting for server...")
+	status, err = protocol.ReadStatus(conn)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if status != protocol.StatusOK {
+		return fmt.Errorf("server error")
+	}
+	fmt.Printf("File appended. Code unchanged: %s (%s)\n", Green(code), formatValidDuration(readEchoedTTL(conn, 0)))
+	return nil
+}
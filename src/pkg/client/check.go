@@ -0,0 +1,89 @@
+package client
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"tcpraw/pkg/protocol"
+)
+
+// Check (tcpraw check <code>): ask the server whether a code is still
+// stored and whether its payload passes the server-side integrity
+// validation, without transferring it. The report carries the blob layout,
+// the remaining storage time and a digest of the sealed data as stored.
+
+func RunClientCheck(code string) error {
+	if !protocol.ValidCode(code) {
+		return fmt.Errorf("code must be 6 digits")
+	}
+	serverID := int(code[0] - '0')
+	addrs, err := protocol.FetchServerList()
+	if err != nil {
+		return fmt.Errorf("fetch server list: %w", err)
+	}
+	if addrs[serverID] == "" {
+		return fmt.Errorf("server %d not in list", serverID)
+	}
+	conn, err := protocol.DialServer(addrs[serverID], protocol.DialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	bw := bufio.NewWriterSize(conn, protocol.BufSize)
+	if err := protocol.WriteMessageTypeAuth(bw, protocol.MsgCheck); err != nil {
+		return err
+	}
+	if err := protocol.WriteDownloadRequest(bw, code); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	br := bufio.NewReaderSize(conn, protocol.BufSize)
+	status, err := protocol.ReadStatus(br)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	switch status {
+	case protocol.StatusOK:
+	case protocol.StatusNotFound:
+		return ErrNotFound
+	case protocol.StatusCorrupt:
+		return fmt.Errorf("server reports the stored payload is damaged; the code will not download cleanly")
+	case protocol.StatusRedirect:
+		newCode, err := protocol.ReadDownloadRequest(br)
+		if err != nil {
+			return fmt.Errorf("read redirect: %w", err)
+		}
+		fmt.Printf("Code %s: moved to another server (stored as %s); get with the original code still works\n", Green(code), newCode)
+		return nil
+	case protocol.StatusEmbargoed:
+		var remaining uint32
+		if err := binary.Read(br, binary.BigEndian, &remaining); err != nil {
+			return fmt.Errorf("read embargo: %w", err)
+		}
+		fmt.Printf("Code %s: timed release, available in %s\n", Green(code), (time.Duration(remaining) * time.Second).Round(time.Second))
+		return nil
+	default:
+		return fmt.Errorf("server error (status %d)", status)
+	}
+	name, totalPlainLen, numChunks, remainingSec, digest, err := protocol.ReadCheckReport(br)
+	if err != nil {
+		return fmt.Errorf("read check report: %w", err)
+	}
+
+	fmt.Printf("Code %s: intact and ready\n", Green(code))
+	fmt.Printf("  name:      %s\n", name)
+	if numChunks > 0 {
+		fmt.Printf("  size:      %s (%d chunks)\n", protocol.FormatBytes(float64(totalPlainLen)), numChunks)
+	} else {
+		fmt.Printf("  size:      %s\n", protocol.FormatBytes(float64(totalPlainLen)))
+	}
+	fmt.Printf("  expiry:    %s\n", formatValidDuration(remainingSec))
+	fmt.Printf("  sealed:    sha256:%x\n", digest)
+	return nil
+}
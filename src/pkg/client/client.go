@@ -0,0 +1,1969 @@
+// Package client implements the tcpraw client operations: send, get,
+// secure send, server probing and benchmarking, and the local LAN mode.
+package client
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pgzip "github.com/klauspost/pgzip"
+	"golang.org/x/text/unicode/norm"
+
+	"tcpraw/pkg/protocol"
+)
+
+const (
+	probeTimeout      = 1 * time.Second
+	probeDialTimeout  = 500 * time.Millisecond
+	maxSecureLoadRAM  = 500 * 1024 * 1024  // 500 MB; above this, secure send streams in chunks
+	mmapSendThreshold = 1024 * 1024 * 1024 // 1 GB; above this, send maps the file instead of buffered reads
+)
+
+func formatValidDuration(storageDurationSec uint32) string {
+	if storageDurationSec == 0 {
+		return "valid 30 min"
+	}
+	d := time.Duration(storageDurationSec) * time.Second
+	if d >= 24*time.Hour {
+		days := int(d / (24 * time.Hour))
+		if days == 1 {
+			return "valid 1 day"
+		}
+		return fmt.Sprintf("valid %d days", days)
+	}
+	if d >= time.Hour {
+		hours := int(d / time.Hour)
+		if hours == 1 {
+			return "valid 1 hour"
+		}
+		return fmt.Sprintf("valid %d hours", hours)
+	}
+	mins := int(d / time.Minute)
+	if mins < 1 {
+		mins = 1
+	}
+	return fmt.Sprintf("valid %d min", mins)
+}
+
+// readEchoedTTL reads the storage-duration echo that newer servers append
+// after a successful upload ack (servers with a custom -ttl). Older servers
+// close the connection without sending it, so any read error within the
+// short deadline falls back to the client-side value.
+func readEchoedTTL(conn net.Conn, fallback uint32) uint32 {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+	var sec uint32
+	if err := binary.Read(conn, binary.BigEndian, &sec); err != nil || sec == 0 {
+		return fallback
+	}
+	return sec
+}
+
+// readOwnerToken reads the owner token newer servers echo after the TTL on
+// appendable uploads; nil against an older server or a non-appendable blob.
+func readOwnerToken(conn net.Conn) []byte {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+	token := make([]byte, protocol.OwnerTokenSize)
+	if _, err := io.ReadFull(conn, token); err != nil {
+		return nil
+	}
+	return token
+}
+
+func newParallelGzipWriter(w io.Writer) (*pgzip.Writer, error) {
+	gz, err := pgzip.NewWriterLevel(w, gzip.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	// Use all CPU cores for gzip compression blocks.
+	gz.SetConcurrency(1<<20, runtime.NumCPU())
+	return gz, nil
+}
+
+// Symlink policies for directory packing (-links flag).
+const (
+	SymlinksKeep   = "keep"   // store as links (default)
+	SymlinksFollow = "follow" // store the pointed-to file's content
+	SymlinksSkip   = "skip"   // leave them out
+)
+
+// PrepareSendPath returns the path to send (possibly a temp tar.gz) and an optional cleanup to remove temp file.
+// If path is a directory and zip is false, prompts "Pack directory into tar.gz? [y/N]"; if no, returns error.
+// symlinks selects the policy for symbolic links inside a packed directory;
+// sockets, fifos and devices are always skipped with a warning, and hard
+// links are stored as links so they round-trip instead of duplicating data.
+func PrepareSendPath(path string, zipFlag bool, symlinks string) (sendPath string, cleanup func(), err error) {
+	switch symlinks {
+	case SymlinksKeep, SymlinksFollow, SymlinksSkip:
+	default:
+		return "", nil, fmt.Errorf("invalid -links value %q (keep, follow or skip)", symlinks)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", nil, err
+	}
+	if info.IsDir() {
+		if !zipFlag {
+			fmt.Fprint(os.Stderr, "Pack directory into tar.gz? [y/N] ")
+			rd := bufio.NewReader(os.Stdin)
+			line, _ := rd.ReadString('\n')
+			line = strings.TrimSpace(strings.ToLower(line))
+			if line != "y" && line != "yes" {
+				return "", nil, fmt.Errorf("cannot send directory (use -zip to pack)")
+			}
+		}
+		tmp, err := os.CreateTemp("", "tcpraw-*.tar.gz")
+		if err != nil {
+			return "", nil, fmt.Errorf("create temp: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "info: compressing using %d CPU cores...\n", runtime.NumCPU())
+		gz, err := newParallelGzipWriter(tmp)
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return "", nil, err
+		}
+		tw := tar.NewWriter(gz)
+		err = packDirEntries(tw, path, symlinks, nil)
+		if err != nil {
+			tw.Close()
+			gz.Close()
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return "", nil, fmt.Errorf("pack directory: %w", err)
+		}
+		if err := tw.Close(); err != nil {
+			gz.Close()
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return "", nil, err
+		}
+		if err := gz.Close(); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return "", nil, err
+		}
+		if err := tmp.Close(); err != nil {
+			os.Remove(tmp.Name())
+			return "", nil, err
+		}
+		return tmp.Name(), func() { os.Remove(tmp.Name()) }, nil
+	}
+	// single file
+	if zipFlag {
+		tmp, err := os.CreateTemp("", "tcpraw-*.tar.gz")
+		if err != nil {
+			return "", nil, fmt.Errorf("create temp: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "info: compressing using %d CPU cores...\n", runtime.NumCPU())
+		gz, err := newParallelGzipWriter(tmp)
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return "", nil, err
+		}
+		tw := tar.NewWriter(gz)
+		f, err := os.Open(path)
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return "", nil, err
+		}
+		info, _ := f.Stat()
+		hdr, _ := tar.FileInfoHeader(info, "")
+		hdr.Name = filepath.Base(path)
+		tw.WriteHeader(hdr)
+		io.Copy(tw, f)
+		f.Close()
+		tw.Close()
+		gz.Close()
+		tmp.Close()
+		return tmp.Name(), func() { os.Remove(tmp.Name()) }, nil
+	}
+	return path, nil, nil
+}
+
+// packDirEntries walks the directory at path and writes its tree to tw, one
+// tar entry per file, applying the symlink policy. before, when non-nil,
+// runs ahead of each entry with its archived name and data size, after the
+// previous entry's padding is flushed, so a caller can record where each
+// entry starts (manifest bundles).
+func packDirEntries(tw *tar.Writer, path, symlinks string, before func(rel string, size int64) error) error {
+	baseDir := filepath.Dir(path)
+	seenLinks := map[string]string{} // hard-link key -> first archived name
+	writeHeader := func(hdr *tar.Header) error {
+		if before != nil {
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+			if err := before(hdr.Name, hdr.Size); err != nil {
+				return err
+			}
+		}
+		return tw.WriteHeader(hdr)
+	}
+	writeFile := func(rel, fpath string, fi os.FileInfo) error {
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+		if key, linked := hardLinkKey(fi); linked {
+			if first, ok := seenLinks[key]; ok {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = first
+				hdr.Size = 0
+				return writeHeader(hdr)
+			}
+			seenLinks[key] = rel
+		}
+		if err := writeHeader(hdr); err != nil {
+			return err
+		}
+		f, err := os.Open(fpath)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, f)
+		f.Close()
+		return err
+	}
+	return filepath.Walk(path, func(fpath string, fi os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		rel, err := filepath.Rel(baseDir, fpath)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		// tar expects path with forward slashes; NFC so names leave a
+		// macOS sender in the composed form everyone else uses
+		rel = norm.NFC.String(filepath.ToSlash(rel))
+		mode := fi.Mode()
+		switch {
+		case mode&os.ModeSymlink != 0:
+			switch symlinks {
+			case SymlinksSkip:
+				fmt.Fprintf(os.Stderr, "warning: skipping symlink %s\n", rel)
+				return nil
+			case SymlinksFollow:
+				resolved, err := os.Stat(fpath)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "warning: skipping broken symlink %s: %v\n", rel, err)
+					return nil
+				}
+				if !resolved.Mode().IsRegular() {
+					fmt.Fprintf(os.Stderr, "warning: skipping symlink %s (target is not a regular file)\n", rel)
+					return nil
+				}
+				return writeFile(rel, fpath, resolved)
+			default: // SymlinksKeep
+				target, err := os.Readlink(fpath)
+				if err != nil {
+					return err
+				}
+				hdr, err := tar.FileInfoHeader(fi, target)
+				if err != nil {
+					return err
+				}
+				hdr.Name = rel
+				return writeHeader(hdr)
+			}
+		case mode&(os.ModeSocket|os.ModeNamedPipe|os.ModeDevice|os.ModeCharDevice) != 0:
+			// These cannot round-trip across platforms (or at all, for
+			// sockets); archiving them would only break extraction.
+			fmt.Fprintf(os.Stderr, "warning: skipping special file %s\n", rel)
+			return nil
+		case mode.IsRegular():
+			return writeFile(rel, fpath, fi)
+		default:
+			hdr, err := tar.FileInfoHeader(fi, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = rel
+			return writeHeader(hdr)
+		}
+	})
+}
+
+// ExtractTarGz extracts archivePath (tar.gz, or the uncompressed tar of a
+// manifest bundle) into the same directory, then removes the archive.
+func ExtractTarGz(archivePath string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// Manifest bundles are plain tar; sniff the gzip magic instead of
+	// trusting the name.
+	var magic [2]byte
+	if _, err := io.ReadFull(f, magic[:]); err != nil {
+		return fmt.Errorf("read archive: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	var src io.Reader = f
+	if magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("not a gzip file: %w", err)
+		}
+		defer gz.Close()
+		src = gz
+	}
+	tr := tar.NewReader(src)
+	destDir := filepath.Dir(archivePath)
+	seen := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// Safe path: no leading slash or ".." escaping. NFC so archives from
+		// macOS senders (decomposed UTF-8) extract under the composed names
+		// everyone else uses.
+		name := filepath.Clean(norm.NFC.String(hdr.Name))
+		if name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if name == manifestEntryName {
+			// Bundle bookkeeping, not content.
+			continue
+		}
+		// Entries differing only by case are distinct files where they were
+		// packed but one file on Windows and (by default) macOS; rename the
+		// latecomer instead of letting it overwrite the first silently.
+		if hdr.Typeflag != tar.TypeDir {
+			if prev, ok := seen[strings.ToLower(name)]; ok && prev != name {
+				renamed := uncollideName(name, func(n string) bool {
+					_, taken := seen[strings.ToLower(n)]
+					return taken
+				})
+				fmt.Fprintf(os.Stderr, "warning: %s differs from %s only by case; extracting as %s\n", name, prev, renamed)
+				name = renamed
+			}
+			seen[strings.ToLower(name)] = name
+		}
+		target := filepath.Join(destDir, name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return fmt.Errorf("mkdir %s: %w", target, err)
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode)&0777)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tr)
+			out.Close()
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			// A link target is attacker-supplied data: refuse targets that
+			// point outside the extraction directory.
+			resolved := filepath.Clean(filepath.Join(filepath.Dir(name), hdr.Linkname))
+			if filepath.IsAbs(hdr.Linkname) || resolved == ".." || strings.HasPrefix(resolved, ".."+string(filepath.Separator)) {
+				fmt.Fprintf(os.Stderr, "warning: skipping symlink %s (target %s outside archive)\n", name, hdr.Linkname)
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			os.Remove(target)
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: symlink %s: %v\n", name, err)
+			}
+		case tar.TypeLink:
+			linked := filepath.Clean(hdr.Linkname)
+			if filepath.IsAbs(linked) || linked == ".." || strings.HasPrefix(linked, ".."+string(filepath.Separator)) {
+				fmt.Fprintf(os.Stderr, "warning: skipping hard link %s (target %s outside archive)\n", name, hdr.Linkname)
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			os.Remove(target)
+			if err := os.Link(filepath.Join(destDir, linked), target); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: hard link %s: %v\n", name, err)
+			}
+		}
+	}
+	f.Close()
+	return os.Remove(archivePath)
+}
+
+// uncollideName inserts " (2)", " (3)"… before the extension of the last path
+// component until taken reports the name free.
+func uncollideName(name string, taken func(string) bool) string {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 2; ; i++ {
+		cand := fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		if !taken(cand) {
+			return cand
+		}
+	}
+}
+
+type probeResult struct {
+	serverID int
+	addr     string
+	speedBps float64
+	ok       bool
+}
+
+func probeServer(addr string, serverID int, fileSize uint64) (speedBps float64, ok bool) {
+	conn, err := net.DialTimeout(protocol.DialNetwork(), addr, probeDialTimeout)
+	if err != nil {
+		return 0, false
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(probeTimeout))
+
+	if err := protocol.WriteMessageType(conn, protocol.MsgTest); err != nil {
+		return 0, false
+	}
+	if err := protocol.WriteTestRequest(conn, fileSize); err != nil {
+		return 0, false
+	}
+
+	var free uint64
+	if err := binary.Read(conn, binary.BigEndian, &free); err != nil {
+		return 0, false
+	}
+	if free < fileSize {
+		return 0, false
+	}
+
+	var payloadLen uint32
+	if err := binary.Read(conn, binary.BigEndian, &payloadLen); err != nil {
+		return 0, false
+	}
+	if payloadLen == 0 || payloadLen > 4*1024*1024 {
+		return 0, false
+	}
+
+	start := time.Now()
+	n, err := io.CopyN(io.Discard, conn, int64(payloadLen))
+	if err != nil || n != int64(payloadLen) {
+		return 0, false
+	}
+	elapsed := time.Since(start).Seconds()
+	if elapsed < 0.0001 {
+		elapsed = 0.0001
+	}
+	return float64(payloadLen) / elapsed, true
+}
+
+func tryServersFromList(fileSize int64) (net.Conn, int, error) {
+	if conn, id, ok := protocol.DialCachedProbeWinner(); ok {
+		return conn, id, nil
+	}
+	addrs, err := protocol.FetchServerList()
+	if err != nil {
+		return nil, 0, fmt.Errorf("fetch server list: %w", err)
+	}
+
+	fileSizeU := uint64(fileSize)
+	if fileSizeU < 0 {
+		fileSizeU = 0
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan probeResult, 10)
+	for id, addr := range addrs {
+		if addr == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(serverID int, a string) {
+			defer wg.Done()
+			speed, ok := probeServer(a, serverID, fileSizeU)
+			results <- probeResult{serverID, a, speed, ok}
+		}(id, addr)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var best probeResult
+	for r := range results {
+		if !r.ok {
+			continue
+		}
+		if r.speedBps > best.speedBps {
+			best = r
+		}
+	}
+
+	if !best.ok {
+		return nil, 0, fmt.Errorf("%w: no server available (none had enough space or all probes failed)", ErrTooLarge)
+	}
+
+	protocol.SaveProbeWinnerCache(best.serverID, best.addr)
+	conn, err := net.DialTimeout(protocol.DialNetwork(), best.addr, protocol.DialTimeout)
+	if err != nil {
+		return nil, 0, err
+	}
+	protocol.SetTCPBuffers(conn)
+	return conn, best.serverID, nil
+}
+
+const benchDurationSec uint16 = 2
+
+// Bench directions. The server's bench handler accepts any phase as the
+// opening request, so a down-only or up-only run simply starts at the
+// matching phase instead of walking through both.
+const (
+	benchDown = "down"
+	benchUp   = "up"
+	benchBoth = "both"
+)
+
+type serverStats struct {
+	id              int
+	addr            string
+	pingMs          float64
+	free            uint64
+	downloadBps     float64
+	uploadBps       float64
+	cryptoSingleBps float64
+	cryptoMultiBps  float64
+	version         string // from the capability frame; "" = legacy server
+	protoLevel      byte
+	ok              bool
+}
+
+// timeLimitReader returns EOF after until; used to read stream for exactly N seconds.
+type timeLimitReader struct {
+	r     io.Reader
+	until time.Time
+}
+
+func (t *timeLimitReader) Read(p []byte) (n int, err error) {
+	if time.Now().After(t.until) {
+		return 0, io.EOF
+	}
+	return t.r.Read(p)
+}
+
+// countWriter counts bytes written (for measuring download throughput on client side).
+type countWriter int64
+
+func (c *countWriter) Write(p []byte) (n int, err error) {
+	*c += countWriter(len(p))
+	return len(p), nil
+}
+
+func runServerBench(addr string, id int, durationSec uint16, direction string) (pingMs float64, free uint64, downloadBps, uploadBps, cryptoSingleBps, cryptoMultiBps float64, err error) {
+	pingStart := time.Now()
+	conn, err := net.DialTimeout(protocol.DialNetwork(), addr, protocol.DialTimeout)
+	if err != nil {
+		return 0, 0, 0, 0, 0, 0, err
+	}
+	defer conn.Close()
+	protocol.SetTCPBuffers(conn)
+	conn.SetDeadline(time.Now().Add(time.Duration(durationSec)*2*time.Second + 15*time.Second))
+
+	bw := bufio.NewWriterSize(conn, 256*1024)
+	r := bufio.NewReaderSize(conn, 256*1024)
+	if err := protocol.WriteMessageType(bw, protocol.MsgBench); err != nil {
+		return 0, 0, 0, 0, 0, 0, err
+	}
+	if direction == benchUp {
+		// No free-space reply to time in the upload-only flow, so the dial
+		// round-trip stands in for ping and free stays 0.
+		pingMs = time.Since(pingStart).Seconds() * 1000
+	} else {
+		if err := protocol.WriteBenchRequest(bw, 0, durationSec); err != nil {
+			return 0, 0, 0, 0, 0, 0, err
+		}
+		if err := bw.Flush(); err != nil {
+			return 0, 0, 0, 0, 0, 0, err
+		}
+		if err := binary.Read(r, binary.BigEndian, &free); err != nil {
+			return 0, 0, 0, 0, 0, 0, err
+		}
+		pingMs = time.Since(pingStart).Seconds() * 1000
+		// The server streams for at least durationSec and at least
+		// protocol.BenchMinBytes, then appends the 8-byte serverTotal with no
+		// marker in between. Reading for a fixed time instead would race the
+		// total into the timed window and desync the phases, so read until
+		// the stream goes quiet (the server sends nothing further until the
+		// next phase request) and take the trailing 8 bytes as the total.
+		until := time.Now().Add(time.Duration(durationSec) * time.Second)
+		hardStop := until.Add(10 * time.Second)
+		var downCount countWriter
+		lastData := time.Now()
+		var tail []byte
+		tmp := make([]byte, 64*1024)
+		for {
+			_ = conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+			n, readErr := r.Read(tmp)
+			if n > 0 {
+				downCount += countWriter(n)
+				lastData = time.Now()
+				tail = append(tail, tmp[:n]...)
+				if len(tail) > 8 {
+					tail = tail[len(tail)-8:]
+				}
+			}
+			if readErr != nil {
+				if ne, ok := readErr.(net.Error); ok && ne.Timeout() {
+					if time.Now().After(hardStop) {
+						return pingMs, free, 0, 0, 0, 0, fmt.Errorf("bench download stream stalled")
+					}
+					if time.Now().After(until) && int64(downCount) >= 8 && time.Since(lastData) > 600*time.Millisecond {
+						break
+					}
+					continue
+				}
+				return pingMs, free, 0, 0, 0, 0, readErr
+			}
+		}
+		_ = conn.SetReadDeadline(time.Time{})
+		serverTotal := binary.BigEndian.Uint64(tail)
+		downCount -= 8 // the total is framing, not payload
+		downElapsed := time.Duration(durationSec) * time.Second
+		if downElapsed > 0 {
+			// Use client-side count (real received bytes); fallback to serverTotal if count is 0
+			if int64(downCount) > 0 {
+				downloadBps = float64(downCount) / downElapsed.Seconds()
+			} else if serverTotal > 0 {
+				downloadBps = float64(serverTotal) / downElapsed.Seconds()
+			}
+		}
+	}
+	if direction == benchDown {
+		return pingMs, free, downloadBps, 0, 0, 0, nil
+	}
+
+	if err := protocol.WriteBenchRequest(bw, 1, durationSec); err != nil {
+		return pingMs, free, downloadBps, 0, 0, 0, nil
+	}
+	if err := bw.Flush(); err != nil {
+		return pingMs, free, downloadBps, 0, 0, 0, nil
+	}
+	until := time.Now().Add(time.Duration(durationSec) * time.Second)
+	// Fresh pseudo-random bytes per write: repeating one buffer lets
+	// compressing middleboxes inflate the result.
+	payload := protocol.NewBenchStream()
+	randBuf := make([]byte, 64*1024)
+	var upTotal int64
+	for time.Now().Before(until) || upTotal < protocol.BenchMinBytes {
+		io.ReadFull(payload, randBuf)
+		n, _ := bw.Write(randBuf)
+		if n > 0 {
+			upTotal += int64(n)
+		}
+		if err := bw.Flush(); err != nil {
+			break
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return pingMs, free, downloadBps, 0, 0, 0, nil
+	}
+	if err := binary.Write(conn, binary.BigEndian, uint64(upTotal)); err != nil {
+		return pingMs, free, downloadBps, 0, 0, 0, nil
+	}
+	var ack uint64
+	if err := binary.Read(r, binary.BigEndian, &ack); err != nil {
+		return pingMs, free, downloadBps, 0, 0, 0, nil
+	}
+	sec := (time.Duration(durationSec) * time.Second).Seconds()
+	if sec > 0 {
+		// Use our sent count; if 0, use server ack (bytes server received)
+		if upTotal > 0 {
+			uploadBps = float64(upTotal) / sec
+		} else if ack > 0 {
+			uploadBps = float64(ack) / sec
+		}
+	}
+
+	// Crypto phase: newer servers report local AES-GCM throughput (single-core
+	// and all-core). Older servers close the connection instead; leave N/A.
+	if err := protocol.WriteBenchRequest(bw, 2, durationSec); err != nil {
+		return pingMs, free, downloadBps, uploadBps, 0, 0, nil
+	}
+	if err := bw.Flush(); err != nil {
+		return pingMs, free, downloadBps, uploadBps, 0, 0, nil
+	}
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	var cryptoSingle, cryptoMulti uint64
+	if err := binary.Read(r, binary.BigEndian, &cryptoSingle); err != nil {
+		return pingMs, free, downloadBps, uploadBps, 0, 0, nil
+	}
+	if err := binary.Read(r, binary.BigEndian, &cryptoMulti); err != nil {
+		return pingMs, free, downloadBps, uploadBps, 0, 0, nil
+	}
+	return pingMs, free, downloadBps, uploadBps, float64(cryptoSingle), float64(cryptoMulti), nil
+}
+
+// getServerFreeSpace returns free disk space (bytes) for one server, or 0 on failure.
+func getServerFreeSpace(addr string) uint64 {
+	conn, err := net.DialTimeout(protocol.DialNetwork(), addr, 2*time.Second)
+	if err != nil {
+		return 0
+	}
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	defer conn.Close()
+	if protocol.WriteMessageType(conn, protocol.MsgTest) != nil || protocol.WriteTestRequest(conn, 0) != nil {
+		return 0
+	}
+	var free uint64
+	if binary.Read(conn, binary.BigEndian, &free) != nil {
+		return 0
+	}
+	return free
+}
+
+// fetchServerCaps asks addr for its capability bitmap, protocol level and
+// version via a MsgTest probe. ok is false for unreachable or legacy
+// servers, whose replies stop at the probe payload; callers treat that as
+// "no capabilities known".
+func fetchServerCaps(addr string) (caps uint64, chunkSize uint32, level byte, version string, ok bool) {
+	conn, err := net.DialTimeout(protocol.DialNetwork(), addr, 2*time.Second)
+	if err != nil {
+		return 0, 0, 0, "", false
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(8 * time.Second))
+	if protocol.WriteMessageType(conn, protocol.MsgTest) != nil || protocol.WriteTestRequest(conn, 0) != nil {
+		return 0, 0, 0, "", false
+	}
+	var free uint64
+	if binary.Read(conn, binary.BigEndian, &free) != nil {
+		return 0, 0, 0, "", false
+	}
+	var payloadLen uint32
+	if binary.Read(conn, binary.BigEndian, &payloadLen) != nil || payloadLen > 4*1024*1024 {
+		return 0, 0, 0, "", false
+	}
+	if _, err := io.CopyN(io.Discard, conn, int64(payloadLen)); err != nil {
+		return 0, 0, 0, "", false
+	}
+	caps, chunkSize, level, version, err = protocol.ReadServerCaps(conn)
+	if err != nil {
+		return 0, 0, 0, "", false
+	}
+	return caps, chunkSize, level, version, true
+}
+
+func RunClientServers() error {
+	addrs, err := protocol.FetchServerList()
+	if err != nil {
+		return fmt.Errorf("fetch server list: %w", err)
+	}
+	var servers []struct {
+		id   int
+		addr string
+	}
+	for id, addr := range addrs {
+		if addr != "" {
+			servers = append(servers, struct {
+				id   int
+				addr string
+			}{id, addr})
+		}
+	}
+	if len(servers) == 0 {
+		fmt.Println("No servers in list.")
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Testing each server (2s download, 2s upload of random data, AES-GCM crypto speed)...\n")
+	fmt.Fprintln(os.Stderr, "(N/A = server unreachable or older version without benchmark – update server and try again)")
+	var results []serverStats
+	for _, srv := range servers {
+		fmt.Fprintf(os.Stderr, "  Server %d (%s)...\n", srv.id, srv.addr)
+		_, _, level, version, _ := fetchServerCaps(srv.addr)
+		pingMs, free, downBps, upBps, cryptoSingle, cryptoMulti, err := runServerBench(srv.addr, srv.id, benchDurationSec, benchBoth)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "    %s\n", Red(fmt.Sprintf("error: %v", err)))
+			results = append(results, serverStats{id: srv.id, addr: srv.addr, version: version, protoLevel: level, ok: false})
+			continue
+		}
+		results = append(results, serverStats{
+			id: srv.id, addr: srv.addr, pingMs: pingMs, free: free,
+			downloadBps: downBps, uploadBps: upBps,
+			cryptoSingleBps: cryptoSingle, cryptoMultiBps: cryptoMulti,
+			version: version, protoLevel: level, ok: true,
+		})
+	}
+	const gb = 1024 * 1024 * 1024
+	const mb = 1024 * 1024
+	fmt.Println()
+	fmt.Printf("%-4s %-24s %-12s %10s %12s %14s %14s %14s %14s\n", "ID", "Address", "Version", "Ping", "Free", "Download", "Upload", "Crypto 1c", "Crypto all")
+	fmt.Printf("%-4s %-24s %-12s %10s %12s %14s %14s %14s %14s\n", "--", "-------", "-------", "----", "----", "--------", "------", "---------", "----------")
+	for _, s := range results {
+		pingStr := "N/A"
+		freeStr := "N/A"
+		downStr := "N/A"
+		upStr := "N/A"
+		crypto1Str := "N/A"
+		cryptoNStr := "N/A"
+		if s.ok {
+			pingStr = fmt.Sprintf("%.0f ms", s.pingMs)
+			freeStr = fmt.Sprintf("%.2f GB", float64(s.free)/float64(gb))
+			downStr = fmt.Sprintf("%.2f MB/s", s.downloadBps/float64(mb))
+			upStr = fmt.Sprintf("%.2f MB/s", s.uploadBps/float64(mb))
+			if s.cryptoSingleBps > 0 {
+				crypto1Str = fmt.Sprintf("%.0f MB/s", s.cryptoSingleBps/float64(mb))
+			}
+			if s.cryptoMultiBps > 0 {
+				cryptoNStr = fmt.Sprintf("%.0f MB/s", s.cryptoMultiBps/float64(mb))
+			}
+		}
+		// Pre-capability servers answer the probe but not the version
+		// frame; show them as "old" rather than pretend we know.
+		verStr := "old"
+		if s.version != "" {
+			verStr = fmt.Sprintf("%s (p%d)", s.version, s.protoLevel)
+		}
+		row := fmt.Sprintf("%-4d %-24s %-12s %10s %12s %14s %14s %14s %14s", s.id, s.addr, verStr, pingStr, freeStr, downStr, upStr, crypto1Str, cryptoNStr)
+		if s.ok {
+			fmt.Println(Green(row))
+		} else {
+			fmt.Println(Yellow(row))
+		}
+	}
+	appendBenchHistory(results)
+	return nil
+}
+
+// RunClientBench runs the servers benchmark against one explicitly chosen
+// address instead of the public list, for operators validating a node before
+// publishing it. direction is "down", "up" or "both"; durationSec applies to
+// each measured direction.
+func RunClientBench(addr, direction string, durationSec int) error {
+	switch direction {
+	case benchDown, benchUp, benchBoth:
+	default:
+		return fmt.Errorf("direction must be down, up or both, got %q", direction)
+	}
+	if durationSec < 1 || durationSec > 30 {
+		return fmt.Errorf("duration must be 1–30 seconds")
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("address must be host:port: %w", err)
+	}
+	if caps, _, _, _, ok := fetchServerCaps(addr); ok && caps&protocol.CapBench == 0 {
+		return fmt.Errorf("server disables benchmarks (-nobench)")
+	}
+	fmt.Fprintf(os.Stderr, "Benchmarking %s (%s, %ds per direction, random data)...\n", addr, direction, durationSec)
+	pingMs, free, downBps, upBps, cryptoSingle, cryptoMulti, err := runServerBench(addr, -1, uint16(durationSec), direction)
+	if err != nil {
+		return err
+	}
+	const gb = 1024 * 1024 * 1024
+	const mb = 1024 * 1024
+	fmt.Printf("Ping:       %.0f ms\n", pingMs)
+	if direction != benchUp {
+		fmt.Printf("Free:       %.2f GB\n", float64(free)/float64(gb))
+		fmt.Printf("Download:   %.2f MB/s\n", downBps/float64(mb))
+	}
+	if direction != benchDown {
+		fmt.Printf("Upload:     %.2f MB/s\n", upBps/float64(mb))
+		if cryptoSingle > 0 {
+			fmt.Printf("Crypto 1c:  %.0f MB/s\n", cryptoSingle/float64(mb))
+		}
+		if cryptoMulti > 0 {
+			fmt.Printf("Crypto all: %.0f MB/s\n", cryptoMulti/float64(mb))
+		}
+	}
+	return nil
+}
+
+// GetTotalNetworkStorage returns sum of free disk space (bytes) across all servers from the list. Timeout applies to the whole operation.
+func GetTotalNetworkStorage(timeout time.Duration) uint64 {
+	addrs, err := protocol.FetchServerList()
+	if err != nil {
+		return 0
+	}
+	var total uint64
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	go func() {
+		for _, addr := range addrs {
+			if addr == "" {
+				continue
+			}
+			wg.Add(1)
+			go func(a string) {
+				defer wg.Done()
+				free := getServerFreeSpace(a)
+				if free > 0 {
+					mu.Lock()
+					total += free
+					mu.Unlock()
+				}
+			}(addr)
+		}
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return total
+	case <-time.After(timeout):
+		return total
+	}
+}
+
+func dialWithFallback(addr string) (net.Conn, error) {
+	conn, err := protocol.DialServer(addr, protocol.DialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", addr, err)
+	}
+	return conn, nil
+}
+
+func RunClientSend(filePath string, addr string, serverIDHint int, storageDurationSec uint32, password string, signKeyPath string, recipientPubPath string, notBeforeSec uint32, useBlake3 bool) error {
+	if notBeforeSec > 0 && password != "" {
+		return fmt.Errorf("-notbefore cannot be combined with -password")
+	}
+	var signKey ed25519.PrivateKey
+	if signKeyPath != "" {
+		var err error
+		signKey, err = protocol.LoadSigningKey(signKeyPath)
+		if err != nil {
+			return err
+		}
+	}
+	var recipientPub *ecdh.PublicKey
+	if recipientPubPath != "" {
+		var err error
+		recipientPub, err = protocol.LoadRecipientPub(recipientPubPath)
+		if err != nil {
+			return err
+		}
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("open file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat file: %w", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("path is a directory, not a file")
+	}
+	size := info.Size()
+	if storageDurationSec > 0 && size > protocol.LongTermMaxBytes {
+		return fmt.Errorf("%w: long-term uploads limited to %d MB", ErrTooLarge, protocol.LongTermMaxBytes/(1024*1024))
+	}
+
+	// Multi-GB files are mapped instead of read through a buffer: chunk
+	// slices come straight out of the mapping and the OS handles readahead.
+	// Any mmap failure (or a 32-bit/unsupported platform) falls back to
+	// plain reads.
+	var mapped []byte
+	if size >= mmapSendThreshold {
+		if m, release, err := mmapFile(f, size); err == nil {
+			mapped = m
+			defer release()
+			fmt.Fprintln(os.Stderr, "info: using memory-mapped reads")
+		}
+	}
+	var chunkBuf []byte
+	if mapped == nil {
+		chunkBuf = make([]byte, protocol.UploadChunkSize)
+	}
+	var conn net.Conn
+	var serverID int
+	if addr != "" {
+		var err error
+		conn, err = dialWithFallback(addr)
+		if err != nil {
+			return err
+		}
+		serverID = 0
+	} else if serverIDHint >= 0 && serverIDHint <= 9 {
+		addrs, fetchErr := protocol.FetchServerList()
+		if fetchErr != nil {
+			return fmt.Errorf("fetch server list: %w", fetchErr)
+		}
+		if addrs[serverIDHint] == "" {
+			return fmt.Errorf("server %d not in list", serverIDHint)
+		}
+		var err error
+		conn, err = protocol.DialServer(addrs[serverIDHint], protocol.DialTimeout)
+		if err != nil {
+			return err
+		}
+		serverID = serverIDHint
+	} else {
+		fmt.Fprintln(os.Stderr, "info: probing servers (disk space + bandwidth, max 1s)...")
+		var err error
+		conn, serverID, err = tryServersFromList(size)
+		if err != nil {
+			return err
+		}
+	}
+	defer conn.Close()
+	registerTransferConn(conn)
+	code := protocol.GenerateCodeWithServerID(serverID)
+	keyVersion := protocol.CurrentKeyVersion
+	var keyMaterial, key []byte
+	if recipientPub != nil {
+		keyVersion = protocol.KeyVersionX25519
+		var err error
+		key, keyMaterial, err = protocol.SealFileKey(recipientPub)
+		if err != nil {
+			return err
+		}
+	} else {
+		var err error
+		keyMaterial, err = protocol.NewKeySalt()
+		if err != nil {
+			return fmt.Errorf("key salt: %w", err)
+		}
+		key, err = protocol.DeriveTransferKey(code, keyVersion, keyMaterial)
+		if err != nil {
+			return fmt.Errorf("derive key: %w", err)
+		}
+	}
+	numChunks := uint32((size + int64(protocol.UploadChunkSize) - 1) / int64(protocol.UploadChunkSize))
+
+	// The integrity tag is keyed with the transfer key, so the hashing pass
+	// happens after the code (and key) are fixed. The same pass produces the
+	// per-chunk digests on versions that carry them; its chunk boundaries
+	// mirror getChunk below.
+	hashAlgo := protocol.HashSHA256
+	if useBlake3 && protocol.HeaderHasMetaFrame(keyVersion) {
+		// The metadata frame is what tells the receiver which algorithm
+		// to verify with; without it the sender must stay on SHA-256.
+		hashAlgo = protocol.HashBlake3
+	}
+	hasher := protocol.NewIntegrityHasherAlgo(key, keyVersion, hashAlgo)
+	var chunkSums []byte
+	var plaintextChecksum []byte
+	withSums := protocol.HeaderHasChunkSums(keyVersion)
+	if mapped != nil {
+		if withSums {
+			for off, idx := int64(0), uint64(0); off < size; idx++ {
+				end := off + int64(protocol.UploadChunkSize)
+				if end > size {
+					end = size
+				}
+				chunkSums = append(chunkSums, protocol.ChunkSum(key, idx, mapped[off:end])...)
+				off = end
+			}
+		}
+		// One pass over the whole mapping; with BLAKE3 this is where the
+		// hash tree fans out across cores.
+		plaintextChecksum = protocol.IntegritySumParallel(key, keyVersion, hashAlgo, mapped)
+	} else {
+		var totalRead int64
+		var idx uint64
+		for totalRead < size {
+			n, err := f.Read(chunkBuf)
+			if n > 0 {
+				hasher.Write(chunkBuf[:n])
+				if withSums {
+					chunkSums = append(chunkSums, protocol.ChunkSum(key, idx, chunkBuf[:n])...)
+					idx++
+				}
+				totalRead += int64(n)
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("read file: %w", err)
+			}
+		}
+		plaintextChecksum = hasher.Sum(nil)
+	}
+	var signerPub, signature []byte
+	if signKey != nil {
+		signerPub = signKey.Public().(ed25519.PublicKey)
+		signature = ed25519.Sign(signKey, plaintextChecksum)
+	}
+
+	if mapped == nil {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("seek file: %w", err)
+		}
+	}
+
+	bw := bufio.NewWriterSize(conn, protocol.BufSize)
+	msgType := byte(protocol.MsgUpload)
+	if password != "" {
+		msgType = protocol.MsgUploadPw
+	}
+	if notBeforeSec > 0 {
+		msgType = protocol.MsgUploadTimed
+	}
+	if err := protocol.WriteMessageTypeAuth(bw, msgType); err != nil {
+		return err
+	}
+	if password != "" {
+		if err := protocol.WritePasswordFrame(bw, password); err != nil {
+			return err
+		}
+	}
+	if notBeforeSec > 0 {
+		if err := binary.Write(bw, binary.BigEndian, notBeforeSec); err != nil {
+			return err
+		}
+	}
+	baseName := filepath.Base(filePath)
+	start := time.Now()
+	progress := func(sent, total int64) {
+		updateStatus(sent, total)
+		elapsed := time.Since(start).Seconds()
+		if elapsed < 0.001 {
+			return
+		}
+		speed := float64(sent) / elapsed
+		remaining := total - sent
+		fmt.Fprintf(os.Stderr, "\r  speed: %s/s  |  sent: %s  |  left: %s  ", protocol.FormatBytes(speed), protocol.FormatBytes(float64(sent)), protocol.FormatBytes(float64(remaining)))
+	}
+	getChunk := func() ([]byte, error) {
+		waitIfPaused()
+		advanceStatusChunk()
+		n, err := f.Read(chunkBuf)
+		if n > 0 {
+			return chunkBuf[:n], nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	if mapped != nil {
+		var off int64
+		getChunk = func() ([]byte, error) {
+			waitIfPaused()
+			advanceStatusChunk()
+			if off >= size {
+				return nil, io.EOF
+			}
+			end := off + int64(protocol.UploadChunkSize)
+			if end > size {
+				end = size
+			}
+			chunk := mapped[off:end]
+			off = end
+			return chunk, nil
+		}
+	}
+	restoreKeys := StartTransferKeys()
+	defer restoreKeys()
+	beginStatus("upload", conn.RemoteAddr().String(), size, numChunks)
+	fmt.Fprintln(os.Stderr, "info: encrypting and sending in chunks...")
+	meta := protocol.NewFileMeta(info.ModTime(), uint32(info.Mode().Perm()))
+	meta.HashAlgo = hashAlgo
+	if err := protocol.WriteEncryptedUploadChunked(bw, code, baseName, size, storageDurationSec, numChunks, plaintextChecksum, chunkSums, keyVersion, keyMaterial, key, signerPub, signature, &meta, getChunk, progress); err != nil {
+		return fmt.Errorf("send: %w", err)
+	}
+	fmt.Fprintln(os.Stderr)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+
+	fmt.Fprintln(os.Stderr, "info: waiting for server...")
+	status, err := protocol.ReadStatus(conn)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+
+	switch status {
+	case protocol.StatusOK:
+		fmt.Printf("File sent (encrypted). Your code: %s (%s)\n", Green(code), formatValidDuration(readEchoedTTL(conn, storageDurationSec)))
+		if token := readOwnerToken(conn); token != nil {
+			fmt.Printf("Owner token (for tcpraw append): %x\n", token)
+		}
+		if recipientPub != nil {
+			fmt.Fprintln(os.Stderr, "Encrypted to recipient – only the matching identity key can decrypt.")
+		}
+		return nil
+	case protocol.StatusPolicyRejected:
+		return fmt.Errorf("server rejected this file by policy (filename or content type)")
+	case protocol.StatusError:
+		return fmt.Errorf("server error")
+	default:
+		return fmt.Errorf("unknown status: %d", status)
+	}
+}
+
+func RunClientSecureSend(filePath string, addr string, serverIDHint int, storageDurationSec uint32) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("read file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat file: %w", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("path is a directory")
+	}
+	size := info.Size()
+	if size == 0 {
+		return fmt.Errorf("file is empty")
+	}
+	if storageDurationSec > 0 && size > protocol.LongTermMaxBytes {
+		return fmt.Errorf("%w: long-term uploads limited to %d MB", ErrTooLarge, protocol.LongTermMaxBytes/(1024*1024))
+	}
+
+	key := make([]byte, protocol.SecureKeySize)
+	if _, err := io.ReadFull(crand.Reader, key); err != nil {
+		return fmt.Errorf("generate key: %w", err)
+	}
+
+	var conn net.Conn
+	if addr != "" {
+		conn, err = dialWithFallback(addr)
+	} else if serverIDHint >= 0 && serverIDHint <= 9 {
+		addrs, fetchErr := protocol.FetchServerList()
+		if fetchErr != nil {
+			return fmt.Errorf("fetch server list: %w", fetchErr)
+		}
+		if addrs[serverIDHint] == "" {
+			return fmt.Errorf("server %d not in list", serverIDHint)
+		}
+		conn, err = protocol.DialServer(addrs[serverIDHint], protocol.DialTimeout)
+		if err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintln(os.Stderr, "info: probing servers (disk space + bandwidth, max 1s)...")
+		conn, _, err = tryServersFromList(size)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	registerTransferConn(conn)
+
+	bw := bufio.NewWriterSize(conn, protocol.BufSize)
+	if err = protocol.WriteMessageTypeAuth(bw, protocol.MsgSecureUpload); err != nil {
+		return err
+	}
+	baseName := filepath.Base(filePath)
+
+	if size <= maxSecureLoadRAM {
+		plaintext, err := io.ReadAll(f)
+		if err != nil {
+			return fmt.Errorf("read file: %w", err)
+		}
+		plaintextChecksum := sha256.Sum256(plaintext)
+		nonce, sealed, err := protocol.EncryptWithKey(key, plaintext)
+		if err != nil {
+			return fmt.Errorf("encrypt: %w", err)
+		}
+		start := time.Now()
+		progress := func(sent, total int64) {
+			updateStatus(sent, total)
+			elapsed := time.Since(start).Seconds()
+			if elapsed < 0.001 {
+				return
+			}
+			speed := float64(sent) / elapsed
+			remaining := total - sent
+			fmt.Fprintf(os.Stderr, "\r  speed: %s/s  |  sent: %s  |  left: %s  ", protocol.FormatBytes(speed), protocol.FormatBytes(float64(sent)), protocol.FormatBytes(float64(remaining)))
+		}
+		fmt.Fprintln(os.Stderr, "info: sending encrypted file...")
+		if _, err := bw.Write([]byte{0}); err != nil {
+			return err
+		}
+		if err := binary.Write(bw, binary.BigEndian, storageDurationSec); err != nil {
+			return fmt.Errorf("write storage duration: %w", err)
+		}
+		if err := protocol.WriteEncryptedBlob(bw, baseName, plaintextChecksum[:], nonce, sealed, progress); err != nil {
+			return fmt.Errorf("send: %w", err)
+		}
+	} else {
+		fmt.Fprintln(os.Stderr, "info: sending encrypted file in chunks (streaming, no full load)...")
+		if _, err := bw.Write([]byte{1}); err != nil {
+			return err
+		}
+		hasher := sha256.New()
+		chunkBuf := make([]byte, protocol.UploadChunkSize)
+		var totalRead int64
+		for totalRead < size {
+			n, err := f.Read(chunkBuf)
+			if n > 0 {
+				hasher.Write(chunkBuf[:n])
+				totalRead += int64(n)
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("read file: %w", err)
+			}
+		}
+		plaintextChecksum := hasher.Sum(nil)
+		numChunks := uint32((size + int64(protocol.UploadChunkSize) - 1) / int64(protocol.UploadChunkSize))
+		if err := protocol.WriteSecureUploadChunkedHeader(bw, baseName, size, storageDurationSec, numChunks, plaintextChecksum); err != nil {
+			return fmt.Errorf("send header: %w", err)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("seek file: %w", err)
+		}
+		start := time.Now()
+		var sent int64
+		var chunkIndex uint64
+		for sent < size {
+			n, err := f.Read(chunkBuf)
+			if n > 0 {
+				nonce, sealed, encErr := protocol.EncryptChunkAt(key, chunkIndex, chunkBuf[:n])
+				if encErr != nil {
+					return fmt.Errorf("encrypt chunk: %w", encErr)
+				}
+				if err := protocol.WriteChunk(bw, nonce, sealed); err != nil {
+					return fmt.Errorf("write chunk: %w", err)
+				}
+				chunkIndex++
+				sent += int64(n)
+				elapsed := time.Since(start).Seconds()
+				if elapsed >= 0.001 {
+					speed := float64(sent) / elapsed
+					remaining := size - sent
+					fmt.Fprintf(os.Stderr, "\r  speed: %s/s  |  sent: %s  |  left: %s  ", protocol.FormatBytes(speed), protocol.FormatBytes(float64(sent)), protocol.FormatBytes(float64(remaining)))
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("read file: %w", err)
+			}
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+
+	fmt.Fprintln(os.Stderr, "info: waiting for server...")
+	status, code, err := protocol.ReadCodeResponse(conn)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if status == protocol.StatusPolicyRejected {
+		return fmt.Errorf("server rejected this file by policy (filename or content type)")
+	}
+	if status != protocol.StatusOK {
+		return fmt.Errorf("server error")
+	}
+
+	fmt.Fprintln(os.Stderr)
+	fmt.Printf("Code: %s (%s)\n", Green(code), formatValidDuration(readEchoedTTL(conn, storageDurationSec)))
+	fmt.Printf("Key (save it – needed to download): %s\n", hex.EncodeToString(key))
+	if mnemonic, err := mnemonicFromKey(key); err == nil {
+		fmt.Printf("Key words (same key, easier to dictate): %s\n", mnemonic)
+	}
+	fmt.Fprintln(os.Stderr, "Without the key the file cannot be decrypted.")
+	saveSecureKeyForCode(code, key)
+	return nil
+}
+
+// openDownload dials addr and sends the download request for code (with the
+// password frame when password is set), returning the connection, reader and
+// the server's status byte.
+func openDownload(addr, code, password string) (net.Conn, *bufio.Reader, byte, error) {
+	conn, err := dialWithFallback(addr)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	bw := bufio.NewWriterSize(conn, protocol.BufSize)
+	msgType := byte(protocol.MsgDownload)
+	if password != "" {
+		msgType = protocol.MsgDownloadPw
+	}
+	if err := protocol.WriteMessageTypeAuth(bw, msgType); err != nil {
+		conn.Close()
+		return nil, nil, 0, err
+	}
+	if err := protocol.WriteDownloadRequest(bw, code); err != nil {
+		conn.Close()
+		return nil, nil, 0, err
+	}
+	if password != "" {
+		if err := protocol.WritePasswordFrame(bw, password); err != nil {
+			conn.Close()
+			return nil, nil, 0, err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, 0, err
+	}
+	br := bufio.NewReaderSize(conn, protocol.BufSize)
+	status, err := protocol.ReadStatus(br)
+	if err != nil {
+		conn.Close()
+		return nil, nil, 0, fmt.Errorf("read response: %w", err)
+	}
+	return conn, br, status, nil
+}
+
+func RunClientGet(code, outputPath string, unzip bool, password string, verifySigner string, identity string, usePake bool, parallel int) error {
+	if !protocol.ValidCode(code) {
+		return fmt.Errorf("code must be 6 digits")
+	}
+	serverID := int(code[0] - '0')
+	if serverID < 0 || serverID > 9 {
+		return fmt.Errorf("invalid code: first digit must be 0–9 (server id)")
+	}
+	addrs, err := protocol.FetchServerList()
+	if err != nil {
+		return fmt.Errorf("fetch server list: %w", err)
+	}
+	if addrs[serverID] == "" {
+		return fmt.Errorf("server %d not in list", serverID)
+	}
+	addr := addrs[serverID]
+
+	if parallel > 1 && password == "" && !usePake {
+		if handled, err := tryParallelGet(addr, code, outputPath, unzip, verifySigner, identity, parallel); handled {
+			return err
+		}
+		// Not a chunked range-capable download; fall through to one stream.
+	}
+
+	fmt.Fprintln(os.Stderr, "info: waiting for server response...")
+	wireCode := code
+	var conn net.Conn
+	var br *bufio.Reader
+	var status byte
+	if usePake {
+		conn, br, status, err = openDownloadPake(addr, code)
+	} else {
+		conn, br, status, err = openDownload(addr, code, password)
+	}
+	if err != nil {
+		return err
+	}
+	if status == protocol.StatusPasswordRequired && usePake {
+		conn.Close()
+		return fmt.Errorf("password-protected uploads cannot be fetched in -pake mode")
+	}
+	if status == protocol.StatusRedirect {
+		newCode, rerr := protocol.ReadDownloadRequest(br)
+		conn.Close()
+		if rerr != nil {
+			return fmt.Errorf("read redirect: %w", rerr)
+		}
+		if usePake {
+			return fmt.Errorf("code %s has moved to another server; fetch it without -pake", code)
+		}
+		newID := int(newCode[0] - '0')
+		if addrs[newID] == "" {
+			return fmt.Errorf("code moved to server %d, which is not in the list", newID)
+		}
+		addr = addrs[newID]
+		fmt.Fprintf(os.Stderr, "info: code %s has moved to server %d; following redirect\n", code, newID)
+		// The sealed bytes moved unchanged, so decryption still uses the
+		// code the sender shared; the new code is only where to fetch from.
+		wireCode = newCode
+		conn, br, status, err = openDownload(addr, wireCode, password)
+		if err != nil {
+			return err
+		}
+	}
+	if status == protocol.StatusEmbargoed {
+		var remaining uint32
+		err := binary.Read(br, binary.BigEndian, &remaining)
+		conn.Close()
+		if err != nil {
+			return fmt.Errorf("read embargo: %w", err)
+		}
+		return fmt.Errorf("code %s is a timed release: available in %s", code, (time.Duration(remaining) * time.Second).Round(time.Second))
+	}
+	if status == protocol.StatusPasswordRequired {
+		conn.Close()
+		if password == "" {
+			fmt.Fprint(os.Stderr, "Enter download password: ")
+			if _, err := fmt.Scanln(&password); err != nil {
+				return fmt.Errorf("read password: %w", err)
+			}
+			password = strings.TrimSpace(password)
+		}
+		conn, br, status, err = openDownload(addr, wireCode, password)
+		if err != nil {
+			return err
+		}
+	}
+	defer conn.Close()
+	registerTransferConn(conn)
+
+	if status == protocol.StatusNotFound {
+		if password != "" {
+			return fmt.Errorf("%w (or wrong password)", ErrNotFound)
+		}
+		return fmt.Errorf("%w (data kept 1 hour)", ErrNotFound)
+	}
+	if status != protocol.StatusOK {
+		return fmt.Errorf("server error (status %d)", status)
+	}
+
+	formatByte := make([]byte, 1)
+	if _, err := io.ReadFull(br, formatByte); err != nil {
+		return fmt.Errorf("read format: %w", err)
+	}
+	format := formatByte[0]
+	keyVersion := protocol.KeyVersionSHA256
+	var kdfSalt []byte
+	var signerPub, signature []byte
+	var fileMeta protocol.FileMeta
+	if format == protocol.FormatPlainV || format == protocol.FormatChunkedV {
+		verBuf := make([]byte, 1)
+		if _, err := io.ReadFull(br, verBuf); err != nil {
+			return fmt.Errorf("read key version: %w", err)
+		}
+		keyVersion = verBuf[0]
+		if size := protocol.HeaderSaltSize(keyVersion); size > 0 {
+			kdfSalt = make([]byte, size)
+			if _, err := io.ReadFull(br, kdfSalt); err != nil {
+				return fmt.Errorf("read key salt: %w", err)
+			}
+		}
+		if protocol.HeaderHasSignFrame(keyVersion) {
+			signerPub, signature, err = protocol.ReadSignatureFrame(br)
+			if err != nil {
+				return fmt.Errorf("read signer frame: %w", err)
+			}
+		}
+		if protocol.HeaderHasMetaFrame(keyVersion) {
+			fileMeta, err = protocol.ReadMetaFrame(br)
+			if err != nil {
+				return fmt.Errorf("read metadata frame: %w", err)
+			}
+		}
+		if format == protocol.FormatPlainV {
+			format = protocol.FormatPlain
+		} else {
+			format = protocol.FormatChunked
+		}
+	}
+
+	start := time.Now()
+	progress := func(downloaded, total int64) {
+		updateStatus(downloaded, total)
+		elapsed := time.Since(start).Seconds()
+		if elapsed < 0.001 {
+			return
+		}
+		speed := float64(downloaded) / elapsed
+		remaining := total - downloaded
+		fmt.Fprintf(os.Stderr, "\r  speed: %s/s  |  downloaded: %s  |  left: %s  ", protocol.FormatBytes(speed), protocol.FormatBytes(float64(downloaded)), protocol.FormatBytes(float64(remaining)))
+	}
+
+	if format == protocol.FormatPlain {
+		name, plaintextChecksum, nonce, sealed, err := protocol.ReadEncryptedBlob(br, progress)
+		if err != nil {
+			return fmt.Errorf("read encrypted blob: %w", err)
+		}
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "info: decrypting with your code...")
+		key, err := protocol.ResolveTransferKey(code, keyVersion, kdfSalt, identity)
+		if err != nil {
+			return fmt.Errorf("derive key: %w", err)
+		}
+		plaintext, err := protocol.DecryptWithKey(key, nonce, sealed)
+		if err != nil {
+			return fmt.Errorf("decrypt: %w", err)
+		}
+		tagHasher := protocol.NewIntegrityHasher(key, keyVersion)
+		tagHasher.Write(plaintext)
+		if !protocol.ChecksumEqual(tagHasher.Sum(nil), plaintextChecksum) {
+			return fmt.Errorf("%w – wrong code or corrupted data", ErrChecksumMismatch)
+		}
+		if err := protocol.VerifyUploadSignature(signerPub, signature, plaintextChecksum, verifySigner); err != nil {
+			return err
+		}
+		savePath := outputPath
+		if savePath == "" {
+			savePath = protocol.SanitizeFilename(name)
+		}
+		if err := os.WriteFile(savePath, plaintext, 0644); err != nil {
+			return fmt.Errorf("write file %s: %w", savePath, err)
+		}
+		if err := fileMeta.Restore(savePath); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: restore file metadata: %v\n", err)
+		}
+		clearTransferPartial()
+		fmt.Printf("Downloaded: %s\n", Green(savePath))
+		if unzip {
+			if err := ExtractTarGz(savePath); err != nil {
+				return fmt.Errorf("unzip: %w", err)
+			}
+			fmt.Fprintln(os.Stderr, "Extracted archive.")
+		}
+		return nil
+	}
+
+	if format == protocol.FormatSecure {
+		name, plaintextChecksum, nonce, sealed, err := protocol.ReadEncryptedBlob(br, progress)
+		if err != nil {
+			return fmt.Errorf("read encrypted blob: %w", err)
+		}
+		fmt.Fprintln(os.Stderr)
+		key, err := obtainSecureKey(code)
+		if err != nil {
+			return err
+		}
+		plaintext, err := protocol.DecryptWithKey(key, nonce, sealed)
+		if err != nil {
+			return fmt.Errorf("decrypt: %w", err)
+		}
+		sum := sha256.Sum256(plaintext)
+		if !protocol.ChecksumEqual(sum[:], plaintextChecksum) {
+			return fmt.Errorf("%w – wrong key or corrupted data", ErrChecksumMismatch)
+		}
+		if err := protocol.VerifyUploadSignature(signerPub, signature, plaintextChecksum, verifySigner); err != nil {
+			return err
+		}
+		savePath := outputPath
+		if savePath == "" {
+			savePath = protocol.SanitizeFilename(name)
+		}
+		if err := os.WriteFile(savePath, plaintext, 0644); err != nil {
+			return fmt.Errorf("write file %s: %w", savePath, err)
+		}
+		clearTransferPartial()
+		fmt.Printf("Downloaded: %s\n", Green(savePath))
+		if unzip {
+			if err := ExtractTarGz(savePath); err != nil {
+				return fmt.Errorf("unzip: %w", err)
+			}
+			fmt.Fprintln(os.Stderr, "Extracted archive.")
+		}
+		return nil
+	}
+
+	if format == protocol.FormatSecureChunked {
+		name, totalPlainLen, numChunks, plaintextChecksum, err := protocol.ReadEncryptedBlobChunkedHeader(br)
+		if err != nil {
+			return fmt.Errorf("read blob header: %w", err)
+		}
+		fmt.Fprintln(os.Stderr)
+		key, err := obtainSecureKey(code)
+		if err != nil {
+			return err
+		}
+		savePath := outputPath
+		if savePath == "" {
+			savePath = protocol.SanitizeFilename(name)
+		}
+		out, err := os.Create(savePath)
+		if err != nil {
+			return fmt.Errorf("create file %s: %w", savePath, err)
+		}
+		defer out.Close()
+		registerTransferPartial(savePath, "run 'tcpraw get "+code+"' again to restart the download")
+		restoreKeys := StartTransferKeys()
+		defer restoreKeys()
+		beginStatus("download", addr, int64(totalPlainLen), numChunks)
+		hasher := sha256.New()
+		written, retryable, err := downloadChunksPipelined(br, out, numChunks, totalPlainLen, hasher, func(_ uint32, nonce, sealed []byte) ([]byte, error) {
+			return protocol.DecryptWithKey(key, nonce, sealed)
+		}, progress)
+		if err != nil && retryable && written < numChunks {
+			hdr := &rangeHeader{secure: true, totalPlainLen: totalPlainLen, numChunks: numChunks}
+			if err := resumeChunkedDownload(addr, code, out, key, hdr, written, progress); err != nil {
+				return err
+			}
+			fmt.Fprintln(os.Stderr)
+			if err := verifyAssembledFile(out, true, key, 0, protocol.HashSHA256, plaintextChecksum, signerPub, signature, verifySigner); err != nil {
+				return err
+			}
+		} else {
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(os.Stderr)
+			if !protocol.ChecksumEqual(hasher.Sum(nil), plaintextChecksum) {
+				return fmt.Errorf("%w – wrong key or corrupted data", ErrChecksumMismatch)
+			}
+			if err := protocol.VerifyUploadSignature(signerPub, signature, plaintextChecksum, verifySigner); err != nil {
+				return err
+			}
+		}
+		clearTransferPartial()
+		fmt.Printf("Downloaded: %s\n", Green(savePath))
+		if unzip {
+			if err := ExtractTarGz(savePath); err != nil {
+				return fmt.Errorf("unzip: %w", err)
+			}
+			fmt.Fprintln(os.Stderr, "Extracted archive.")
+		}
+		return nil
+	}
+
+	name, totalPlainLen, numChunks, plaintextChecksum, err := protocol.ReadEncryptedBlobChunkedHeader(br)
+	if err != nil {
+		return fmt.Errorf("read blob header: %w", err)
+	}
+	var chunkSums []byte
+	if protocol.HeaderHasChunkSums(keyVersion) {
+		chunkSums = make([]byte, int64(numChunks)*protocol.ChunkSumSize)
+		if _, err := io.ReadFull(br, chunkSums); err != nil {
+			return fmt.Errorf("read chunk sums: %w", err)
+		}
+	}
+	key, err := protocol.ResolveTransferKey(code, keyVersion, kdfSalt, identity)
+	if err != nil {
+		return fmt.Errorf("derive key: %w", err)
+	}
+	savePath := outputPath
+	if savePath == "" {
+		savePath = protocol.SanitizeFilename(name)
+	}
+	out, err := os.Create(savePath)
+	if err != nil {
+		return fmt.Errorf("create file %s: %w", savePath, err)
+	}
+	defer out.Close()
+	registerTransferPartial(savePath, "run 'tcpraw get "+code+"' again to restart the download")
+	restoreKeys := StartTransferKeys()
+	defer restoreKeys()
+	beginStatus("download", addr, int64(totalPlainLen), numChunks)
+	hasher := protocol.NewIntegrityHasherAlgo(key, keyVersion, fileMeta.HashAlgo)
+	written, retryable, err := downloadChunksPipelined(br, out, numChunks, totalPlainLen, hasher, func(i uint32, nonce, sealed []byte) ([]byte, error) {
+		var pt []byte
+		var err error
+		if protocol.ChunkStreamAAD(keyVersion) {
+			pt, err = protocol.DecryptChunkStream(key, uint64(i), i == numChunks-1, nonce, sealed)
+		} else {
+			pt, err = protocol.DecryptWithKey(key, nonce, sealed)
+		}
+		if err == nil && chunkSums != nil && !protocol.VerifyChunkSum(key, uint64(i), pt, chunkSums[int64(i)*protocol.ChunkSumSize:int64(i+1)*protocol.ChunkSumSize]) {
+			return nil, fmt.Errorf("%w – chunk %d failed its checksum", ErrChecksumMismatch, i)
+		}
+		return pt, err
+	}, progress)
+	if err != nil && retryable && written < numChunks {
+		hdr := &rangeHeader{keyVersion: keyVersion, totalPlainLen: totalPlainLen, numChunks: numChunks}
+		if err := resumeChunkedDownload(addr, code, out, key, hdr, written, progress); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr)
+		if err := verifyAssembledFile(out, false, key, keyVersion, fileMeta.HashAlgo, plaintextChecksum, signerPub, signature, verifySigner); err != nil {
+			return err
+		}
+	} else {
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr)
+		if !protocol.ChecksumEqual(hasher.Sum(nil), plaintextChecksum) {
+			return fmt.Errorf("%w – wrong code or corrupted data", ErrChecksumMismatch)
+		}
+		if err := protocol.VerifyUploadSignature(signerPub, signature, plaintextChecksum, verifySigner); err != nil {
+			return err
+		}
+	}
+	if err := fileMeta.Restore(savePath); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: restore file metadata: %v\n", err)
+	}
+	clearTransferPartial()
+	fmt.Printf("Downloaded: %s\n", Green(savePath))
+	if unzip {
+		if err := ExtractTarGz(savePath); err != nil {
+			return fmt.Errorf("unzip: %w", err)
+		}
+		fmt.Fprintln(os.Stderr, "Extracted archive.")
+	}
+	return nil
+}
+
+// downloadChunksPipelined overlaps the three stages of a chunked download –
+// socket reads, decryption, and file writes – with small bounded queues so a
+// slow disk no longer stalls the network (and vice versa). Chunk order is
+// preserved: one goroutine reads, the caller's goroutine decrypts and hashes,
+// one goroutine writes. On failure it reports how many chunks reached the
+// disk and whether reconnecting could help (read errors can be resumed;
+// decrypt and disk errors cannot).
+func downloadChunksPipelined(br io.Reader, out io.Writer, numChunks uint32, totalPlainLen uint64, hasher io.Writer, decrypt func(i uint32, nonce, sealed []byte) ([]byte, error), progress protocol.ProgressFunc) (written uint32, retryable bool, err error) {
+	type rawChunk struct {
+		nonce  []byte
+		sealed []byte
+		err    error
+	}
+	done := make(chan struct{})
+	defer close(done)
+	rawCh := make(chan rawChunk, 4)
+	go func() {
+		defer close(rawCh)
+		for i := uint32(0); i < numChunks; i++ {
+			nonce, sealed, err := protocol.ReadChunkRaw(br)
+			select {
+			case rawCh <- rawChunk{nonce, sealed, err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	var chunksWritten atomic.Uint32
+	writeCh := make(chan []byte, 4)
+	writeErr := make(chan error, 1)
+	go func() {
+		for pt := range writeCh {
+			if _, err := out.Write(pt); err != nil {
+				writeErr <- fmt.Errorf("write chunk: %w", err)
+				// Drain so the decrypt stage never blocks on a dead writer.
+				for range writeCh {
+				}
+				return
+			}
+			chunksWritten.Add(1)
+		}
+		writeErr <- nil
+	}()
+	var downloaded int64
+	var stageErr error
+	for i := uint32(0); i < numChunks; i++ {
+		// Pausing here stalls the reader goroutine once its small channel
+		// buffer fills, which in turn backpressures the server over TCP.
+		waitIfPaused()
+		advanceStatusChunk()
+		rc, ok := <-rawCh
+		if !ok {
+			stageErr = fmt.Errorf("read chunk: stream ended early")
+			retryable = true
+			break
+		}
+		if rc.err != nil {
+			stageErr = fmt.Errorf("read chunk: %w", rc.err)
+			retryable = true
+			break
+		}
+		pt, err := decrypt(i, rc.nonce, rc.sealed)
+		if err != nil {
+			stageErr = fmt.Errorf("decrypt chunk: %w", err)
+			break
+		}
+		hasher.Write(pt)
+		downloaded += int64(len(pt))
+		writeCh <- pt
+		if progress != nil {
+			progress(downloaded, int64(totalPlainLen))
+		}
+	}
+	close(writeCh)
+	if err := <-writeErr; err != nil && stageErr == nil {
+		stageErr = err
+		retryable = false
+	}
+	return chunksWritten.Load(), retryable, stageErr
+}
+
+// openDownloadPake dials addr and runs the client side of the SPAKE2
+// handshake for code, returning a reader over the decrypted session channel.
+func openDownloadPake(addr, code string) (net.Conn, *bufio.Reader, byte, error) {
+	conn, err := dialWithFallback(addr)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	bw := bufio.NewWriterSize(conn, protocol.BufSize)
+	if err := protocol.WriteMessageTypeAuth(bw, protocol.MsgDownloadPake); err != nil {
+		conn.Close()
+		return nil, nil, 0, err
+	}
+	tag := protocol.PakeTag(code)
+	wRaw, w := protocol.PakeScalar(code)
+	xScalar := make([]byte, 32)
+	if _, err := io.ReadFull(crand.Reader, xScalar); err != nil {
+		conn.Close()
+		return nil, nil, 0, err
+	}
+	xx, xy := protocol.PakeBlind(xScalar, w, protocol.PakeMx, protocol.PakeMy)
+	xMsg := elliptic.Marshal(protocol.PakeCurve, xx, xy)
+	if _, err := bw.Write(tag); err != nil {
+		conn.Close()
+		return nil, nil, 0, err
+	}
+	if _, err := bw.Write(xMsg); err != nil {
+		conn.Close()
+		return nil, nil, 0, err
+	}
+	if err := bw.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, 0, err
+	}
+	status, err := protocol.ReadStatus(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, 0, fmt.Errorf("read response: %w", err)
+	}
+	if status != protocol.StatusOK {
+		// Redirect and embargo statuses carry a payload the caller reads.
+		return conn, bufio.NewReaderSize(conn, protocol.BufSize), status, nil
+	}
+	yMsg := make([]byte, protocol.PakePointSize)
+	if _, err := io.ReadFull(conn, yMsg); err != nil {
+		conn.Close()
+		return nil, nil, 0, fmt.Errorf("read server point: %w", err)
+	}
+	sx, sy := elliptic.Unmarshal(protocol.PakeCurve, yMsg)
+	if sx == nil {
+		conn.Close()
+		return nil, nil, 0, fmt.Errorf("invalid server point")
+	}
+	kx, ky := protocol.PakeUnblind(sx, sy, w, protocol.PakeNx, protocol.PakeNy, xScalar)
+	kMsg := elliptic.Marshal(protocol.PakeCurve, kx, ky)
+	base := protocol.PakeSessionKey(tag, wRaw, xMsg, yMsg, kMsg)
+	confirm := make([]byte, protocol.PakeConfirmSize)
+	if _, err := io.ReadFull(conn, confirm); err != nil {
+		conn.Close()
+		return nil, nil, 0, fmt.Errorf("read confirmation: %w", err)
+	}
+	if !hmac.Equal(confirm, protocol.PakeSubKey(base, "server-confirm")) {
+		conn.Close()
+		return nil, nil, 0, fmt.Errorf("pake confirmation failed – wrong code or tampered connection")
+	}
+	if _, err := conn.Write(protocol.PakeSubKey(base, "client-confirm")); err != nil {
+		conn.Close()
+		return nil, nil, 0, err
+	}
+	ch := protocol.NewPakeChannel(conn, base, true)
+	return conn, bufio.NewReaderSize(ch, protocol.BufSize), protocol.StatusOK, nil
+}
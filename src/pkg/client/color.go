@@ -0,0 +1,56 @@
+package client
+
+import (
+	"os"
+	"sync"
+)
+
+// TTY-aware color for the CLI output: green for results worth acting on
+// (codes, finished downloads), yellow for warnings, red for errors. Color is
+// on only when stdout is a terminal, and honours the NO_COLOR convention and
+// the -no-color flag, so piped output and logs stay plain.
+
+var (
+	colorOnce    sync.Once
+	colorOn      bool
+	colorForced  bool // DisableColor called before first use
+	colorDisable bool
+)
+
+// DisableColor turns coloring off for the rest of the process (-no-color).
+func DisableColor() {
+	colorForced = true
+	colorDisable = true
+}
+
+func colorEnabled() bool {
+	colorOnce.Do(func() {
+		if colorForced {
+			colorOn = !colorDisable
+			return
+		}
+		if os.Getenv("NO_COLOR") != "" {
+			return
+		}
+		if fi, err := os.Stdout.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			return
+		}
+		colorOn = true
+	})
+	return colorOn
+}
+
+func colorize(code, s string) string {
+	if !colorEnabled() {
+		return s
+	}
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
+
+// Green, Yellow and Red wrap s in the ANSI color when enabled; main uses
+// them too, so the detection logic lives in one place.
+func Green(s string) string { return colorize("32", s) }
+
+func Yellow(s string) string { return colorize("33", s) }
+
+func Red(s string) string { return colorize("31", s) }
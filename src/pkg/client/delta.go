@@ -0,0 +1,168 @@
+package client
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"fmt"
+	"os"
+	"time"
+
+	"tcpraw/pkg/protocol"
+)
+
+// Delta update (tcpraw update <code> <file>): re-upload a changed file
+// under its existing code, sending only the chunks whose keyed digests
+// differ from the stored blob's. The server returns the blob's signature
+// (salt, chunk layout, per-chunk digests); the code re-derives the same
+// transfer key, so digests computed locally are directly comparable. The
+// last stored and last new chunk always re-upload — their final-chunk AAD
+// makes the stored record unusable at any other position.
+
+func RunClientUpdate(code, filePath string) error {
+	if !protocol.ValidCode(code) {
+		return fmt.Errorf("code must be 6 digits")
+	}
+	serverID := int(code[0] - '0')
+	addrs, err := protocol.FetchServerList()
+	if err != nil {
+		return fmt.Errorf("fetch server list: %w", err)
+	}
+	if addrs[serverID] == "" {
+		return fmt.Errorf("server %d not in list", serverID)
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("read file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat file: %w", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("path is a directory")
+	}
+	size := info.Size()
+	if size == 0 {
+		return fmt.Errorf("file is empty")
+	}
+
+	conn, err := protocol.DialServer(addrs[serverID], protocol.DialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	registerTransferConn(conn)
+
+	bw := bufio.NewWriterSize(conn, protocol.BufSize)
+	if err := protocol.WriteMessageTypeAuth(bw, protocol.MsgDeltaUpload); err != nil {
+		return err
+	}
+	if err := protocol.WriteDownloadRequest(bw, code); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	br := bufio.NewReaderSize(conn, protocol.BufSize)
+	status, err := protocol.ReadStatus(br)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	switch status {
+	case protocol.StatusOK:
+	case protocol.StatusNotFound:
+		return ErrNotFound
+	default:
+		return fmt.Errorf("server cannot delta-update this code (secure, signed, passworded or pre-digest upload)")
+	}
+	keyVersion, salt, chunkLen, oldTotal, oldNum, gen, oldSums, err := protocol.ReadDeltaSignature(br)
+	if err != nil {
+		return fmt.Errorf("read signature: %w", err)
+	}
+	key, err := protocol.DeriveTransferKey(code, keyVersion, salt)
+	if err != nil {
+		return fmt.Errorf("derive key: %w", err)
+	}
+	// A single-chunk blob carries no reusable interior chunks, so chunk the
+	// new file at the current upload size instead of the stored one.
+	if oldNum <= 1 {
+		chunkLen = uint32(protocol.UploadChunkSize)
+	}
+
+	// Pass 1: digest the new file and pick the chunks to send.
+	numChunks := uint32((size + int64(chunkLen) - 1) / int64(chunkLen))
+	hasher := protocol.NewIntegrityHasher(key, keyVersion)
+	chunkSums := make([]byte, 0, int64(numChunks)*protocol.ChunkSumSize)
+	var changed []uint32
+	buf := make([]byte, chunkLen)
+	for i := uint32(0); i < numChunks; i++ {
+		n, err := readChunkAt(f, buf, int64(i)*int64(chunkLen))
+		if err != nil {
+			return fmt.Errorf("read file: %w", err)
+		}
+		hasher.Write(buf[:n])
+		sum := protocol.ChunkSum(key, uint64(i), buf[:n])
+		chunkSums = append(chunkSums, sum...)
+		reusable := i < oldNum && i != oldNum-1 && i != numChunks-1 &&
+			hmac.Equal(sum, oldSums[int64(i)*protocol.ChunkSumSize:int64(i+1)*protocol.ChunkSumSize])
+		if !reusable {
+			changed = append(changed, i)
+		}
+	}
+	checksum := hasher.Sum(nil)
+
+	fmt.Fprintf(os.Stderr, "info: %d of %d chunks changed (was %s, now %s)\n",
+		len(changed), numChunks, protocol.FormatBytes(float64(oldTotal)), protocol.FormatBytes(float64(size)))
+
+	// Pass 2: encrypt and send just those chunks.
+	if err := protocol.WriteDeltaHeader(bw, uint64(size), numChunks, checksum, chunkSums, uint32(len(changed))); err != nil {
+		return fmt.Errorf("send: %w", err)
+	}
+	start := time.Now()
+	var sent int64
+	for _, i := range changed {
+		n, err := readChunkAt(f, buf, int64(i)*int64(chunkLen))
+		if err != nil {
+			return fmt.Errorf("read file: %w", err)
+		}
+		nonce, sealed, err := protocol.EncryptChunkStreamGen(key, gen, uint64(i), i == numChunks-1, buf[:n])
+		if err != nil {
+			return fmt.Errorf("encrypt chunk %d: %w", i, err)
+		}
+		if err := protocol.WriteDeltaChunk(bw, i, nonce, sealed); err != nil {
+			return fmt.Errorf("send: %w", err)
+		}
+		sent += int64(n)
+		if elapsed := time.Since(start).Seconds(); elapsed >= 0.001 {
+			fmt.Fprintf(os.Stderr, "\r  speed: %s/s  |  sent: %s  ",
+				protocol.FormatBytes(float64(sent)/elapsed), protocol.FormatBytes(float64(sent)))
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+	fmt.Fprintln(os.Stderr)
+
+	fmt.Fprintln(os.Stderr, "info: waiting for server...")
+	status, err = protocol.ReadStatus(conn)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if status != protocol.StatusOK {
+		return fmt.Errorf("server error")
+	}
+	fmt.Printf("File updated. Code unchanged: %s (%s)\n", Green(code), formatValidDuration(readEchoedTTL(conn, 0)))
+	return nil
+}
+
+// readChunkAt fills buf from offset and returns how much of the file was
+// left there; only the final chunk comes back short.
+func readChunkAt(f *os.File, buf []byte, off int64) (int, error) {
+	n, err := f.ReadAt(buf, off)
+	if n > 0 || err == nil {
+		return n, nil
+	}
+	return 0, err
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package client
+
+import "os"
+
+// hardLinkKey reports no hard links on platforms without inode numbers;
+// repeated entries are archived as independent copies.
+func hardLinkKey(fi os.FileInfo) (key string, linked bool) {
+	return "", false
+}
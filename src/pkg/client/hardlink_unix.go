@@ -0,0 +1,22 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package client
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// hardLinkKey identifies a file that appears under more than one directory
+// entry, so directory packing can store the extra entries as hard links.
+// linked is false for files with a single link (the common case), keeping the
+// dedup map small.
+func hardLinkKey(fi os.FileInfo) (key string, linked bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return "", false
+	}
+	return fmt.Sprintf("%d:%d", st.Dev, st.Ino), true
+}
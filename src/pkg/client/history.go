@@ -0,0 +1,186 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tcpraw/pkg/protocol"
+)
+
+// Benchmark history. Every completed servers run appends its per-server
+// results to a line-oriented file in the user cache dir, and
+// `servers -history` summarises how each node's ping, free space and
+// throughput evolved over past runs — a single benchmark only shows who had
+// a lucky ten seconds. Persistence is best-effort like the rest of the
+// cache: failures are silent and just mean no history.
+
+const (
+	benchHistoryFile     = "bench_history"
+	benchHistoryMaxLines = 1000
+)
+
+type benchRecord struct {
+	ts      time.Time
+	id      int
+	addr    string
+	pingMs  float64
+	free    uint64
+	downBps float64
+	upBps   float64
+}
+
+// appendBenchHistory records the reachable servers of one run, one
+// tab-separated line each: unix time, id, addr, ping ms, free bytes,
+// download B/s, upload B/s.
+func appendBenchHistory(results []serverStats) {
+	path, err := protocol.CacheFilePath(benchHistoryFile)
+	if err != nil {
+		return
+	}
+	var b strings.Builder
+	now := time.Now().Unix()
+	for _, s := range results {
+		if !s.ok {
+			continue
+		}
+		fmt.Fprintf(&b, "%d\t%d\t%s\t%.1f\t%d\t%.0f\t%.0f\n",
+			now, s.id, s.addr, s.pingMs, s.free, s.downloadBps, s.uploadBps)
+	}
+	if b.Len() == 0 {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	f.WriteString(b.String())
+	f.Close()
+	trimBenchHistory(path)
+}
+
+// trimBenchHistory keeps the file from growing without bound: oldest lines
+// go first once the cap is exceeded.
+func trimBenchHistory(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) <= benchHistoryMaxLines {
+		return
+	}
+	lines = lines[len(lines)-benchHistoryMaxLines:]
+	os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+}
+
+func readBenchHistory() []benchRecord {
+	path, err := protocol.CacheFilePath(benchHistoryFile)
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var recs []benchRecord
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			continue
+		}
+		ts, err1 := strconv.ParseInt(fields[0], 10, 64)
+		id, err2 := strconv.Atoi(fields[1])
+		ping, err3 := strconv.ParseFloat(fields[3], 64)
+		free, err4 := strconv.ParseUint(fields[4], 10, 64)
+		down, err5 := strconv.ParseFloat(fields[5], 64)
+		up, err6 := strconv.ParseFloat(fields[6], 64)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil || err5 != nil || err6 != nil {
+			continue
+		}
+		recs = append(recs, benchRecord{
+			ts: time.Unix(ts, 0), id: id, addr: fields[2],
+			pingMs: ping, free: free, downBps: down, upBps: up,
+		})
+	}
+	return recs
+}
+
+func median(v []float64) float64 {
+	if len(v) == 0 {
+		return 0
+	}
+	s := append([]float64(nil), v...)
+	sort.Float64s(s)
+	if len(s)%2 == 1 {
+		return s[len(s)/2]
+	}
+	return (s[len(s)/2-1] + s[len(s)/2]) / 2
+}
+
+// RunClientServersHistory summarises the recorded benchmark runs per server:
+// median ping and throughput, the worst observed download rate, and the most
+// recent free space.
+func RunClientServersHistory() error {
+	recs := readBenchHistory()
+	if len(recs) == 0 {
+		fmt.Println("No benchmark history yet. Run 'tcpraw servers' a few times first.")
+		return nil
+	}
+	type group struct {
+		id             int
+		addr           string
+		pings          []float64
+		downs          []float64
+		ups            []float64
+		lastFree       uint64
+		firstRun, last time.Time
+	}
+	byServer := map[string]*group{}
+	var order []string
+	for _, r := range recs {
+		key := fmt.Sprintf("%d %s", r.id, r.addr)
+		g, ok := byServer[key]
+		if !ok {
+			g = &group{id: r.id, addr: r.addr, firstRun: r.ts}
+			byServer[key] = g
+			order = append(order, key)
+		}
+		g.pings = append(g.pings, r.pingMs)
+		g.downs = append(g.downs, r.downBps)
+		g.ups = append(g.ups, r.upBps)
+		g.lastFree = r.free
+		g.last = r.ts
+	}
+	sort.Slice(order, func(i, j int) bool { return byServer[order[i]].id < byServer[order[j]].id })
+
+	const gb = 1024 * 1024 * 1024
+	const mb = 1024 * 1024
+	fmt.Printf("Benchmark history since %s:\n\n", recs[0].ts.Format("2006-01-02 15:04"))
+	fmt.Printf("%-4s %-24s %5s %10s %14s %14s %14s %12s %17s\n",
+		"ID", "Address", "Runs", "Ping med", "Down med", "Down worst", "Up med", "Free last", "Last run")
+	fmt.Printf("%-4s %-24s %5s %10s %14s %14s %14s %12s %17s\n",
+		"--", "-------", "----", "--------", "--------", "----------", "------", "---------", "--------")
+	for _, key := range order {
+		g := byServer[key]
+		worst := g.downs[0]
+		for _, d := range g.downs {
+			if d < worst {
+				worst = d
+			}
+		}
+		row := fmt.Sprintf("%-4d %-24s %5d %10s %14s %14s %14s %12s %17s",
+			g.id, g.addr, len(g.pings),
+			fmt.Sprintf("%.0f ms", median(g.pings)),
+			fmt.Sprintf("%.2f MB/s", median(g.downs)/float64(mb)),
+			fmt.Sprintf("%.2f MB/s", worst/float64(mb)),
+			fmt.Sprintf("%.2f MB/s", median(g.ups)/float64(mb)),
+			fmt.Sprintf("%.2f GB", float64(g.lastFree)/float64(gb)),
+			g.last.Format("2006-01-02 15:04"))
+		fmt.Println(Green(row))
+	}
+	return nil
+}
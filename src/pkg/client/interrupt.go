@@ -0,0 +1,77 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// Ctrl-C bookkeeping for the CLI transfer commands. The active connection
+// and any partially written output file are registered while a transfer is
+// in flight; the SIGINT handler closes the one and removes the other, so an
+// aborted download doesn't leave a truncated file behind and the server
+// drops its staged partial upload when the connection dies.
+var (
+	transferMu      sync.Mutex
+	transferConn    net.Conn
+	transferPartial string
+	transferHint    string
+)
+
+func registerTransferConn(conn net.Conn) {
+	transferMu.Lock()
+	transferConn = conn
+	transferMu.Unlock()
+}
+
+func registerTransferPartial(path, hint string) {
+	transferMu.Lock()
+	transferPartial = path
+	transferHint = hint
+	transferMu.Unlock()
+}
+
+func clearTransferPartial() {
+	transferMu.Lock()
+	transferPartial = ""
+	transferHint = ""
+	transferMu.Unlock()
+}
+
+// CancelOnInterrupt installs the SIGINT handler for the transfer commands:
+// the first Ctrl-C cancels the in-flight transfer cleanly (close the
+// connection, remove the partial output, print how to restart) and exits
+// with the conventional 130. The handler un-registers itself, so a second
+// Ctrl-C falls back to the runtime's default hard kill.
+func CancelOnInterrupt() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt)
+	go func() {
+		<-ch
+		signal.Stop(ch)
+		abortTransfer("interrupted")
+	}()
+}
+
+// abortTransfer runs the shared cancel path for Ctrl-C and the q transfer
+// key: close the connection, remove the partial output, print how to
+// restart and exit with the conventional 130.
+func abortTransfer(reason string) {
+	transferMu.Lock()
+	conn, partial, hint := transferConn, transferPartial, transferHint
+	transferMu.Unlock()
+	fmt.Fprintln(os.Stderr, "\n"+reason)
+	if conn != nil {
+		conn.Close()
+	}
+	if partial != "" {
+		os.Remove(partial)
+		fmt.Fprintf(os.Stderr, "removed partial file %s\n", partial)
+	}
+	if hint != "" {
+		fmt.Fprintln(os.Stderr, hint)
+	}
+	os.Exit(130)
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"tcpraw/pkg/protocol"
+)
+
+// OS key storage for secure-send keys. After a secure upload the generated
+// 256-bit key is saved under the code in the platform credential store
+// (macOS Keychain, Windows DPAPI, Linux secret service), and get retrieves
+// it automatically on the same machine instead of asking the user to copy
+// 64 hex characters around. Storage is best-effort: without a backend the
+// key is simply printed as before. The platform keystoreSet/keystoreGet
+// implementations live in the keystore_* files.
+
+// saveSecureKeyForCode stores the key under its code, logging the outcome.
+func saveSecureKeyForCode(code string, key []byte) {
+	if err := keystoreSet(code, hex.EncodeToString(key)); err != nil {
+		fmt.Fprintf(os.Stderr, "info: key not stored in %s: %v\n", keystoreName, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "info: key stored in %s – get on this machine needs no key entry\n", keystoreName)
+}
+
+// lookupSecureKeyForCode returns the stored key for code, or nil.
+func lookupSecureKeyForCode(code string) []byte {
+	hexKey, err := keystoreGet(code)
+	if err != nil {
+		return nil
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(hexKey))
+	if err != nil || len(key) != protocol.SecureKeySize {
+		return nil
+	}
+	return key
+}
+
+// obtainSecureKey returns the key for a secure download: from the OS key
+// store when the upload happened on this machine, otherwise prompted.
+func obtainSecureKey(code string) ([]byte, error) {
+	if key := lookupSecureKeyForCode(code); key != nil {
+		fmt.Fprintf(os.Stderr, "info: using key from %s\n", keystoreName)
+		return key, nil
+	}
+	fmt.Fprint(os.Stderr, "Enter key (64 hex characters or 24 words): ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return nil, fmt.Errorf("read key: %w", err)
+	}
+	line = strings.TrimSpace(line)
+	if strings.ContainsRune(line, ' ') {
+		key, err := keyFromMnemonic(line)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	if len(line) != 64 {
+		return nil, fmt.Errorf("key must be 64 hex characters (32 bytes) or a 24-word mnemonic")
+	}
+	key, err := hex.DecodeString(line)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex key: %w", err)
+	}
+	return key, nil
+}
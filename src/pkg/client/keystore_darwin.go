@@ -0,0 +1,30 @@
+//go:build darwin
+// +build darwin
+
+package client
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const keystoreName = "macOS Keychain"
+
+func keystoreSet(code, secret string) error {
+	out, err := exec.Command("security", "add-generic-password", "-U",
+		"-a", "tcpraw", "-s", "tcpraw-"+code, "-w", secret).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("security: %v (%s)", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func keystoreGet(code string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password",
+		"-a", "tcpraw", "-s", "tcpraw-"+code, "-w").Output()
+	if err != nil {
+		return "", fmt.Errorf("security: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,16 @@
+//go:build !darwin && !linux && !windows
+// +build !darwin,!linux,!windows
+
+package client
+
+import "fmt"
+
+const keystoreName = "OS key store"
+
+func keystoreSet(code, secret string) error {
+	return fmt.Errorf("no key store on this platform")
+}
+
+func keystoreGet(code string) (string, error) {
+	return "", fmt.Errorf("no key store on this platform")
+}
@@ -0,0 +1,35 @@
+//go:build linux
+// +build linux
+
+package client
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const keystoreName = "secret service"
+
+// Uses secret-tool (libsecret) so the key lands in GNOME Keyring, KWallet or
+// whatever implements org.freedesktop.secrets.
+
+func keystoreSet(code, secret string) error {
+	cmd := exec.Command("secret-tool", "store", "--label", "tcpraw "+code,
+		"service", "tcpraw", "code", code)
+	cmd.Stdin = strings.NewReader(secret)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("secret-tool: %v (%s)", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func keystoreGet(code string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup",
+		"service", "tcpraw", "code", code).Output()
+	if err != nil {
+		return "", fmt.Errorf("secret-tool: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
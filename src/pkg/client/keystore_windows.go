@@ -0,0 +1,89 @@
+//go:build windows
+// +build windows
+
+package client
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const keystoreName = "Windows DPAPI"
+
+// Keys are sealed with CryptProtectData (tied to the user account) and the
+// opaque blobs kept under %APPDATA%\tcpraw\keys.
+
+type dpapiBlob struct {
+	cbData uint32
+	pbData *byte
+}
+
+var (
+	crypt32            = syscall.NewLazyDLL("crypt32.dll")
+	kernel32dp         = syscall.NewLazyDLL("kernel32.dll")
+	procProtectData    = crypt32.NewProc("CryptProtectData")
+	procUnprotectData  = crypt32.NewProc("CryptUnprotectData")
+	procLocalFreeDpapi = kernel32dp.NewProc("LocalFree")
+)
+
+func newDpapiBlob(d []byte) *dpapiBlob {
+	if len(d) == 0 {
+		return &dpapiBlob{}
+	}
+	return &dpapiBlob{cbData: uint32(len(d)), pbData: &d[0]}
+}
+
+func (b *dpapiBlob) bytes() []byte {
+	d := make([]byte, b.cbData)
+	copy(d, unsafe.Slice(b.pbData, b.cbData))
+	return d
+}
+
+func keystorePath(code string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "tcpraw", "keys")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, code+".key"), nil
+}
+
+func keystoreSet(code, secret string) error {
+	var out dpapiBlob
+	in := newDpapiBlob([]byte(secret))
+	r, _, callErr := procProtectData.Call(uintptr(unsafe.Pointer(in)), 0, 0, 0, 0, 0, uintptr(unsafe.Pointer(&out)))
+	if r == 0 {
+		return fmt.Errorf("CryptProtectData: %v", callErr)
+	}
+	defer procLocalFreeDpapi.Call(uintptr(unsafe.Pointer(out.pbData)))
+	path, err := keystorePath(code)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, out.bytes(), 0600)
+}
+
+func keystoreGet(code string) (string, error) {
+	path, err := keystorePath(code)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var out dpapiBlob
+	in := newDpapiBlob(data)
+	r, _, callErr := procUnprotectData.Call(uintptr(unsafe.Pointer(in)), 0, 0, 0, 0, 0, uintptr(unsafe.Pointer(&out)))
+	if r == 0 {
+		return "", fmt.Errorf("CryptUnprotectData: %v", callErr)
+	}
+	defer procLocalFreeDpapi.Call(uintptr(unsafe.Pointer(out.pbData)))
+	return string(out.bytes()), nil
+}
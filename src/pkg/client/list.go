@@ -0,0 +1,75 @@
+package client
+
+import (
+	"fmt"
+	"os"
+
+	"tcpraw/pkg/protocol"
+)
+
+// Listing (tcpraw ls <code>): fetch just the manifest entry of a bundle and
+// print what the code contains — names, sizes, the total — so a recipient
+// can look before committing bandwidth. Only the chunks holding the
+// manifest cross the wire; the entry data never moves.
+
+func RunClientList(code, identity string) error {
+	if !protocol.ValidCode(code) {
+		return fmt.Errorf("code must be 6 digits")
+	}
+	serverID := int(code[0] - '0')
+	addrs, err := protocol.FetchServerList()
+	if err != nil {
+		return fmt.Errorf("fetch server list: %w", err)
+	}
+	if addrs[serverID] == "" {
+		return fmt.Errorf("server %d not in list", serverID)
+	}
+
+	probe, pbr, status, err := openRange(addrs[serverID], code, 0, 0)
+	if err != nil {
+		return err
+	}
+	switch status {
+	case protocol.StatusOK:
+	case protocol.StatusNotFound:
+		probe.Close()
+		return ErrNotFound
+	case protocol.StatusRedirect:
+		probe.Close()
+		return fmt.Errorf("this code has moved to another server; fetch the whole bundle with tcpraw get")
+	default:
+		probe.Close()
+		return fmt.Errorf("server cannot serve chunk ranges for this code (old server or non-chunked upload)")
+	}
+	hdr, err := readRangeHeader(pbr)
+	probe.Close()
+	if err != nil {
+		return err
+	}
+	if hdr.secure {
+		return fmt.Errorf("secure uploads cannot be listed")
+	}
+	fmt.Fprintln(os.Stderr, "info: decrypting with your code...")
+	key, err := protocol.ResolveTransferKey(code, hdr.keyVersion, hdr.kdfSalt, identity)
+	if err != nil {
+		return fmt.Errorf("derive key: %w", err)
+	}
+	rb := &rangeBundle{addr: addrs[serverID], code: code, key: key, hdr: hdr}
+	m, _, err := rb.readManifest()
+	if err != nil {
+		return err
+	}
+
+	var files int
+	var total int64
+	for _, e := range m.Entries {
+		fmt.Printf("%10s  %s\n", protocol.FormatBytes(float64(e.Size)), e.Name)
+		if e.Size > 0 {
+			files++
+			total += e.Size
+		}
+	}
+	fmt.Printf("Total: %s in %d files (%d entries, %s bundle)\n",
+		protocol.FormatBytes(float64(total)), files, len(m.Entries), protocol.FormatBytes(float64(hdr.totalPlainLen)))
+	return nil
+}
@@ -1,4 +1,4 @@
-package main
+package client
 
 import (
 	"bufio"
@@ -11,6 +11,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"tcpraw/pkg/protocol"
 )
 
 const (
@@ -18,7 +20,7 @@ const (
 	localDefaultTCP    = 40556
 )
 
-func runLocalSender(filePath string) error {
+func RunLocalSender(filePath string) error {
 	info, err := os.Stat(filePath)
 	if err != nil {
 		return err
@@ -28,7 +30,7 @@ func runLocalSender(filePath string) error {
 	var cleanup func()
 	if info.IsDir() {
 		// In local mode, directories are auto-packed for transfer.
-		packedPath, c, err := prepareSendPath(filePath, true)
+		packedPath, c, err := PrepareSendPath(filePath, true, SymlinksKeep)
 		if err != nil {
 			return err
 		}
@@ -101,7 +103,7 @@ func serveLocalFile(conn net.Conn, path, name string, size int64) {
 	_ = bw.Flush()
 }
 
-func runLocalReceiver() error {
+func RunLocalReceiver() error {
 	pc, err := net.ListenPacket("udp4", fmt.Sprintf(":%d", localDiscoveryPort))
 	if err != nil {
 		return err
@@ -167,7 +169,7 @@ func runLocalReceiver() error {
 		line = strings.TrimSpace(strings.ToLower(line))
 		if line == "y" || line == "yes" {
 			if err := downloadLocalFile(host, port, name); err != nil {
-				fmt.Printf("download failed: %v\n", err)
+				fmt.Fprintf(os.Stderr, "download failed: %v\n", err)
 			}
 		}
 		printActive(peers)
@@ -189,9 +191,9 @@ func downloadLocalFile(host string, port int, suggestedName string) error {
 	if _, err := io.ReadFull(br, nameBuf); err != nil {
 		return err
 	}
-	name := filepath.Base(string(nameBuf))
-	if name == "" {
-		name = filepath.Base(suggestedName)
+	name := protocol.SanitizeFilename(string(nameBuf))
+	if name == "download" && suggestedName != "" {
+		name = protocol.SanitizeFilename(suggestedName)
 	}
 	var size uint64
 	if err := binary.Read(br, binary.BigEndian, &size); err != nil {
@@ -222,8 +224,8 @@ func downloadLocalFile(host string, port int, suggestedName string) error {
 			elapsed := time.Since(start).Seconds()
 			if elapsed >= 0.001 {
 				speed := float64(downloaded) / elapsed
-				fmt.Printf("\r  speed: %s/s  |  downloaded: %s  |  left: %s  ",
-					formatBytes(speed), formatBytes(float64(downloaded)), formatBytes(float64(remaining)))
+				fmt.Fprintf(os.Stderr, "\r  speed: %s/s  |  downloaded: %s  |  left: %s  ",
+					protocol.FormatBytes(speed), protocol.FormatBytes(float64(downloaded)), protocol.FormatBytes(float64(remaining)))
 			}
 		}
 		if readErr != nil {
@@ -233,7 +235,7 @@ func downloadLocalFile(host string, port int, suggestedName string) error {
 			return readErr
 		}
 	}
-	fmt.Println()
+	fmt.Fprintln(os.Stderr)
 	if downloaded != int64(size) {
 		return fmt.Errorf("incomplete download: got %d of %d bytes", downloaded, size)
 	}
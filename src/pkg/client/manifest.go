@@ -0,0 +1,153 @@
+// Manifest bundles (send -manifest). A directory packs into an uncompressed
+// tar whose first entry is a JSON manifest mapping every archived path to
+// its byte offset in the rest of the stream. With no compression in the
+// way, each entry's bytes sit at a computable position in the plaintext, so
+// `get -only` can pull just the chunk ranges covering selected entries
+// (selective.go) instead of the whole bundle; the price is the gzip pass a
+// plain directory send gets.
+package client
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// manifestEntryName is the reserved name of the manifest entry; extraction
+// skips it.
+const manifestEntryName = "._tcpraw.manifest"
+
+// maxManifestLen bounds what a downloader will buffer for a manifest frame
+// (roughly a hundred bytes per entry; this covers directory trees far
+// beyond what a bundle upload can hold).
+const maxManifestLen = 64 * 1024 * 1024
+
+// manifestEntry records where one archived path starts. Offset is relative
+// to the data section — the stream right after the manifest entry's padded
+// end — so the manifest does not need to know its own encoded size. The
+// entry's records run to the next entry's offset, which covers extended
+// headers for long names without tracking them separately.
+type manifestEntry struct {
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+}
+
+type bundleManifest struct {
+	Entries []manifestEntry `json:"entries"`
+}
+
+// manifestDataStart returns the plaintext offset where the data section
+// begins: the manifest entry's tar header plus its padded payload.
+func manifestDataStart(manifestLen int64) int64 {
+	return 512 + (manifestLen+511)/512*512
+}
+
+// countingWriter tracks how many bytes passed through, so packing can
+// record each entry's offset.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// PrepareManifestSendPath packs the directory at path into a temp manifest
+// bundle and returns its path with a cleanup, like PrepareSendPath does for
+// tar.gz.
+func PrepareManifestSendPath(path, symlinks string) (sendPath string, cleanup func(), err error) {
+	switch symlinks {
+	case SymlinksKeep, SymlinksFollow, SymlinksSkip:
+	default:
+		return "", nil, fmt.Errorf("invalid -links value %q (keep, follow or skip)", symlinks)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", nil, err
+	}
+	if !info.IsDir() {
+		return "", nil, fmt.Errorf("-manifest packs a directory; %s is a file", path)
+	}
+
+	// Pass 1: the data section, one offset recorded per entry. The writer is
+	// only flushed, never closed — the trailer belongs on the final file.
+	data, err := os.CreateTemp("", "tcpraw-data-*.tar")
+	if err != nil {
+		return "", nil, fmt.Errorf("create temp: %w", err)
+	}
+	defer func() {
+		data.Close()
+		os.Remove(data.Name())
+	}()
+	cw := &countingWriter{w: data}
+	tw := tar.NewWriter(cw)
+	var m bundleManifest
+	err = packDirEntries(tw, path, symlinks, func(rel string, size int64) error {
+		m.Entries = append(m.Entries, manifestEntry{Name: rel, Offset: cw.n, Size: size})
+		return nil
+	})
+	if err == nil {
+		err = tw.Flush()
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("pack directory: %w", err)
+	}
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return "", nil, err
+	}
+	if int64(len(payload)) > maxManifestLen {
+		return "", nil, fmt.Errorf("directory has too many entries for a manifest bundle")
+	}
+
+	// Pass 2: the manifest entry, then the data section and the tar trailer.
+	out, err := os.CreateTemp("", "tcpraw-*.tar")
+	if err != nil {
+		return "", nil, fmt.Errorf("create temp: %w", err)
+	}
+	fail := func(err error) (string, func(), error) {
+		out.Close()
+		os.Remove(out.Name())
+		return "", nil, err
+	}
+	mtw := tar.NewWriter(out)
+	hdr := &tar.Header{
+		Name:     manifestEntryName,
+		Mode:     0644,
+		Size:     int64(len(payload)),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}
+	if err := mtw.WriteHeader(hdr); err != nil {
+		return fail(err)
+	}
+	if _, err := mtw.Write(payload); err != nil {
+		return fail(err)
+	}
+	if err := mtw.Flush(); err != nil {
+		return fail(err)
+	}
+	if _, err := data.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+	if _, err := io.Copy(out, data); err != nil {
+		return fail(err)
+	}
+	// The end-of-archive marker pass 1 never wrote.
+	if _, err := out.Write(make([]byte, 1024)); err != nil {
+		return fail(err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return "", nil, err
+	}
+	fmt.Fprintf(os.Stderr, "info: packed manifest bundle: %d entries\n", len(m.Entries))
+	return out.Name(), func() { os.Remove(out.Name()) }, nil
+}
@@ -0,0 +1,13 @@
+//go:build (!linux && !darwin && !freebsd) || (!amd64 && !arm64)
+// +build !linux,!darwin,!freebsd !amd64,!arm64
+
+package client
+
+import (
+	"errors"
+	"os"
+)
+
+func mmapFile(f *os.File, size int64) ([]byte, func(), error) {
+	return nil, nil, errors.New("mmap not supported on this platform")
+}
@@ -0,0 +1,20 @@
+//go:build (linux || darwin || freebsd) && (amd64 || arm64)
+// +build linux darwin freebsd
+// +build amd64 arm64
+
+package client
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps f read-only. The caller must keep f open while the mapping
+// is in use and call the returned release func when done.
+func mmapFile(f *os.File, size int64) ([]byte, func(), error) {
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() { syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,371 @@
+// Parallel chunked download. A probe connection asks for a zero-length range
+// to learn the blob layout, then several connections each stream a contiguous
+// chunk range and write their plaintext at the right offset. Non-chunked,
+// password-protected and pre-range servers all fall back to the single-stream
+// path in RunClientGet.
+package client
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tcpraw/pkg/protocol"
+)
+
+// openRange dials addr and sends a chunk-range request for code. A count of
+// zero asks for the header only.
+func openRange(addr, code string, start, count uint32) (net.Conn, *bufio.Reader, byte, error) {
+	conn, err := dialWithFallback(addr)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	bw := bufio.NewWriterSize(conn, protocol.BufSize)
+	if err := protocol.WriteMessageTypeAuth(bw, protocol.MsgDownloadRange); err != nil {
+		conn.Close()
+		return nil, nil, 0, err
+	}
+	if err := protocol.WriteRangeRequest(bw, code, start, count); err != nil {
+		conn.Close()
+		return nil, nil, 0, err
+	}
+	if err := bw.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, 0, err
+	}
+	br := bufio.NewReaderSize(conn, protocol.BufSize)
+	status, err := protocol.ReadStatus(br)
+	if err != nil {
+		conn.Close()
+		return nil, nil, 0, err
+	}
+	return conn, br, status, nil
+}
+
+// rangeHeader is the preamble every range response repeats, so each
+// connection of a parallel download can be parsed independently.
+type rangeHeader struct {
+	secure        bool
+	keyVersion    byte
+	kdfSalt       []byte
+	signerPub     []byte
+	signature     []byte
+	name          string
+	totalPlainLen uint64
+	numChunks     uint32
+	checksum      []byte
+	chunkSums     []byte
+	meta          protocol.FileMeta
+}
+
+// readRangeHeader parses the format frame and chunked blob header of a range
+// response. The server only serves ranges of chunked blobs, so any other
+// format is an error.
+func readRangeHeader(br *bufio.Reader) (*rangeHeader, error) {
+	formatByte := make([]byte, 1)
+	if _, err := io.ReadFull(br, formatByte); err != nil {
+		return nil, fmt.Errorf("read format: %w", err)
+	}
+	hdr := &rangeHeader{keyVersion: protocol.KeyVersionSHA256}
+	switch formatByte[0] {
+	case protocol.FormatChunked:
+	case protocol.FormatSecureChunked:
+		hdr.secure = true
+	case protocol.FormatChunkedV:
+		verBuf := make([]byte, 1)
+		if _, err := io.ReadFull(br, verBuf); err != nil {
+			return nil, fmt.Errorf("read key version: %w", err)
+		}
+		hdr.keyVersion = verBuf[0]
+		if size := protocol.HeaderSaltSize(hdr.keyVersion); size > 0 {
+			hdr.kdfSalt = make([]byte, size)
+			if _, err := io.ReadFull(br, hdr.kdfSalt); err != nil {
+				return nil, fmt.Errorf("read key salt: %w", err)
+			}
+		}
+		if protocol.HeaderHasSignFrame(hdr.keyVersion) {
+			var err error
+			hdr.signerPub, hdr.signature, err = protocol.ReadSignatureFrame(br)
+			if err != nil {
+				return nil, fmt.Errorf("read signer frame: %w", err)
+			}
+		}
+		if protocol.HeaderHasMetaFrame(hdr.keyVersion) {
+			var err error
+			hdr.meta, err = protocol.ReadMetaFrame(br)
+			if err != nil {
+				return nil, fmt.Errorf("read metadata frame: %w", err)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unexpected format %d in range response", formatByte[0])
+	}
+	var err error
+	hdr.name, hdr.totalPlainLen, hdr.numChunks, hdr.checksum, err = protocol.ReadEncryptedBlobChunkedHeader(br)
+	if err != nil {
+		return nil, fmt.Errorf("read blob header: %w", err)
+	}
+	if !hdr.secure && protocol.HeaderHasChunkSums(hdr.keyVersion) {
+		hdr.chunkSums = make([]byte, int64(hdr.numChunks)*protocol.ChunkSumSize)
+		if _, err := io.ReadFull(br, hdr.chunkSums); err != nil {
+			return nil, fmt.Errorf("read chunk sums: %w", err)
+		}
+	}
+	return hdr, nil
+}
+
+// tryParallelGet attempts a parallel download of code from addr over conns
+// connections. It reports handled=false when the server or blob cannot serve
+// ranges (old server, non-chunked upload, password required, too few chunks),
+// in which case the caller falls back to the single-stream path.
+func tryParallelGet(addr, code, outputPath string, unzip bool, verifySigner, identity string, conns int) (handled bool, err error) {
+	probe, pbr, status, err := openRange(addr, code, 0, 0)
+	if err != nil {
+		return false, nil
+	}
+	if status != protocol.StatusOK {
+		probe.Close()
+		return false, nil
+	}
+	hdr, err := readRangeHeader(pbr)
+	probe.Close()
+	if err != nil {
+		return false, nil
+	}
+	if hdr.numChunks < 2 {
+		return false, nil
+	}
+	if uint32(conns) > hdr.numChunks {
+		conns = int(hdr.numChunks)
+	}
+
+	var key []byte
+	if hdr.secure {
+		key, err = obtainSecureKey(code)
+	} else {
+		fmt.Fprintln(os.Stderr, "info: decrypting with your code...")
+		key, err = protocol.ResolveTransferKey(code, hdr.keyVersion, hdr.kdfSalt, identity)
+		if err != nil {
+			err = fmt.Errorf("derive key: %w", err)
+		}
+	}
+	if err != nil {
+		return true, err
+	}
+
+	savePath := outputPath
+	if savePath == "" {
+		savePath = protocol.SanitizeFilename(hdr.name)
+	}
+	out, err := os.Create(savePath)
+	if err != nil {
+		return true, fmt.Errorf("create file %s: %w", savePath, err)
+	}
+	defer out.Close()
+	registerTransferPartial(savePath, "run 'tcpraw get "+code+"' again to restart the download")
+
+	restoreKeys := StartTransferKeys()
+	defer restoreKeys()
+	beginStatus("download", addr, int64(hdr.totalPlainLen), hdr.numChunks)
+	fmt.Fprintf(os.Stderr, "info: downloading %d chunks over %d connections...\n", hdr.numChunks, conns)
+	startTime := time.Now()
+	var downloaded atomic.Int64
+	progress := func() {
+		elapsed := time.Since(startTime).Seconds()
+		if elapsed < 0.001 {
+			return
+		}
+		d := downloaded.Load()
+		updateStatus(d, int64(hdr.totalPlainLen))
+		speed := float64(d) / elapsed
+		remaining := int64(hdr.totalPlainLen) - d
+		fmt.Fprintf(os.Stderr, "\r  speed: %s/s  |  downloaded: %s  |  left: %s  ", protocol.FormatBytes(speed), protocol.FormatBytes(float64(d)), protocol.FormatBytes(float64(remaining)))
+	}
+
+	per := (hdr.numChunks + uint32(conns) - 1) / uint32(conns)
+	var wg sync.WaitGroup
+	errCh := make(chan error, conns)
+	for start := uint32(0); start < hdr.numChunks; start += per {
+		count := min(per, hdr.numChunks-start)
+		wg.Add(1)
+		go func(start, count uint32) {
+			defer wg.Done()
+			if err := fetchChunkRange(addr, code, out, key, hdr, start, count, &downloaded, progress); err != nil {
+				errCh <- fmt.Errorf("chunks %d-%d: %w", start, start+count-1, err)
+			}
+		}(start, count)
+	}
+	wg.Wait()
+	close(errCh)
+	if err := <-errCh; err != nil {
+		return true, err
+	}
+	fmt.Fprintln(os.Stderr)
+
+	if err := verifyAssembledFile(out, hdr.secure, key, hdr.keyVersion, hdr.meta.HashAlgo, hdr.checksum, hdr.signerPub, hdr.signature, verifySigner); err != nil {
+		return true, err
+	}
+	if err := hdr.meta.Restore(savePath); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: restore file metadata: %v\n", err)
+	}
+	clearTransferPartial()
+	fmt.Printf("Downloaded: %s\n", Green(savePath))
+	if unzip {
+		if err := ExtractTarGz(savePath); err != nil {
+			return true, fmt.Errorf("unzip: %w", err)
+		}
+		fmt.Fprintln(os.Stderr, "Extracted archive.")
+	}
+	return true, nil
+}
+
+// Reconnect policy for a dropped range connection: exponential backoff
+// between attempts, and the attempt counter resets whenever a reconnect makes
+// progress, so a long flaky transfer is not capped at five chunks of luck.
+const (
+	downloadMaxRetries   = 5
+	downloadRetryBase    = time.Second
+	downloadRetryBackoff = 30 * time.Second
+)
+
+// fetchChunkRange streams one contiguous chunk range, writing each decrypted
+// chunk at its global offset in out. When the connection drops it reconnects
+// with backoff and re-requests only the chunks still missing.
+func fetchChunkRange(addr, code string, out *os.File, key []byte, hdr *rangeHeader, start, count uint32, downloaded *atomic.Int64, progress func()) error {
+	next := start
+	end := start + count
+	retries := 0
+	backoff := downloadRetryBase
+	for {
+		before := next
+		retryable, err := streamChunkRange(addr, code, out, key, hdr, &next, end, downloaded, progress)
+		if err == nil {
+			return nil
+		}
+		if next > before {
+			retries = 0
+			backoff = downloadRetryBase
+		}
+		if !retryable || retries >= downloadMaxRetries {
+			return err
+		}
+		retries++
+		fmt.Fprintf(os.Stderr, "\ninfo: connection lost at chunk %d (%v); retrying in %v (%d/%d)...\n", next, err, backoff, retries, downloadMaxRetries)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > downloadRetryBackoff {
+			backoff = downloadRetryBackoff
+		}
+	}
+}
+
+// streamChunkRange runs one connection of fetchChunkRange, advancing *next
+// past every chunk that reached the disk. retryable reports whether a fresh
+// connection could finish the job (network errors yes; bad data or a failed
+// disk write no).
+func streamChunkRange(addr, code string, out *os.File, key []byte, hdr *rangeHeader, next *uint32, end uint32, downloaded *atomic.Int64, progress func()) (retryable bool, err error) {
+	conn, br, status, err := openRange(addr, code, *next, end-*next)
+	if err != nil {
+		return true, err
+	}
+	defer conn.Close()
+	if status != protocol.StatusOK {
+		return false, fmt.Errorf("server error (status %d)", status)
+	}
+	h, err := readRangeHeader(br)
+	if err != nil {
+		return true, err
+	}
+	if h.numChunks != hdr.numChunks {
+		return false, fmt.Errorf("blob changed between connections")
+	}
+	// The chunk stride is the uploader's plaintext chunk size, which is not
+	// fixed (-wan uploads use bigger chunks), so the write offset is derived
+	// from the first decrypted chunk: every chunk but the last is full-size.
+	offset := int64(-1)
+	var nonce [12]byte
+	var sealed []byte
+	for *next < end {
+		waitIfPaused()
+		advanceStatusChunk()
+		i := *next
+		sealed, err = protocol.ReadChunkInto(br, nonce[:], sealed)
+		if err != nil {
+			return true, fmt.Errorf("read chunk: %w", err)
+		}
+		var pt []byte
+		if !hdr.secure && protocol.ChunkStreamAAD(hdr.keyVersion) {
+			pt, err = protocol.DecryptChunkStream(key, uint64(i), i == hdr.numChunks-1, nonce[:], sealed)
+		} else {
+			pt, err = protocol.DecryptWithKey(key, nonce[:], sealed)
+		}
+		if err != nil {
+			return false, fmt.Errorf("decrypt: %w", err)
+		}
+		if h.chunkSums != nil && !protocol.VerifyChunkSum(key, uint64(i), pt, h.chunkSums[int64(i)*protocol.ChunkSumSize:int64(i+1)*protocol.ChunkSumSize]) {
+			return false, fmt.Errorf("%w – chunk %d failed its checksum", ErrChecksumMismatch, i)
+		}
+		if offset < 0 {
+			if i == hdr.numChunks-1 {
+				offset = int64(hdr.totalPlainLen) - int64(len(pt))
+			} else {
+				offset = int64(i) * int64(len(pt))
+			}
+		}
+		if _, err := out.WriteAt(pt, offset); err != nil {
+			return false, fmt.Errorf("write chunk: %w", err)
+		}
+		offset += int64(len(pt))
+		*next = i + 1
+		downloaded.Add(int64(len(pt)))
+		progress()
+	}
+	return false, nil
+}
+
+// resumeChunkedDownload picks up a broken single-stream download at the
+// first chunk that never reached the disk, re-requesting the rest as a range
+// from the same server. Against a pre-range server the request fails and the
+// original error stands.
+func resumeChunkedDownload(addr, code string, out *os.File, key []byte, hdr *rangeHeader, written uint32, progress protocol.ProgressFunc) error {
+	fmt.Fprintf(os.Stderr, "\ninfo: download interrupted at chunk %d/%d; resuming...\n", written, hdr.numChunks)
+	var downloaded atomic.Int64
+	downloaded.Store(int64(hdr.totalPlainLen) * int64(written) / int64(hdr.numChunks))
+	return fetchChunkRange(addr, code, out, key, hdr, written, hdr.numChunks-written, &downloaded, func() {
+		if progress != nil {
+			progress(downloaded.Load(), int64(hdr.totalPlainLen))
+		}
+	})
+}
+
+// verifyAssembledFile recomputes the integrity tag by rereading the written
+// file. Parallel and resumed downloads use it because their chunks do not
+// pass through the hasher in stream order.
+func verifyAssembledFile(out *os.File, secure bool, key []byte, keyVersion, hashAlgo byte, checksum, signerPub, signature []byte, verifySigner string) error {
+	var hasher hash.Hash
+	if secure {
+		hasher = sha256.New()
+	} else {
+		hasher = protocol.NewIntegrityHasherAlgo(key, keyVersion, hashAlgo)
+	}
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("reread file: %w", err)
+	}
+	if _, err := io.Copy(hasher, out); err != nil {
+		return fmt.Errorf("reread file: %w", err)
+	}
+	if !protocol.ChecksumEqual(hasher.Sum(nil), checksum) {
+		if secure {
+			return fmt.Errorf("%w – wrong key or corrupted data", ErrChecksumMismatch)
+		}
+		return fmt.Errorf("%w – wrong code or corrupted data", ErrChecksumMismatch)
+	}
+	return protocol.VerifyUploadSignature(signerPub, signature, checksum, verifySigner)
+}
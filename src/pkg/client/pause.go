@@ -0,0 +1,96 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Interactive flow control for the transfer commands: while a long send or
+// get is running on a terminal, p pauses the chunk loop, r resumes it and q
+// aborts through the same path as Ctrl-C. Pausing simply stops pulling the
+// next chunk – the connection stays open, TCP backpressure idles the peer,
+// and the server keeps no timer on transfer reads – so a 90%-complete
+// upload survives the user freeing their uplink for a while.
+var (
+	pauseMu     sync.Mutex
+	pauseCond   = sync.NewCond(&pauseMu)
+	paused      bool
+	keysRunning bool
+)
+
+// waitIfPaused blocks the calling chunk loop for as long as the transfer is
+// paused. It is called once per chunk, so pause takes effect within one
+// chunk of being requested.
+func waitIfPaused() {
+	pauseMu.Lock()
+	for paused {
+		pauseCond.Wait()
+	}
+	pauseMu.Unlock()
+}
+
+func setPaused(p bool) {
+	pauseMu.Lock()
+	changed := paused != p
+	paused = p
+	pauseMu.Unlock()
+	if !changed {
+		return
+	}
+	if p {
+		fmt.Fprint(os.Stderr, "\npaused – press r to resume, q to abort\n")
+	} else {
+		fmt.Fprint(os.Stderr, "resumed\n")
+	}
+	pauseCond.Broadcast()
+}
+
+// StartTransferKeys begins listening for the p/r/q transfer keys on stdin.
+// It is a no-op when stdin is not a terminal (piped input must not be
+// consumed as key presses). The returned restore function puts the
+// terminal back into its normal mode and must run before the command
+// prompts for anything else or exits.
+func StartTransferKeys() (restore func()) {
+	fi, err := os.Stdin.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return func() {}
+	}
+	pauseMu.Lock()
+	already := keysRunning
+	keysRunning = true
+	pauseMu.Unlock()
+	if already {
+		return func() {}
+	}
+	restore, raw := enableRawInput(os.Stdin)
+	if raw {
+		fmt.Fprintln(os.Stderr, "info: keys: p = pause, r = resume, s = status, q = abort")
+	} else {
+		// No raw mode on this platform: keys still work but need Enter.
+		fmt.Fprintln(os.Stderr, "info: keys (press Enter after): p = pause, r = resume, s = status, q = abort")
+	}
+	go readTransferKeys(restore)
+	return restore
+}
+
+func readTransferKeys(restore func()) {
+	buf := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil || n == 0 {
+			return
+		}
+		switch buf[0] {
+		case 'p', 'P':
+			setPaused(true)
+		case 'r', 'R':
+			setPaused(false)
+		case 's', 'S':
+			printStatusSnapshot()
+		case 'q', 'Q':
+			restore()
+			abortTransfer("aborted")
+		}
+	}
+}
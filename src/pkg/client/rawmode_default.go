@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package client
+
+import "os"
+
+// enableRawInput is a no-op on platforms without termios support wired up;
+// the transfer keys still work, but each needs Enter after it.
+func enableRawInput(f *os.File) (restore func(), ok bool) {
+	return func() {}, false
+}
@@ -0,0 +1,32 @@
+//go:build linux
+// +build linux
+
+package client
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// enableRawInput turns off canonical mode and echo on f, so the transfer
+// keys act on the key press instead of waiting for Enter. The returned
+// function restores the previous terminal settings; ok reports whether raw
+// mode actually took effect.
+func enableRawInput(f *os.File) (restore func(), ok bool) {
+	fd := f.Fd()
+	var old syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCGETS, uintptr(unsafe.Pointer(&old))); errno != 0 {
+		return func() {}, false
+	}
+	raw := old
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(&raw))); errno != 0 {
+		return func() {}, false
+	}
+	return func() {
+		syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(&old)))
+	}, true
+}
@@ -0,0 +1,332 @@
+// Selective download (tcpraw get <code> -only <pattern>): read the manifest
+// entry of a bundle sent with -manifest, match its paths against a glob,
+// and fetch only the chunk ranges covering the matched entries over the
+// range protocol. Every fetched chunk authenticates on its own — AEAD with
+// the chunk index in the AAD, plus the keyed digest frame — so skipping the
+// rest of the bundle costs nothing in integrity; only the whole-bundle
+// checksum goes unchecked. Consecutive matched entries share one
+// connection, so a glob over a directory of small files does not open a
+// socket (and spend a rate-limit token) per file.
+package client
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+
+	"tcpraw/pkg/protocol"
+)
+
+func RunClientGetOnly(code, pattern, outDir, identity string) error {
+	if !protocol.ValidCode(code) {
+		return fmt.Errorf("code must be 6 digits")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("bad -only pattern %q: %w", pattern, err)
+	}
+	serverID := int(code[0] - '0')
+	addrs, err := protocol.FetchServerList()
+	if err != nil {
+		return fmt.Errorf("fetch server list: %w", err)
+	}
+	if addrs[serverID] == "" {
+		return fmt.Errorf("server %d not in list", serverID)
+	}
+
+	probe, pbr, status, err := openRange(addrs[serverID], code, 0, 0)
+	if err != nil {
+		return err
+	}
+	switch status {
+	case protocol.StatusOK:
+	case protocol.StatusNotFound:
+		probe.Close()
+		return ErrNotFound
+	case protocol.StatusRedirect:
+		probe.Close()
+		return fmt.Errorf("this code has moved to another server; fetch the whole bundle with tcpraw get")
+	default:
+		probe.Close()
+		return fmt.Errorf("server cannot serve chunk ranges for this code (old server or non-chunked upload)")
+	}
+	hdr, err := readRangeHeader(pbr)
+	probe.Close()
+	if err != nil {
+		return err
+	}
+	if hdr.secure {
+		return fmt.Errorf("secure uploads cannot be fetched selectively")
+	}
+	fmt.Fprintln(os.Stderr, "info: decrypting with your code...")
+	key, err := protocol.ResolveTransferKey(code, hdr.keyVersion, hdr.kdfSalt, identity)
+	if err != nil {
+		return fmt.Errorf("derive key: %w", err)
+	}
+	rb := &rangeBundle{addr: addrs[serverID], code: code, key: key, hdr: hdr}
+
+	m, dataStart, err := rb.readManifest()
+	if err != nil {
+		return err
+	}
+	matched := make([]bool, len(m.Entries))
+	var count int
+	var selected int64
+	for i, e := range m.Entries {
+		if matchBundleEntry(pattern, e.Name) {
+			matched[i] = true
+			count++
+			selected += e.Size
+		}
+	}
+	if count == 0 {
+		return fmt.Errorf("no bundle entries match %q (tcpraw ls %s shows what is inside)", pattern, code)
+	}
+	fmt.Fprintf(os.Stderr, "info: %d of %d entries match (%s of %s)\n",
+		count, len(m.Entries), protocol.FormatBytes(float64(selected)), protocol.FormatBytes(float64(hdr.totalPlainLen)))
+
+	// Pull each run of consecutive matched entries over one connection.
+	for i := 0; i < len(m.Entries); {
+		if !matched[i] {
+			i++
+			continue
+		}
+		j := i
+		for j < len(m.Entries) && matched[j] {
+			j++
+		}
+		absStart := dataStart + m.Entries[i].Offset
+		absEnd := int64(hdr.totalPlainLen)
+		if j < len(m.Entries) {
+			absEnd = dataStart + m.Entries[j].Offset
+		}
+		if err := rb.extractRun(absStart, absEnd, outDir); err != nil {
+			return err
+		}
+		i = j
+	}
+	fmt.Printf("Downloaded %d of %d bundle entries into %s\n", count, len(m.Entries), Green(outDir))
+	return nil
+}
+
+// matchBundleEntry matches a glob against an archived path. The archive
+// prefixes every path with the packed directory's name, so the pattern also
+// tries the path with that first segment stripped, and a bare filename
+// pattern matches basenames anywhere in the tree.
+func matchBundleEntry(pattern, name string) bool {
+	if ok, _ := path.Match(pattern, name); ok {
+		return true
+	}
+	if _, rest, found := strings.Cut(name, "/"); found {
+		if ok, _ := path.Match(pattern, rest); ok {
+			return true
+		}
+	}
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return false
+}
+
+// rangeBundle is one selective download: the blob layout from the probe and
+// the chunk stride, learned from the first fetched chunk.
+type rangeBundle struct {
+	addr, code string
+	key        []byte
+	hdr        *rangeHeader
+	chunkLen   int64
+}
+
+// openStream requests chunks [start, start+count) and returns a reader over
+// their plaintext.
+func (rb *rangeBundle) openStream(start, count uint32) (*chunkStream, error) {
+	conn, br, status, err := openRange(rb.addr, rb.code, start, count)
+	if err != nil {
+		return nil, err
+	}
+	if status != protocol.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("server error (status %d)", status)
+	}
+	h, err := readRangeHeader(br)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if h.numChunks != rb.hdr.numChunks {
+		conn.Close()
+		return nil, fmt.Errorf("blob changed between connections")
+	}
+	return &chunkStream{rb: rb, conn: conn, br: br, next: start, end: start + count}, nil
+}
+
+// chunkStream decrypts a contiguous chunk range into a byte stream.
+type chunkStream struct {
+	rb     *rangeBundle
+	conn   net.Conn
+	br     *bufio.Reader
+	next   uint32
+	end    uint32
+	nonce  [12]byte
+	sealed []byte
+	buf    []byte
+	off    int
+}
+
+func (cs *chunkStream) Read(p []byte) (int, error) {
+	for cs.off == len(cs.buf) {
+		if cs.next == cs.end {
+			return 0, io.EOF
+		}
+		hdr := cs.rb.hdr
+		i := cs.next
+		var err error
+		cs.sealed, err = protocol.ReadChunkInto(cs.br, cs.nonce[:], cs.sealed)
+		if err != nil {
+			return 0, fmt.Errorf("read chunk %d: %w", i, err)
+		}
+		var pt []byte
+		if protocol.ChunkStreamAAD(hdr.keyVersion) {
+			pt, err = protocol.DecryptChunkStream(cs.rb.key, uint64(i), i == hdr.numChunks-1, cs.nonce[:], cs.sealed)
+		} else {
+			pt, err = protocol.DecryptWithKey(cs.rb.key, cs.nonce[:], cs.sealed)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("decrypt chunk %d: %w", i, err)
+		}
+		if hdr.chunkSums != nil && !protocol.VerifyChunkSum(cs.rb.key, uint64(i), pt, hdr.chunkSums[int64(i)*protocol.ChunkSumSize:int64(i+1)*protocol.ChunkSumSize]) {
+			return 0, fmt.Errorf("%w – chunk %d failed its checksum", ErrChecksumMismatch, i)
+		}
+		if cs.rb.chunkLen == 0 && i == 0 {
+			cs.rb.chunkLen = int64(len(pt))
+		}
+		cs.buf, cs.off = pt, 0
+		cs.next = i + 1
+	}
+	n := copy(p, cs.buf[cs.off:])
+	cs.off += n
+	return n, nil
+}
+
+func (cs *chunkStream) Close() error { return cs.conn.Close() }
+
+// readManifest fetches the first chunk, reads the manifest entry that must
+// lead a bundle, and returns it with the data section's plaintext offset.
+// Fetching chunk 0 also fixes the chunk stride for the range arithmetic.
+func (rb *rangeBundle) readManifest() (*bundleManifest, int64, error) {
+	cs, err := rb.openStream(0, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	notBundle := fmt.Errorf("this code is not a manifest bundle (only directories sent with -manifest can be inspected)")
+	tr := tar.NewReader(cs)
+	hdr, err := tr.Next()
+	if err != nil {
+		cs.Close()
+		return nil, 0, notBundle
+	}
+	if hdr.Name != manifestEntryName {
+		cs.Close()
+		return nil, 0, notBundle
+	}
+	if hdr.Size <= 0 || hdr.Size > maxManifestLen {
+		cs.Close()
+		return nil, 0, fmt.Errorf("manifest entry has unreasonable size %d", hdr.Size)
+	}
+	payload := make([]byte, hdr.Size)
+	n, err := io.ReadFull(tr, payload)
+	cs.Close()
+	if err != nil {
+		if !errors.Is(err, io.ErrUnexpectedEOF) && err != io.EOF {
+			return nil, 0, fmt.Errorf("read manifest: %w", err)
+		}
+		// The manifest runs past the first chunk; fetch the rest of the
+		// chunks it spans.
+		end := uint32((manifestDataStart(hdr.Size)-1)/rb.chunkLen) + 1
+		rest, err := rb.openStream(1, end-1)
+		if err != nil {
+			return nil, 0, err
+		}
+		_, err = io.ReadFull(rest, payload[n:])
+		rest.Close()
+		if err != nil {
+			return nil, 0, fmt.Errorf("read manifest: %w", err)
+		}
+	}
+	var m bundleManifest
+	if err := json.Unmarshal(payload, &m); err != nil {
+		return nil, 0, fmt.Errorf("parse manifest: %w", err)
+	}
+	if len(m.Entries) == 0 {
+		return nil, 0, fmt.Errorf("manifest bundle is empty")
+	}
+	return &m, manifestDataStart(hdr.Size), nil
+}
+
+// extractRun streams the plaintext range [absStart, absEnd) — whole tar
+// entries by construction — and extracts each into destDir with the same
+// path safety rules as ExtractTarGz.
+func (rb *rangeBundle) extractRun(absStart, absEnd int64, destDir string) error {
+	start := uint32(absStart / rb.chunkLen)
+	end := uint32((absEnd-1)/rb.chunkLen) + 1
+	cs, err := rb.openStream(start, end-start)
+	if err != nil {
+		return err
+	}
+	defer cs.Close()
+	if skip := absStart - int64(start)*rb.chunkLen; skip > 0 {
+		if _, err := io.CopyN(io.Discard, cs, skip); err != nil {
+			return fmt.Errorf("skip to entry: %w", err)
+		}
+	}
+	tr := tar.NewReader(io.LimitReader(cs, absEnd-absStart))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read bundle entry: %w", err)
+		}
+		// Safe path: no leading slash or ".." escaping, NFC like ExtractTarGz.
+		name := filepath.Clean(norm.NFC.String(hdr.Name))
+		if name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			continue
+		}
+		target := filepath.Join(destDir, name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return fmt.Errorf("mkdir %s: %w", target, err)
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode)&0777)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tr)
+			out.Close()
+			if err != nil {
+				return fmt.Errorf("write %s: %w", target, err)
+			}
+			fmt.Fprintf(os.Stderr, "  %s (%s)\n", name, protocol.FormatBytes(float64(hdr.Size)))
+		default:
+			// Links may point at entries outside the selection; a partial
+			// extraction cannot honour them.
+			fmt.Fprintf(os.Stderr, "warning: skipping %s (not a regular file)\n", name)
+		}
+	}
+}
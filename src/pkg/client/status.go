@@ -0,0 +1,136 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"tcpraw/pkg/protocol"
+)
+
+// On-demand status snapshots for long transfers: SIGUSR1 (and SIGINFO
+// where the platform has it, i.e. Ctrl-T) or the s transfer key print a
+// detailed multi-line report – bytes done, current and average rate, ETA,
+// chunk position, server address – on its own lines, so the one-line
+// progress display keeps working. Handy for transfers running inside
+// tmux/screen: `kill -USR1 $(pidof tcpraw)` from another window.
+var (
+	statusMu   sync.Mutex
+	xferStatus struct {
+		verb      string // "upload" or "download"
+		addr      string
+		chunk     uint32
+		numChunks uint32
+		done      int64
+		total     int64
+		start     time.Time
+		prevDone  int64 // rate sample at least a second old, for the
+		prevTime  time.Time
+		lastDone  int64 // "now" rate; the average uses start instead
+		lastTime  time.Time
+	}
+)
+
+// beginStatus resets the snapshot state at the start of a transfer and
+// arms the status signal handler.
+func beginStatus(verb, addr string, total int64, numChunks uint32) {
+	statusMu.Lock()
+	xferStatus.verb = verb
+	xferStatus.addr = addr
+	xferStatus.chunk = 0
+	xferStatus.numChunks = numChunks
+	xferStatus.done = 0
+	xferStatus.total = total
+	xferStatus.start = time.Now()
+	xferStatus.prevDone, xferStatus.prevTime = 0, xferStatus.start
+	xferStatus.lastDone, xferStatus.lastTime = 0, xferStatus.start
+	statusMu.Unlock()
+	watchStatusSignals()
+}
+
+// updateStatus records progress; called from the same closures that draw
+// the progress line.
+func updateStatus(done, total int64) {
+	now := time.Now()
+	statusMu.Lock()
+	if xferStatus.start.IsZero() {
+		xferStatus.start = now
+		xferStatus.prevTime, xferStatus.lastTime = now, now
+	}
+	xferStatus.done = done
+	xferStatus.total = total
+	if now.Sub(xferStatus.lastTime) >= time.Second {
+		xferStatus.prevDone, xferStatus.prevTime = xferStatus.lastDone, xferStatus.lastTime
+		xferStatus.lastDone, xferStatus.lastTime = done, now
+	}
+	statusMu.Unlock()
+}
+
+func advanceStatusChunk() {
+	statusMu.Lock()
+	xferStatus.chunk++
+	statusMu.Unlock()
+}
+
+// printStatusSnapshot writes the report to stderr, starting on a fresh
+// line so the \r-based progress display is not disturbed.
+func printStatusSnapshot() {
+	statusMu.Lock()
+	s := xferStatus
+	statusMu.Unlock()
+	if s.start.IsZero() {
+		fmt.Fprintln(os.Stderr, "\nstatus: no transfer in flight")
+		return
+	}
+	elapsed := time.Since(s.start).Seconds()
+	var avg float64
+	if elapsed > 0.001 {
+		avg = float64(s.done) / elapsed
+	}
+	cur := avg
+	if dt := time.Since(s.prevTime).Seconds(); dt > 0.001 && s.done > s.prevDone {
+		cur = float64(s.done-s.prevDone) / dt
+	}
+	fmt.Fprintf(os.Stderr, "\nstatus: %s\n", describeTransfer(s.verb, s.addr))
+	if s.total > 0 {
+		fmt.Fprintf(os.Stderr, "  done:  %s / %s (%.1f%%)\n", protocol.FormatBytes(float64(s.done)), protocol.FormatBytes(float64(s.total)), 100*float64(s.done)/float64(s.total))
+	} else {
+		fmt.Fprintf(os.Stderr, "  done:  %s\n", protocol.FormatBytes(float64(s.done)))
+	}
+	if s.numChunks > 0 {
+		fmt.Fprintf(os.Stderr, "  chunk: %d / %d\n", s.chunk, s.numChunks)
+	}
+	fmt.Fprintf(os.Stderr, "  rate:  %s/s now, %s/s average\n", protocol.FormatBytes(cur), protocol.FormatBytes(avg))
+	if remaining := s.total - s.done; remaining > 0 && cur > 0 {
+		fmt.Fprintf(os.Stderr, "  eta:   %s\n", (time.Duration(float64(remaining)/cur) * time.Second).Round(time.Second))
+	}
+}
+
+func describeTransfer(verb, addr string) string {
+	switch {
+	case verb == "upload" && addr != "":
+		return "upload to " + addr
+	case verb == "download" && addr != "":
+		return "download from " + addr
+	case verb != "":
+		return verb
+	}
+	return "transfer"
+}
+
+var statusSignalOnce sync.Once
+
+func watchStatusSignals() {
+	statusSignalOnce.Do(func() {
+		ch := make(chan os.Signal, 1)
+		if !notifyStatusSignals(ch) {
+			return
+		}
+		go func() {
+			for range ch {
+				printStatusSnapshot()
+			}
+		}()
+	})
+}
@@ -0,0 +1,17 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package client
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyStatusSignals subscribes ch to the platform's status signals:
+// SIGINFO (what the terminal sends for Ctrl-T) and SIGUSR1.
+func notifyStatusSignals(ch chan os.Signal) bool {
+	signal.Notify(ch, syscall.SIGINFO, syscall.SIGUSR1)
+	return true
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package client
+
+import "os"
+
+// notifyStatusSignals is a no-op where neither SIGUSR1 nor SIGINFO exist
+// (Windows); the s transfer key still prints the snapshot there.
+func notifyStatusSignals(ch chan os.Signal) bool {
+	return false
+}
@@ -0,0 +1,17 @@
+//go:build linux
+// +build linux
+
+package client
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyStatusSignals subscribes ch to the platform's status signals.
+// Linux has no SIGINFO, so only SIGUSR1 is wired up.
+func notifyStatusSignals(ch chan os.Signal) bool {
+	signal.Notify(ch, syscall.SIGUSR1)
+	return true
+}
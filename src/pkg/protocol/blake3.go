@@ -0,0 +1,311 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+	"runtime"
+	"sync"
+)
+
+// BLAKE3 (256-bit output, sequential and keyed modes), implemented here
+// because the module deliberately keeps its dependency list to x/crypto and
+// friends. The tree structure is what makes it interesting for tcpraw: a
+// memory-mapped file can be hashed as independent subtrees on every core,
+// which is where the double-read send path spends its time on big files.
+// Only the parts tcpraw needs are implemented: 32-byte digests, plain and
+// keyed; no XOF, no key derivation mode.
+
+const (
+	blake3BlockLen = 64
+	blake3ChunkLen = 1024
+
+	flagChunkStart uint32 = 1 << 0
+	flagChunkEnd   uint32 = 1 << 1
+	flagParent     uint32 = 1 << 2
+	flagRoot       uint32 = 1 << 3
+	flagKeyedHash  uint32 = 1 << 4
+)
+
+var blake3IV = [8]uint32{
+	0x6A09E667, 0xBB67AE85, 0x3C6EF372, 0xA54FF53A,
+	0x510E527F, 0x9B05688C, 0x1F83D9AB, 0x5BE0CD19,
+}
+
+// blake3Perm is the message word permutation applied between rounds.
+var blake3Perm = [16]int{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8}
+
+func blake3G(s *[16]uint32, a, b, c, d int, mx, my uint32) {
+	s[a] += s[b] + mx
+	s[d] = bits.RotateLeft32(s[d]^s[a], -16)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -12)
+	s[a] += s[b] + my
+	s[d] = bits.RotateLeft32(s[d]^s[a], -8)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -7)
+}
+
+func blake3Compress(cv *[8]uint32, block *[16]uint32, counter uint64, blockLen, flags uint32) [16]uint32 {
+	s := [16]uint32{
+		cv[0], cv[1], cv[2], cv[3], cv[4], cv[5], cv[6], cv[7],
+		blake3IV[0], blake3IV[1], blake3IV[2], blake3IV[3],
+		uint32(counter), uint32(counter >> 32), blockLen, flags,
+	}
+	m := *block
+	for round := 0; ; round++ {
+		blake3G(&s, 0, 4, 8, 12, m[0], m[1])
+		blake3G(&s, 1, 5, 9, 13, m[2], m[3])
+		blake3G(&s, 2, 6, 10, 14, m[4], m[5])
+		blake3G(&s, 3, 7, 11, 15, m[6], m[7])
+		blake3G(&s, 0, 5, 10, 15, m[8], m[9])
+		blake3G(&s, 1, 6, 11, 12, m[10], m[11])
+		blake3G(&s, 2, 7, 8, 13, m[12], m[13])
+		blake3G(&s, 3, 4, 9, 14, m[14], m[15])
+		if round == 6 {
+			break
+		}
+		var p [16]uint32
+		for i, j := range blake3Perm {
+			p[i] = m[j]
+		}
+		m = p
+	}
+	for i := 0; i < 8; i++ {
+		s[i] ^= s[i+8]
+		s[i+8] ^= cv[i]
+	}
+	return s
+}
+
+func blake3BlockWords(block []byte) (w [16]uint32) {
+	for i := range w {
+		w[i] = binary.LittleEndian.Uint32(block[4*i:])
+	}
+	return w
+}
+
+// blake3Output is a deferred final compression: the same node is compressed
+// without the ROOT flag when it is an interior chaining value and with it
+// when it turns out to be the root, so finalization keeps both options open.
+type blake3Output struct {
+	inputCV  [8]uint32
+	block    [16]uint32
+	counter  uint64
+	blockLen uint32
+	flags    uint32
+}
+
+func (o *blake3Output) chainingValue() (cv [8]uint32) {
+	s := blake3Compress(&o.inputCV, &o.block, o.counter, o.blockLen, o.flags)
+	copy(cv[:], s[:8])
+	return cv
+}
+
+func (o *blake3Output) rootSum(out []byte) {
+	s := blake3Compress(&o.inputCV, &o.block, 0, o.blockLen, o.flags|flagRoot)
+	for i := 0; i < 8; i++ {
+		binary.LittleEndian.PutUint32(out[4*i:], s[i])
+	}
+}
+
+func blake3ParentOutput(left, right, key *[8]uint32, flags uint32) blake3Output {
+	o := blake3Output{inputCV: *key, counter: 0, blockLen: blake3BlockLen, flags: flags | flagParent}
+	copy(o.block[:8], left[:])
+	copy(o.block[8:], right[:])
+	return o
+}
+
+func blake3ParentCV(left, right, key *[8]uint32, flags uint32) [8]uint32 {
+	o := blake3ParentOutput(left, right, key, flags)
+	return o.chainingValue()
+}
+
+// blake3Chunk hashes one 1024-byte chunk of input block by block.
+type blake3Chunk struct {
+	cv       [8]uint32
+	counter  uint64
+	block    [blake3BlockLen]byte
+	blockLen int
+	blocks   int
+	flags    uint32
+}
+
+func newBlake3Chunk(key *[8]uint32, counter uint64, flags uint32) blake3Chunk {
+	return blake3Chunk{cv: *key, counter: counter, flags: flags}
+}
+
+func (c *blake3Chunk) len() int {
+	return c.blocks*blake3BlockLen + c.blockLen
+}
+
+func (c *blake3Chunk) startFlag() uint32 {
+	if c.blocks == 0 {
+		return flagChunkStart
+	}
+	return 0
+}
+
+func (c *blake3Chunk) update(p []byte) {
+	for len(p) > 0 {
+		if c.blockLen == blake3BlockLen {
+			w := blake3BlockWords(c.block[:])
+			s := blake3Compress(&c.cv, &w, c.counter, blake3BlockLen, c.flags|c.startFlag())
+			copy(c.cv[:], s[:8])
+			c.blocks++
+			c.blockLen = 0
+		}
+		n := copy(c.block[c.blockLen:], p)
+		c.blockLen += n
+		p = p[n:]
+	}
+}
+
+func (c *blake3Chunk) output() blake3Output {
+	var block [blake3BlockLen]byte
+	copy(block[:], c.block[:c.blockLen])
+	return blake3Output{
+		inputCV:  c.cv,
+		block:    blake3BlockWords(block[:]),
+		counter:  c.counter,
+		blockLen: uint32(c.blockLen),
+		flags:    c.flags | c.startFlag() | flagChunkEnd,
+	}
+}
+
+// blake3Hasher is the sequential hash.Hash: chunks feed a binary tree whose
+// incomplete right spine lives on a small stack of chaining values.
+type blake3Hasher struct {
+	key      [8]uint32
+	flags    uint32
+	chunk    blake3Chunk
+	stack    [64][8]uint32
+	stackLen int
+}
+
+// NewBlake3 returns a 32-byte BLAKE3 hash.
+func NewBlake3() hash.Hash {
+	h := &blake3Hasher{key: blake3IV}
+	h.Reset()
+	return h
+}
+
+// NewBlake3Keyed returns BLAKE3 in keyed mode; key must be 32 bytes.
+func NewBlake3Keyed(key []byte) hash.Hash {
+	h := &blake3Hasher{key: blake3KeyWords(key), flags: flagKeyedHash}
+	h.Reset()
+	return h
+}
+
+func blake3KeyWords(key []byte) (w [8]uint32) {
+	for i := range w {
+		w[i] = binary.LittleEndian.Uint32(key[4*i:])
+	}
+	return w
+}
+
+func (h *blake3Hasher) Reset() {
+	h.chunk = newBlake3Chunk(&h.key, 0, h.flags)
+	h.stackLen = 0
+}
+
+func (h *blake3Hasher) Size() int      { return 32 }
+func (h *blake3Hasher) BlockSize() int { return blake3BlockLen }
+
+func (h *blake3Hasher) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if h.chunk.len() == blake3ChunkLen {
+			o := h.chunk.output()
+			cv := o.chainingValue()
+			total := h.chunk.counter + 1
+			// A finished subtree of 2^k chunks has k completed levels:
+			// merge one stack entry per trailing zero bit.
+			for t := total; t&1 == 0; t >>= 1 {
+				h.stackLen--
+				cv = blake3ParentCV(&h.stack[h.stackLen], &cv, &h.key, h.flags)
+			}
+			h.stack[h.stackLen] = cv
+			h.stackLen++
+			h.chunk = newBlake3Chunk(&h.key, total, h.flags)
+		}
+		take := blake3ChunkLen - h.chunk.len()
+		if take > len(p) {
+			take = len(p)
+		}
+		h.chunk.update(p[:take])
+		p = p[take:]
+	}
+	return n, nil
+}
+
+func (h *blake3Hasher) Sum(b []byte) []byte {
+	o := h.chunk.output()
+	for i := h.stackLen - 1; i >= 0; i-- {
+		cv := o.chainingValue()
+		o = blake3ParentOutput(&h.stack[i], &cv, &h.key, h.flags)
+	}
+	var sum [32]byte
+	o.rootSum(sum[:])
+	return append(b, sum[:]...)
+}
+
+// Blake3SumParallel hashes an in-memory (typically mmap'd) buffer using all
+// cores, splitting the BLAKE3 tree into per-goroutine subtrees. A non-nil
+// key selects keyed mode and must be 32 bytes. The digest is identical to
+// the sequential hasher's.
+func Blake3SumParallel(data, key []byte) []byte {
+	kw := blake3IV
+	var flags uint32
+	if key != nil {
+		kw = blake3KeyWords(key)
+		flags = flagKeyedHash
+	}
+	o := blake3Subtree(data, 0, &kw, flags, parallelHashDepth())
+	var sum [32]byte
+	o.rootSum(sum[:])
+	return sum[:]
+}
+
+// parallelHashDepth bounds goroutine fan-out to roughly the core count.
+func parallelHashDepth() int {
+	depth := 0
+	for n := 1; n < runtime.NumCPU(); n <<= 1 {
+		depth++
+	}
+	return depth + 1
+}
+
+// blake3Subtree computes the output node for data starting at the given
+// chunk counter. Above the spawn depth the left and right halves run
+// concurrently; the split point keeps the left subtree a complete tree
+// (largest power-of-two chunk count below the total), as the tree layout
+// requires.
+func blake3Subtree(data []byte, chunkCounter uint64, key *[8]uint32, flags uint32, depth int) blake3Output {
+	if len(data) <= blake3ChunkLen {
+		c := newBlake3Chunk(key, chunkCounter, flags)
+		c.update(data)
+		return c.output()
+	}
+	fullChunks := uint64(len(data)-1) / blake3ChunkLen
+	split := blake3ChunkLen << (bits.Len64(fullChunks) - 1)
+	var leftCV, rightCV [8]uint32
+	if depth > 0 {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			o := blake3Subtree(data[:split], chunkCounter, key, flags, depth-1)
+			leftCV = o.chainingValue()
+		}()
+		o := blake3Subtree(data[split:], chunkCounter+uint64(split)/blake3ChunkLen, key, flags, depth-1)
+		rightCV = o.chainingValue()
+		wg.Wait()
+	} else {
+		o := blake3Subtree(data[:split], chunkCounter, key, flags, 0)
+		leftCV = o.chainingValue()
+		o = blake3Subtree(data[split:], chunkCounter+uint64(split)/blake3ChunkLen, key, flags, 0)
+		rightCV = o.chainingValue()
+	}
+	return blake3ParentOutput(&leftCV, &rightCV, key, flags)
+}
@@ -0,0 +1,131 @@
+package protocol
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client-side disk cache for the server address list and the last probe
+// winner, so scripted invocations in a loop don't re-fetch the list (or
+// re-probe all ten servers) every run. Entries expire on a short TTL;
+// -refresh skips the cache entirely. Everything here is best-effort: any
+// cache failure just means the normal fetch/probe path runs.
+
+var RefreshCache bool // set by the -refresh flag
+
+const (
+	listCacheTTL  = 5 * time.Minute
+	probeCacheTTL = 1 * time.Minute
+)
+
+// CacheFilePath returns the path for name inside the per-user tcpraw cache
+// directory, creating the directory as needed. The client also keeps its
+// benchmark history here.
+func CacheFilePath(name string) (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(base, "tcpraw")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// readCachedLines returns the cached lines for name, or nil when the entry
+// is missing, older than ttl, or the user asked for -refresh.
+func readCachedLines(name string, ttl time.Duration) []string {
+	if RefreshCache {
+		return nil
+	}
+	path, err := CacheFilePath(name)
+	if err != nil {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) > ttl {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+}
+
+func writeCachedLines(name string, lines []string) {
+	path, err := CacheFilePath(name)
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+}
+
+// cachedServerList returns a recently fetched address list, or nil.
+func cachedServerList() []string {
+	lines := readCachedLines("servers", listCacheTTL)
+	if len(lines) != 10 {
+		return nil
+	}
+	return lines
+}
+
+func saveServerListCache(addrs []string) {
+	if len(addrs) != 10 {
+		return
+	}
+	writeCachedLines("servers", addrs)
+}
+
+// DropServerListCache discards the cached address list so the next
+// FetchServerList re-fetches it (server config reload).
+func DropServerListCache() {
+	path, err := CacheFilePath("servers")
+	if err != nil {
+		return
+	}
+	_ = os.Remove(path)
+}
+
+// cachedProbeWinner returns the server that won the last probe round, if the
+// result is still fresh.
+func cachedProbeWinner() (id int, addr string, ok bool) {
+	lines := readCachedLines("probe", probeCacheTTL)
+	if len(lines) != 1 {
+		return 0, "", false
+	}
+	idStr, a, found := strings.Cut(lines[0], " ")
+	if !found {
+		return 0, "", false
+	}
+	n, err := strconv.Atoi(idStr)
+	if err != nil || n < 0 || n > 9 || a == "" {
+		return 0, "", false
+	}
+	return n, a, true
+}
+
+func SaveProbeWinnerCache(id int, addr string) {
+	writeCachedLines("probe", []string{fmt.Sprintf("%d %s", id, addr)})
+}
+
+// DialCachedProbeWinner tries the cached probe winner; any failure falls
+// through to a full probe round.
+func DialCachedProbeWinner() (net.Conn, int, bool) {
+	id, addr, ok := cachedProbeWinner()
+	if !ok {
+		return nil, 0, false
+	}
+	conn, err := DialServer(addr, DialTimeout)
+	if err != nil {
+		return nil, 0, false
+	}
+	fmt.Printf("info: reusing server %d from last probe (use -refresh to re-probe)\n", id)
+	return conn, id, true
+}
@@ -0,0 +1,75 @@
+package protocol
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Check wire format (MsgCheck). After the message type and code the server
+// answers with a status byte — StatusCorrupt when the stored payload fails
+// the same framing validation the offline verify pass runs — and, on
+// success, a small report:
+//
+//	nameLen (2) | name | totalPlainLen (8) | numChunks (4) |
+//	remainingSec (4) | sealedDigest (32)
+//
+// sealedDigest is SHA-256 over the sealed payload exactly as stored, so two
+// checks of the same code (or of mirrored servers) can be compared without
+// transferring the payload itself.
+
+// WriteCheckReport sends the check report (server side).
+func WriteCheckReport(w io.Writer, name string, totalPlainLen uint64, numChunks uint32, remainingSec uint32, sealedDigest []byte) error {
+	nameBytes := []byte(name)
+	if len(nameBytes) > MaxWireNameLen {
+		nameBytes = nameBytes[:MaxWireNameLen]
+	}
+	if err := binary.Write(w, binary.BigEndian, uint16(len(nameBytes))); err != nil {
+		return err
+	}
+	if _, err := w.Write(nameBytes); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, totalPlainLen); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, numChunks); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, remainingSec); err != nil {
+		return err
+	}
+	_, err := w.Write(sealedDigest)
+	return err
+}
+
+// ReadCheckReport reads the check report (client side).
+func ReadCheckReport(r io.Reader) (name string, totalPlainLen uint64, numChunks uint32, remainingSec uint32, sealedDigest []byte, err error) {
+	var nameLen uint16
+	if err = binary.Read(r, binary.BigEndian, &nameLen); err != nil {
+		return
+	}
+	if err = checkNameLen(nameLen); err != nil {
+		return
+	}
+	nameBuf := make([]byte, nameLen)
+	if _, err = io.ReadFull(r, nameBuf); err != nil {
+		return
+	}
+	name = string(nameBuf)
+	if err = binary.Read(r, binary.BigEndian, &totalPlainLen); err != nil {
+		return
+	}
+	if err = binary.Read(r, binary.BigEndian, &numChunks); err != nil {
+		return
+	}
+	if err = binary.Read(r, binary.BigEndian, &remainingSec); err != nil {
+		return
+	}
+	sealedDigest = make([]byte, sha256.Size)
+	if _, err = io.ReadFull(r, sealedDigest); err != nil {
+		err = fmt.Errorf("read sealed digest: %w", err)
+	}
+	return
+}
@@ -0,0 +1,200 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Delta update wire format (MsgDeltaUpload). A sender who re-transfers a
+// changed file — VM images, database dumps — asks the server for the stored
+// blob's signature (key version, salt, chunk layout and the keyed per-chunk
+// digests the header already carries), re-derives the transfer key from the
+// code, compares digests chunk by chunk and uploads only the chunks that
+// differ. The server splices the replacements into the stored .dat and the
+// code keeps working; unchanged chunks never cross the wire.
+//
+// After the message type and code the server answers with a status byte and,
+// on success, the signature frame:
+//
+//	keyVersion (1) | salt (HeaderSaltSize) | chunkPlainLen (4) |
+//	totalPlainLen (8) | numChunks (4) | gen (4) |
+//	chunkSums (numChunks * ChunkSumSize)
+//
+// gen is the nonce generation the replacement chunks must be sealed with
+// (EncryptChunkStreamGen): one past the blob's current generation, so a
+// re-encrypted index never reuses the (key, nonce) pair of an earlier
+// version of itself.
+//
+// The client replies with the new layout and the replacement chunks, indices
+// strictly ascending:
+//
+//	totalPlainLen (8) | numChunks (4) | checksum (32) |
+//	chunkSums (numChunks * ChunkSumSize) | changed (4)
+//	then per changed chunk: index (4) | nonce (12) | sealedLen (4) | sealed
+//
+// The digests are keyed with the chunk index, so this detects in-place
+// block changes (the common case for the target workloads) but not content
+// that shifts between chunk boundaries; a shifted region simply re-uploads.
+
+// WriteDeltaSignature sends the stored blob's signature frame (server side).
+func WriteDeltaSignature(w io.Writer, keyVersion byte, salt []byte, chunkPlainLen uint32, totalPlainLen uint64, numChunks, gen uint32, chunkSums []byte) error {
+	if _, err := w.Write([]byte{keyVersion}); err != nil {
+		return err
+	}
+	if _, err := w.Write(salt); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, chunkPlainLen); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, totalPlainLen); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, numChunks); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, gen); err != nil {
+		return err
+	}
+	_, err := w.Write(chunkSums)
+	return err
+}
+
+// ReadDeltaSignature reads the signature frame (client side).
+func ReadDeltaSignature(r io.Reader) (keyVersion byte, salt []byte, chunkPlainLen uint32, totalPlainLen uint64, numChunks, gen uint32, chunkSums []byte, err error) {
+	var vb [1]byte
+	if _, err = io.ReadFull(r, vb[:]); err != nil {
+		return
+	}
+	keyVersion = vb[0]
+	if n := HeaderSaltSize(keyVersion); n > 0 {
+		salt = make([]byte, n)
+		if _, err = io.ReadFull(r, salt); err != nil {
+			return
+		}
+	}
+	if err = binary.Read(r, binary.BigEndian, &chunkPlainLen); err != nil {
+		return
+	}
+	if chunkPlainLen == 0 || chunkPlainLen > MaxWireChunkSealed {
+		err = fmt.Errorf("%w: chunk size %d", ErrWireLimit, chunkPlainLen)
+		return
+	}
+	if err = binary.Read(r, binary.BigEndian, &totalPlainLen); err != nil {
+		return
+	}
+	if err = binary.Read(r, binary.BigEndian, &numChunks); err != nil {
+		return
+	}
+	if err = CheckChunkCount(numChunks, totalPlainLen); err != nil {
+		return
+	}
+	// The count sizes the digest allocation below and is only bounded by
+	// the totalPlainLen the server itself declared, so cap it outright
+	// against a hostile server.
+	if numChunks > MaxWireChunkCount {
+		err = fmt.Errorf("%w: %d chunks in signature", ErrWireLimit, numChunks)
+		return
+	}
+	if err = binary.Read(r, binary.BigEndian, &gen); err != nil {
+		return
+	}
+	chunkSums = make([]byte, int64(numChunks)*ChunkSumSize)
+	_, err = io.ReadFull(r, chunkSums)
+	return
+}
+
+// WriteDeltaHeader sends the new blob layout and replacement count (client
+// side).
+func WriteDeltaHeader(w io.Writer, totalPlainLen uint64, numChunks uint32, checksum, chunkSums []byte, changed uint32) error {
+	if err := binary.Write(w, binary.BigEndian, totalPlainLen); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, numChunks); err != nil {
+		return err
+	}
+	if _, err := w.Write(checksum); err != nil {
+		return err
+	}
+	if _, err := w.Write(chunkSums); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, changed)
+}
+
+// ReadDeltaLayout reads the declared new size and chunk count (server
+// side). It deliberately stops there: numChunks sizes the digest block that
+// follows, so the server must bound totalPlainLen against its max blob size
+// and reserve disk before ReadDeltaSums allocates anything — the same
+// declared-size-first order the upload handler uses.
+func ReadDeltaLayout(r io.Reader) (totalPlainLen uint64, numChunks uint32, err error) {
+	if err = binary.Read(r, binary.BigEndian, &totalPlainLen); err != nil {
+		return
+	}
+	if err = binary.Read(r, binary.BigEndian, &numChunks); err != nil {
+		return
+	}
+	err = CheckChunkCount(numChunks, totalPlainLen)
+	return
+}
+
+// ReadDeltaSums reads the checksum, digest block and replacement count that
+// follow the layout (server side); numChunks comes from ReadDeltaLayout and
+// must already be vetted by the caller.
+func ReadDeltaSums(r io.Reader, numChunks uint32) (checksum, chunkSums []byte, changed uint32, err error) {
+	checksum = make([]byte, 32)
+	if _, err = io.ReadFull(r, checksum); err != nil {
+		return
+	}
+	chunkSums = make([]byte, int64(numChunks)*ChunkSumSize)
+	if _, err = io.ReadFull(r, chunkSums); err != nil {
+		return
+	}
+	if err = binary.Read(r, binary.BigEndian, &changed); err != nil {
+		return
+	}
+	if changed == 0 || changed > numChunks {
+		err = fmt.Errorf("%w: %d changed of %d chunks", ErrWireLimit, changed, numChunks)
+	}
+	return
+}
+
+// WriteDeltaChunk sends one replacement chunk record (client side).
+func WriteDeltaChunk(w io.Writer, index uint32, nonce, sealed []byte) error {
+	if err := binary.Write(w, binary.BigEndian, index); err != nil {
+		return err
+	}
+	if _, err := w.Write(nonce); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, uint32(len(sealed))); err != nil {
+		return err
+	}
+	_, err := w.Write(sealed)
+	return err
+}
+
+// ReadDeltaChunk reads one replacement chunk record into nonce and a
+// possibly-reused sealed buffer, like ReadChunkInto (server side).
+func ReadDeltaChunk(r io.Reader, nonce, sealed []byte) (index uint32, out []byte, err error) {
+	if err = binary.Read(r, binary.BigEndian, &index); err != nil {
+		return
+	}
+	if _, err = io.ReadFull(r, nonce); err != nil {
+		return
+	}
+	var sealedLen uint32
+	if err = binary.Read(r, binary.BigEndian, &sealedLen); err != nil {
+		return
+	}
+	if err = checkChunkSealed(sealedLen); err != nil {
+		return
+	}
+	if uint32(cap(sealed)) < sealedLen {
+		sealed = make([]byte, sealedLen)
+	}
+	out = sealed[:sealedLen]
+	_, err = io.ReadFull(r, out)
+	return
+}
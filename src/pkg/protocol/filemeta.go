@@ -0,0 +1,125 @@
+// File metadata carried end to end. Senders on new-enough key versions put
+// the source file's mtime and permission bits in a header frame; get restores
+// them on the downloaded file, so transferred scripts stay executable and
+// timestamps survive the trip. The server relays the frame opaquely.
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// FileMeta is the sender-side file metadata restored on download.
+type FileMeta struct {
+	MtimeUnixNano int64
+	Mode          uint32 // permission bits only
+	HashAlgo      byte   // whole-file checksum algorithm (HashSHA256/HashBlake3)
+}
+
+// metaFrameLen is the payload this version writes; the frame is
+// length-prefixed so future fields (e.g. extended attributes) can append
+// without another key version, and older readers skip what they don't know.
+const metaFrameLen = 13
+
+// maxMetaFrameLen caps what a reader will buffer for a frame from a newer
+// sender.
+const maxMetaFrameLen = 4096
+
+// WriteMetaFrame writes the length-prefixed metadata frame.
+func WriteMetaFrame(w io.Writer, meta FileMeta) error {
+	var payload [metaFrameLen]byte
+	binary.BigEndian.PutUint64(payload[:8], uint64(meta.MtimeUnixNano))
+	binary.BigEndian.PutUint32(payload[8:12], meta.Mode)
+	payload[12] = meta.HashAlgo
+	return WriteRawMetaFrame(w, payload[:])
+}
+
+// ReadMetaFrame parses a metadata frame; trailing bytes from a newer sender
+// are consumed and ignored.
+func ReadMetaFrame(r io.Reader) (FileMeta, error) {
+	payload, err := ReadRawMetaFrame(r)
+	if err != nil {
+		return FileMeta{}, err
+	}
+	var meta FileMeta
+	if len(payload) >= 12 {
+		meta.MtimeUnixNano = int64(binary.BigEndian.Uint64(payload[:8]))
+		meta.Mode = binary.BigEndian.Uint32(payload[8:12])
+	}
+	// Frames from pre-HashAlgo senders are 12 bytes; the zero value is
+	// SHA-256, which is exactly what those senders used.
+	if len(payload) >= 13 {
+		meta.HashAlgo = payload[12]
+	}
+	return meta, nil
+}
+
+// WriteRawMetaFrame relays an already-read frame payload (server side).
+func WriteRawMetaFrame(w io.Writer, payload []byte) error {
+	if err := binary.Write(w, binary.BigEndian, uint16(len(payload))); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// ReadRawMetaFrame reads a frame payload without interpreting it.
+func ReadRawMetaFrame(r io.Reader) ([]byte, error) {
+	var n uint16
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	if n > maxMetaFrameLen {
+		return nil, fmt.Errorf("metadata frame too large: %d", n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// MetaFrameWithHash returns a raw frame payload with its checksum algorithm
+// byte set, extending a short pre-HashAlgo payload when needed. The delta
+// and append handlers use it: their clients recompute the whole-file tag
+// with the key version's default hasher, so a blob first checksummed with
+// BLAKE3 drops back to SHA-256 once its content changes.
+func MetaFrameWithHash(payload []byte, algo byte) []byte {
+	if len(payload) < 13 {
+		if algo == HashSHA256 {
+			return payload // a short frame already means SHA-256
+		}
+		p := make([]byte, 13)
+		copy(p, payload)
+		p[12] = algo
+		return p
+	}
+	payload[12] = algo
+	return payload
+}
+
+// NewFileMeta captures the metadata sent for a file.
+func NewFileMeta(mtime time.Time, mode uint32) FileMeta {
+	return FileMeta{MtimeUnixNano: mtime.UnixNano(), Mode: mode & 0777}
+}
+
+// Restore applies the received metadata to a downloaded file; failures are
+// reported but a file that cannot take its old mtime is still a good
+// download.
+func (m FileMeta) Restore(path string) error {
+	if m.Mode != 0 {
+		if err := os.Chmod(path, os.FileMode(m.Mode&0777)); err != nil {
+			return err
+		}
+	}
+	if m.MtimeUnixNano != 0 {
+		mtime := time.Unix(0, m.MtimeUnixNano)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
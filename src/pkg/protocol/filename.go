@@ -0,0 +1,65 @@
+package protocol
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Central filename sanitization. Upload names come straight off the wire and
+// end up in Content-Disposition headers, filepath.Join calls and os.Create on
+// the receiving side, so every consumer (server handlers, web download, client
+// save paths) must go through SanitizeFilename instead of ad-hoc Base calls.
+
+const maxSafeFilename = 255
+
+// Reserved device names on Windows (case-insensitive, with or without extension).
+var reservedWindowsNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true,
+	"com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true,
+	"lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// SanitizeFilename reduces an untrusted name to a safe base filename: strips
+// directories (both separators), control characters and characters a
+// destination filesystem may reject, normalizes to NFC so the same name byte
+// sequence comes out of a Mac and a Linux sender, neutralizes Windows-reserved
+// names and trailing dots/spaces, and caps the length while keeping the
+// extension. Never returns an empty string.
+func SanitizeFilename(name string) string {
+	// Last path component, whichever separator the sender used.
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	// macOS stores (and sends) decomposed UTF-8; NFC is what Windows and
+	// Linux users type, so settle on it before anything compares names.
+	name = norm.NFC.String(name)
+	var b strings.Builder
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`"<>:|?*`, r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	name = b.String()
+	// Trailing dots and spaces are dropped by Windows and hide extensions.
+	name = strings.TrimRight(name, ". ")
+	if name == "" || name == "." || name == ".." {
+		return "download"
+	}
+	base := strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+	if reservedWindowsNames[base] {
+		name = "_" + name
+	}
+	if len(name) > maxSafeFilename {
+		ext := filepath.Ext(name)
+		if len(ext) > 32 {
+			ext = ext[:32]
+		}
+		name = name[:maxSafeFilename-len(ext)] + ext
+	}
+	return name
+}
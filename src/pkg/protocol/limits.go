@@ -0,0 +1,65 @@
+// Wire sanity limits, applied wherever a length or count read off the wire
+// would otherwise size an allocation or a loop. Every limit sits far above
+// anything a legitimate client produces; tripping one means a hostile or
+// corrupt peer, so readers fail the frame instead of allocating.
+package protocol
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// MaxWireNameLen caps a declared filename length. Filesystems stop at
+	// 255 bytes and SanitizeFilename truncates further; 4 KB allows exotic
+	// senders without letting the 64 KB field maximum size the allocation.
+	MaxWireNameLen = 4096
+
+	// MaxWireChunkSealed caps one chunk's declared sealed length. The
+	// largest legitimate chunk is the WAN profile's 4 MB plaintext plus
+	// AEAD overhead; 64 MB leaves room for bigger future profiles.
+	MaxWireChunkSealed = 64 * 1024 * 1024
+
+	// MaxWireSealedLen caps a non-chunked sealed payload. Clients switch
+	// to chunked framing well below this, so a larger declaration is
+	// either hostile or a framing bug.
+	MaxWireSealedLen = 1 << 30
+
+	// MaxWireChunkCount caps a declared chunk count where no server-side
+	// size limit applies (the delta signature a client reads). A million
+	// 256 KB chunks is a 256 GB blob — far past anything served today —
+	// while the digest block it sizes stays around 40 MB.
+	MaxWireChunkCount = 1 << 20
+)
+
+// ErrWireLimit marks a frame rejected by a sanity limit; distinguishable
+// from transport errors with errors.Is.
+var ErrWireLimit = errors.New("wire sanity limit exceeded")
+
+func checkNameLen(n uint16) error {
+	if int(n) > MaxWireNameLen {
+		return fmt.Errorf("%w: name length %d", ErrWireLimit, n)
+	}
+	return nil
+}
+
+func checkChunkSealed(n uint32) error {
+	if n > MaxWireChunkSealed {
+		return fmt.Errorf("%w: sealed chunk length %d", ErrWireLimit, n)
+	}
+	return nil
+}
+
+// CheckChunkCount bounds a declared chunk count by the declared total
+// plaintext size and the smallest chunk any client produces, so the count
+// cannot be inflated into a huge allocation or loop. Exported for the server
+// upload handler, which parses its chunked header inline.
+func CheckChunkCount(numChunks uint32, totalPlainLen uint64) error {
+	if numChunks == 0 && totalPlainLen == 0 {
+		return nil // empty file
+	}
+	if numChunks == 0 || uint64(numChunks) > totalPlainLen/FileChunkSize+1 {
+		return fmt.Errorf("%w: %d chunks for %d bytes", ErrWireLimit, numChunks, totalPlainLen)
+	}
+	return nil
+}
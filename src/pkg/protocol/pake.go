@@ -0,0 +1,190 @@
+package protocol
+
+import (
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// PAKE-protected downloads (get -pake). The 6-digit code is never sent on
+// the wire: client and server run SPAKE2 over P-256 with a code-derived
+// scalar to agree on a strong session key, and the download flows through an
+// AES-GCM channel under that key. A recorded session is useless even to
+// someone who later learns the code – the ephemeral secrets are gone – so
+// offline guessing of the code against a capture is cryptographically
+// pointless, and every online guess costs one rate-limited connection. The
+// blob is located by a hashed code tag, which only identifies the transfer
+// and is not part of the key exchange.
+
+const (
+	PakePointSize   = 65 // uncompressed P-256 point
+	PakeTagSize     = sha256.Size
+	PakeConfirmSize = sha256.Size
+	pakeMaxFrame    = 8 * 1024 * 1024
+)
+
+var PakeCurve = elliptic.P256()
+
+// PakeSqrtExp = (p+1)/4; P-256 has p ≡ 3 (mod 4), so rhs^PakeSqrtExp is a
+// square root of rhs when one exists.
+var PakeSqrtExp = new(big.Int).Rsh(new(big.Int).Add(elliptic.P256().Params().P, big.NewInt(1)), 2)
+
+// The SPAKE2 blinding points M and N: fixed curve points with unknown
+// discrete log, derived by hashing a label with a counter until the
+// x-coordinate lands on the curve.
+var (
+	PakeMx, PakeMy = PakeBasePoint("M")
+	PakeNx, PakeNy = PakeBasePoint("N")
+)
+
+func PakeBasePoint(label string) (x, y *big.Int) {
+	p := PakeCurve.Params().P
+	for i := 0; ; i++ {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("tcpraw-pake-point-%s-%d", label, i)))
+		x = new(big.Int).SetBytes(sum[:])
+		if x.Cmp(p) >= 0 {
+			continue
+		}
+		// y² = x³ - 3x + b mod p
+		rhs := new(big.Int).Exp(x, big.NewInt(3), p)
+		rhs.Sub(rhs, new(big.Int).Mul(big.NewInt(3), x))
+		rhs.Add(rhs, PakeCurve.Params().B)
+		rhs.Mod(rhs, p)
+		y = new(big.Int).Exp(rhs, PakeSqrtExp, p)
+		if new(big.Int).Mod(new(big.Int).Mul(y, y), p).Cmp(rhs) == 0 && PakeCurve.IsOnCurve(x, y) {
+			return x, y
+		}
+	}
+}
+
+// PakeTag returns the public lookup tag for a code.
+func PakeTag(code string) []byte {
+	h := sha256.New()
+	h.Write([]byte("tcpraw-pake-tag"))
+	h.Write([]byte(code))
+	return h.Sum(nil)
+}
+
+// PakeScalar derives the SPAKE2 password scalar from the code with Argon2id,
+// returning both the raw bytes (bound into the session key) and the scalar
+// reduced mod the group order.
+func PakeScalar(code string) ([]byte, *big.Int) {
+	raw := argon2.IDKey([]byte(code), []byte("tcpraw-pake-w"), codeArgonTime, codeArgonMemKiB, codeArgonLanes, 32)
+	w := new(big.Int).SetBytes(raw)
+	w.Mod(w, PakeCurve.Params().N)
+	return raw, w
+}
+
+// PakeBlind returns scalar*G + w*B for blinding point B.
+func PakeBlind(scalar []byte, w *big.Int, bx, by *big.Int) (px, py *big.Int) {
+	gx, gy := PakeCurve.ScalarBaseMult(scalar)
+	wx, wy := PakeCurve.ScalarMult(bx, by, w.Bytes())
+	return PakeCurve.Add(gx, gy, wx, wy)
+}
+
+// PakeUnblind removes w*B from the peer's point and multiplies by the own
+// ephemeral scalar: K = scalar*(P - w*B).
+func PakeUnblind(px, py, w, bx, by *big.Int, scalar []byte) (kx, ky *big.Int) {
+	wx, wy := PakeCurve.ScalarMult(bx, by, w.Bytes())
+	negY := new(big.Int).Sub(PakeCurve.Params().P, wy)
+	tx, ty := PakeCurve.Add(px, py, wx, negY)
+	return PakeCurve.ScalarMult(tx, ty, scalar)
+}
+
+// PakeSessionKey binds the tag, the password bytes, both public messages and
+// the shared point into the session base key.
+func PakeSessionKey(tag, wRaw, xMsg, yMsg, kMsg []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("tcpraw-pake-key"))
+	h.Write(tag)
+	h.Write(wRaw)
+	h.Write(xMsg)
+	h.Write(yMsg)
+	h.Write(kMsg)
+	return h.Sum(nil)
+}
+
+// PakeSubKey derives a labelled key (confirmation MACs, channel keys) from
+// the session base key.
+func PakeSubKey(base []byte, label string) []byte {
+	mac := hmac.New(sha256.New, base)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
+// PakeChannel carries a byte stream as length-prefixed AES-GCM frames with
+// counter nonces. Send and receive use direction-separated keys so the
+// counters cannot collide, and the nonce counter is checked on receive so
+// frames cannot be dropped or reordered.
+type PakeChannel struct {
+	rw       io.ReadWriter
+	sendKey  []byte
+	recvKey  []byte
+	sendCtr  uint64
+	recvCtr  uint64
+	leftover []byte
+}
+
+func NewPakeChannel(rw io.ReadWriter, base []byte, client bool) *PakeChannel {
+	c2s := PakeSubKey(base, "c2s")[:SecureKeySize]
+	s2c := PakeSubKey(base, "s2c")[:SecureKeySize]
+	if client {
+		return &PakeChannel{rw: rw, sendKey: c2s, recvKey: s2c}
+	}
+	return &PakeChannel{rw: rw, sendKey: s2c, recvKey: c2s}
+}
+
+func (c *PakeChannel) Write(p []byte) (int, error) {
+	nonce, sealed, err := EncryptChunkAt(c.sendKey, c.sendCtr, p)
+	if err != nil {
+		return 0, err
+	}
+	c.sendCtr++
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(sealed)))
+	if _, err := c.rw.Write(hdr[:]); err != nil {
+		return 0, err
+	}
+	if _, err := c.rw.Write(nonce); err != nil {
+		return 0, err
+	}
+	if _, err := c.rw.Write(sealed); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *PakeChannel) Read(p []byte) (int, error) {
+	if len(c.leftover) == 0 {
+		var hdr [4]byte
+		if _, err := io.ReadFull(c.rw, hdr[:]); err != nil {
+			return 0, err
+		}
+		sealedLen := binary.BigEndian.Uint32(hdr[:])
+		if sealedLen == 0 || sealedLen > pakeMaxFrame {
+			return 0, fmt.Errorf("invalid pake frame length %d", sealedLen)
+		}
+		buf := make([]byte, gcmNonceSize+int(sealedLen))
+		if _, err := io.ReadFull(c.rw, buf); err != nil {
+			return 0, err
+		}
+		if binary.BigEndian.Uint64(buf[4:gcmNonceSize]) != c.recvCtr {
+			return 0, fmt.Errorf("pake frame out of order")
+		}
+		pt, err := DecryptWithKey(c.recvKey, buf[:gcmNonceSize], buf[gcmNonceSize:])
+		if err != nil {
+			return 0, fmt.Errorf("pake frame: %w", err)
+		}
+		c.recvCtr++
+		c.leftover = pt
+	}
+	n := copy(p, c.leftover)
+	c.leftover = c.leftover[n:]
+	return n, nil
+}
@@ -0,0 +1,14 @@
+package protocol
+
+import "strings"
+
+// Windows named-pipe transport. An address like \\.\pipe\tcpraw selects the
+// pipe dialer instead of TCP, and the server exposes a pipe listener with
+// -pipe, for local IPC setups (service front-ends, GUI wrappers) where
+// endpoint-protection software blocks TCP even on localhost. The wire
+// protocol on the pipe is identical to TCP.
+
+// IsPipeAddr reports whether addr names a Windows named pipe.
+func IsPipeAddr(addr string) bool {
+	return strings.HasPrefix(addr, `\\.\pipe\`)
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package protocol
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+var errPipeUnsupported = errors.New("named pipes are only available on Windows")
+
+func ListenNamedPipe(path string) (net.Listener, error) {
+	return nil, errPipeUnsupported
+}
+
+func DialNamedPipe(path string, timeout time.Duration) (net.Conn, error) {
+	return nil, errPipeUnsupported
+}
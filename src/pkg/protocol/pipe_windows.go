@@ -0,0 +1,183 @@
+//go:build windows
+// +build windows
+
+package protocol
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Named-pipe constants missing from the syscall package.
+const (
+	pipeAccessDuplex       = 0x3
+	pipeTypeByte           = 0x0
+	pipeUnlimitedInstances = 255
+	errorPipeBusy          = syscall.Errno(231)
+	errorPipeConnected     = syscall.Errno(535)
+)
+
+// The pipe entry points are not wrapped by the syscall package either.
+var (
+	pipeKernel32         = syscall.MustLoadDLL("kernel32.dll")
+	procCreateNamedPipe  = pipeKernel32.MustFindProc("CreateNamedPipeW")
+	procConnectNamedPipe = pipeKernel32.MustFindProc("ConnectNamedPipe")
+)
+
+func createNamedPipe(name *uint16, openMode, pipeMode, maxInstances, outSize, inSize uint32) (syscall.Handle, error) {
+	r1, _, err := procCreateNamedPipe.Call(uintptr(unsafe.Pointer(name)),
+		uintptr(openMode), uintptr(pipeMode), uintptr(maxInstances),
+		uintptr(outSize), uintptr(inSize), 0, 0)
+	h := syscall.Handle(r1)
+	if h == syscall.InvalidHandle {
+		return h, err
+	}
+	return h, nil
+}
+
+func connectNamedPipe(h syscall.Handle) error {
+	r1, _, err := procConnectNamedPipe.Call(uintptr(h), 0)
+	if r1 == 0 {
+		return err
+	}
+	return nil
+}
+
+// pipeAddr satisfies net.Addr for both ends of a pipe connection.
+type pipeAddr struct {
+	path string
+}
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return a.path }
+
+// pipeConn adapts a pipe handle to net.Conn. Pipe handles carry no
+// per-operation timeouts in blocking mode, so the deadline methods are
+// accepted and ignored; local IPC peers do not vanish mid-transfer the way
+// remote ones do.
+type pipeConn struct {
+	*os.File
+	addr pipeAddr
+}
+
+func (c *pipeConn) LocalAddr() net.Addr              { return c.addr }
+func (c *pipeConn) RemoteAddr() net.Addr             { return c.addr }
+func (c *pipeConn) SetDeadline(time.Time) error      { return nil }
+func (c *pipeConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *pipeConn) SetWriteDeadline(time.Time) error { return nil }
+
+// pipeListener hands out one pipe instance per accepted connection; the
+// next instance is created lazily in Accept, the way winsock accepts
+// sockets.
+type pipeListener struct {
+	path string
+	mu   sync.Mutex
+	// pending is the instance Accept is blocking on; Close closes it to
+	// unblock ConnectNamedPipe.
+	pending syscall.Handle
+	closed  bool
+}
+
+// ListenNamedPipe serves the transfer protocol on a named pipe like
+// \\.\pipe\tcpraw.
+func ListenNamedPipe(path string) (net.Listener, error) {
+	if !IsPipeAddr(path) {
+		return nil, fmt.Errorf(`pipe name must look like \\.\pipe\<name>, got %q`, path)
+	}
+	l := &pipeListener{path: path, pending: syscall.InvalidHandle}
+	// Create the first instance up front so a bad name or a name squatted
+	// by another process fails at startup, not at first connect.
+	if err := l.nextInstance(); err != nil {
+		return nil, fmt.Errorf("listen pipe %s: %w", path, err)
+	}
+	return l, nil
+}
+
+func (l *pipeListener) nextInstance() error {
+	name, err := syscall.UTF16PtrFromString(l.path)
+	if err != nil {
+		return err
+	}
+	h, err := createNamedPipe(name, pipeAccessDuplex, pipeTypeByte,
+		pipeUnlimitedInstances, uint32(BufSize), uint32(BufSize))
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		syscall.CloseHandle(h)
+		return net.ErrClosed
+	}
+	l.pending = h
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	h := l.pending
+	closed := l.closed
+	l.mu.Unlock()
+	if closed || h == syscall.InvalidHandle {
+		return nil, net.ErrClosed
+	}
+	err := connectNamedPipe(h)
+	if err != nil && err != errorPipeConnected {
+		l.mu.Lock()
+		closed = l.closed
+		l.mu.Unlock()
+		if closed {
+			return nil, net.ErrClosed
+		}
+		syscall.CloseHandle(h)
+		l.nextInstance()
+		return nil, fmt.Errorf("pipe accept: %w", err)
+	}
+	if err := l.nextInstance(); err != nil && err != net.ErrClosed {
+		fmt.Fprintf(os.Stderr, "pipe listener: %v\n", err)
+	}
+	return &pipeConn{File: os.NewFile(uintptr(h), l.path), addr: pipeAddr{l.path}}, nil
+}
+
+func (l *pipeListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	if l.pending != syscall.InvalidHandle {
+		syscall.CloseHandle(l.pending)
+		l.pending = syscall.InvalidHandle
+	}
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr { return pipeAddr{l.path} }
+
+// DialNamedPipe connects to a named-pipe server, retrying while every
+// instance is busy, up to timeout.
+func DialNamedPipe(path string, timeout time.Duration) (net.Conn, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		h, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE,
+			0, nil, syscall.OPEN_EXISTING, 0, 0)
+		if err == nil {
+			return &pipeConn{File: os.NewFile(uintptr(h), path), addr: pipeAddr{path}}, nil
+		}
+		if err != errorPipeBusy || time.Now().After(deadline) {
+			return nil, fmt.Errorf("dial pipe %s: %w", path, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
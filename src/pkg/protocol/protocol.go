@@ -1,36 +1,134 @@
-package main
+// Package protocol implements the tcpraw wire protocol: message framing,
+// upload/download request and response encoding, the crypto schemes used to
+// seal transfers, and the shared transport helpers (dialing, TLS, socket
+// tuning, server-list discovery).
+package protocol
 
 import (
 	"bytes"
+	crand "crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	mrand "math/rand/v2"
 )
 
 var ErrBlobTooLarge = errors.New("blob too large")
 
-const nonceSize = 12
+const NonceSize = 12
 
 const (
-	MsgUpload       = 'U'
-	MsgDownload     = 'D'
-	MsgSecureUpload = 'S'
-	MsgTest         = 'T'
-	MsgBench        = 'B'
+	MsgUpload        = 'U'
+	MsgDownload      = 'D'
+	MsgSecureUpload  = 'S'
+	MsgTest          = 'T'
+	MsgBench         = 'B'
+	MsgUploadPw      = 'P' // upload with download password: password frame, then chunked upload header
+	MsgDownloadPw    = 'p' // download with password: code, then password frame
+	MsgDownloadPake  = 'W' // PAKE download: code tag + SPAKE2 handshake, then encrypted frames
+	MsgDownloadRange = 'R' // chunk-range download: code, then start and count uint32
+	MsgDeltaUpload   = 'Z' // delta update: code, then signature exchange and changed chunks (delta.go)
+	MsgAppend        = 'A' // append: code and owner token, then signature exchange and new chunks (delta.go)
+	MsgCheck         = 'C' // existence and integrity check: code, then a check report (check.go)
+	MsgMigrate       = 'M' // server-to-server blob import: gob metadata and sealed payload, answers the new code
+	MsgUploadTimed   = 'E' // embargoed upload: not-before frame (uint32 seconds from now), then chunked upload header
 )
 
 const TestPayloadSize = 256 * 1024 // 256 KB for bandwidth probe
 
+// Server capability bits, advertised after the MsgTest probe payload (see
+// WriteServerCaps). Clients feature-detect from the bitmap instead of
+// attempting a message type and interpreting silence or StatusError.
 const (
-	StatusOK            = 0
-	StatusChecksumError = 1
-	StatusError         = 2
-	StatusNotFound      = 3
+	CapRange   = 1 << 0 // chunk-range downloads (MsgDownloadRange)
+	CapPake    = 1 << 1 // PAKE downloads (MsgDownloadPake)
+	CapDelta   = 1 << 2 // delta updates (MsgDeltaUpload)
+	CapAppend  = 1 << 3 // owner-token appends (MsgAppend)
+	CapCheck   = 1 << 4 // existence and integrity checks (MsgCheck)
+	CapMigrate = 1 << 5 // migration imports (MsgMigrate)
+	CapBench   = 1 << 6 // benchmark allowed (cleared under -nobench)
+	CapTLS     = 1 << 7 // TLS on the transfer port
+)
+
+// WriteServerCaps appends the capability frame to a MsgTest reply: the
+// bitmap, the server's sealed-chunk plaintext size, its protocol level (the
+// newest key version it speaks) and its version string. It goes after the
+// probe payload so legacy clients, which stop reading there, never see it;
+// a client that reads nothing treats the server as legacy (no capabilities).
+func WriteServerCaps(w io.Writer, caps uint64, chunkSize uint32, level byte, version string) error {
+	if len(version) > 255 {
+		version = version[:255]
+	}
+	if err := binary.Write(w, binary.BigEndian, caps); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, chunkSize); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{level, byte(len(version))}); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte(version))
+	return err
+}
+
+// ReadServerCaps reads the capability frame of a MsgTest reply.
+func ReadServerCaps(r io.Reader) (caps uint64, chunkSize uint32, level byte, version string, err error) {
+	if err = binary.Read(r, binary.BigEndian, &caps); err != nil {
+		return 0, 0, 0, "", err
+	}
+	if err = binary.Read(r, binary.BigEndian, &chunkSize); err != nil {
+		return 0, 0, 0, "", err
+	}
+	var hdr [2]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return 0, 0, 0, "", err
+	}
+	verBuf := make([]byte, hdr[1])
+	if _, err = io.ReadFull(r, verBuf); err != nil {
+		return 0, 0, 0, "", err
+	}
+	return caps, chunkSize, hdr[0], string(verBuf), nil
+}
+
+const (
+	StatusOK               = 0
+	StatusChecksumError    = 1
+	StatusError            = 2
+	StatusNotFound         = 3
+	StatusPasswordRequired = 4
+	StatusPolicyRejected   = 5
+	StatusMalformedCode    = 6
+	StatusCorrupt          = 7 // stored payload failed the server-side integrity check (MsgCheck)
+	StatusRedirect         = 8 // blob migrated to another server; the new code follows (6 ASCII digits)
+	StatusEmbargoed        = 9 // timed release not reached; remaining seconds follow (uint32)
 )
 
 const CodeLength = 6
 
+// Download format bytes sent before the blob: 0/1 = code-encrypted
+// plain/chunked with the legacy SHA-256 key, 2/3 = secure (random key)
+// plain/chunked, 4/5 = code-encrypted plain/chunked followed by a
+// key-version byte. Old clients only ever receive 0–3.
+const (
+	FormatPlain         = 0
+	FormatChunked       = 1
+	FormatSecure        = 2
+	FormatSecureChunked = 3
+	FormatPlainV        = 4
+	FormatChunkedV      = 5
+)
+
+// UploadVersionMarker prefixes a versioned chunked-upload header (marker,
+// key-version byte, per-upload key salt for versions that use one, then the
+// usual header). Legacy headers start with the
+// 6-digit code (ASCII digits), so the marker is unambiguous and old clients
+// keep working.
+const UploadVersionMarker = 0xFF
+
 const FileChunkSize = 256 * 1024
 
 // Long-term storage: max 150 MB, duration sent as uint32 seconds (0 = default 30 min).
@@ -45,9 +143,21 @@ type ProgressFunc func(sent, total int64)
 
 const (
 	sendChunkSize = 512 * 1024 // larger chunks = fewer syscalls when streaming download
-	benchMinBytes = 4 * 1024 * 1024
+	BenchMinBytes = 4 * 1024 * 1024
 )
 
+// NewBenchStream returns an endless pseudo-random byte stream, freshly
+// seeded, for benchmark payloads in both directions. Zeros or a repeated
+// buffer compress and deduplicate in transit, so a middlebox or NIC with
+// compression reports throughput no real (encrypted, incompressible)
+// transfer can reach. ChaCha8 generates bytes far faster than any link we
+// measure, so the generator is never the bottleneck.
+func NewBenchStream() io.Reader {
+	var seed [32]byte
+	crand.Read(seed[:])
+	return mrand.NewChaCha8(seed)
+}
+
 func SendFile(w io.Writer, name string, content io.Reader, size int64, progress ProgressFunc) ([]byte, error) {
 	nameBytes := []byte(name)
 	if len(nameBytes) > 0xFFFF {
@@ -99,6 +209,9 @@ func ReadFileHeader(r io.Reader) (name string, size uint64, expectedChecksum []b
 	if err = binary.Read(r, binary.BigEndian, &nameLen); err != nil {
 		return
 	}
+	if err = checkNameLen(nameLen); err != nil {
+		return
+	}
 	nameBuf := make([]byte, nameLen)
 	if _, err = io.ReadFull(r, nameBuf); err != nil {
 		return
@@ -227,6 +340,9 @@ func ReadSecureUploadChunkedHeader(r io.Reader) (name string, totalPlainLen uint
 	if err = binary.Read(r, binary.BigEndian, &nameLen); err != nil {
 		return "", 0, 0, 0, nil, err
 	}
+	if err = checkNameLen(nameLen); err != nil {
+		return "", 0, 0, 0, nil, err
+	}
 	nameBuf := make([]byte, nameLen)
 	if _, err = io.ReadFull(r, nameBuf); err != nil {
 		return "", 0, 0, 0, nil, err
@@ -241,6 +357,9 @@ func ReadSecureUploadChunkedHeader(r io.Reader) (name string, totalPlainLen uint
 	if err = binary.Read(r, binary.BigEndian, &numChunks); err != nil {
 		return "", 0, 0, 0, nil, err
 	}
+	if err = CheckChunkCount(numChunks, totalPlainLen); err != nil {
+		return "", 0, 0, 0, nil, err
+	}
 	plaintextChecksum = make([]byte, sha256.Size)
 	if _, err = io.ReadFull(r, plaintextChecksum); err != nil {
 		return "", 0, 0, 0, nil, err
@@ -250,18 +369,38 @@ func ReadSecureUploadChunkedHeader(r io.Reader) (name string, totalPlainLen uint
 
 func ReadChunkRaw(r io.Reader) (nonce []byte, sealed []byte, err error) {
 	nonce = make([]byte, 12)
-	if _, err = io.ReadFull(r, nonce); err != nil {
+	sealed, err = ReadChunkInto(r, nonce, nil)
+	if err != nil {
 		return nil, nil, err
 	}
-	var sealedLen uint32
-	if err = binary.Read(r, binary.BigEndian, &sealedLen); err != nil {
-		return nil, nil, err
+	return nonce, sealed, nil
+}
+
+// ReadChunkInto reads one chunk into the caller's 12-byte nonce buffer,
+// reusing sealed's backing array when it is large enough. Sequential loops
+// (e.g. writing chunks straight to disk) can recycle both buffers across
+// iterations; callers handing chunks to another goroutine must stick with
+// ReadChunkRaw.
+func ReadChunkInto(r io.Reader, nonce []byte, sealed []byte) ([]byte, error) {
+	if _, err := io.ReadFull(r, nonce); err != nil {
+		return nil, err
 	}
-	sealed = make([]byte, sealedLen)
-	if _, err = io.ReadFull(r, sealed); err != nil {
-		return nil, nil, err
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
 	}
-	return nonce, sealed, nil
+	sealedLen := binary.BigEndian.Uint32(lenBuf[:])
+	if err := checkChunkSealed(sealedLen); err != nil {
+		return nil, err
+	}
+	if uint32(cap(sealed)) < sealedLen {
+		sealed = make([]byte, sealedLen)
+	}
+	sealed = sealed[:sealedLen]
+	if _, err := io.ReadFull(r, sealed); err != nil {
+		return nil, err
+	}
+	return sealed, nil
 }
 
 func SendCodeResponse(w io.Writer, status byte, code string) error {
@@ -298,21 +437,94 @@ func WriteDownloadRequest(w io.Writer, code string) error {
 	return err
 }
 
+// ErrMalformedCode reports a transfer code that is not exactly six ASCII
+// digits. Codes go straight into .blob/.dat filenames, so anything else is
+// rejected before any filesystem or map use.
+var ErrMalformedCode = errors.New("malformed code: must be 6 digits")
+
+// ValidCode reports whether code is exactly CodeLength ASCII digits.
+func ValidCode(code string) bool {
+	if len(code) != CodeLength {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		if code[i] < '0' || code[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 func ReadDownloadRequest(r io.Reader) (string, error) {
 	b := make([]byte, CodeLength)
 	_, err := io.ReadFull(r, b)
 	if err != nil {
 		return "", err
 	}
+	if !ValidCode(string(b)) {
+		return "", ErrMalformedCode
+	}
 	return string(b), nil
 }
 
+// WriteRangeRequest asks for count chunks of a chunked blob starting at
+// chunk start. count 0 requests the response header alone, which is how a
+// client learns the chunk count before splitting a download across
+// connections.
+func WriteRangeRequest(w io.Writer, code string, start, count uint32) error {
+	if err := WriteDownloadRequest(w, code); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, start); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, count)
+}
+
+func ReadRangeRequest(r io.Reader) (code string, start, count uint32, err error) {
+	code, err = ReadDownloadRequest(r)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if err = binary.Read(r, binary.BigEndian, &start); err != nil {
+		return "", 0, 0, err
+	}
+	if err = binary.Read(r, binary.BigEndian, &count); err != nil {
+		return "", 0, 0, err
+	}
+	return code, start, count, nil
+}
+
+func WritePasswordFrame(w io.Writer, password string) error {
+	pw := []byte(password)
+	if len(pw) > 0xFFFF {
+		pw = pw[:0xFFFF]
+	}
+	if err := binary.Write(w, binary.BigEndian, uint16(len(pw))); err != nil {
+		return err
+	}
+	_, err := w.Write(pw)
+	return err
+}
+
+func ReadPasswordFrame(r io.Reader) (string, error) {
+	var pwLen uint16
+	if err := binary.Read(r, binary.BigEndian, &pwLen); err != nil {
+		return "", err
+	}
+	buf := make([]byte, pwLen)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
 func SendFileFromData(w io.Writer, name string, data []byte) ([]byte, error) {
 	return SendFile(w, name, bytes.NewReader(data), int64(len(data)), nil)
 }
 
 func WriteEncryptedUpload(w io.Writer, code string, name string, plaintextChecksum []byte, nonce, sealed []byte, progress ProgressFunc) error {
-	if len(code) != CodeLength || len(plaintextChecksum) != sha256.Size || len(nonce) != nonceSize {
+	if len(code) != CodeLength || len(plaintextChecksum) != sha256.Size || len(nonce) != NonceSize {
 		return nil
 	}
 	if _, err := w.Write([]byte(code)); err != nil {
@@ -361,6 +573,9 @@ func ReadSecureUpload(r io.Reader, maxSealed int64) (name string, plaintextCheck
 	if err = binary.Read(r, binary.BigEndian, &nameLen); err != nil {
 		return "", nil, nil, nil, err
 	}
+	if err = checkNameLen(nameLen); err != nil {
+		return "", nil, nil, nil, err
+	}
 	nameBuf := make([]byte, nameLen)
 	if _, err = io.ReadFull(r, nameBuf); err != nil {
 		return "", nil, nil, nil, err
@@ -370,7 +585,7 @@ func ReadSecureUpload(r io.Reader, maxSealed int64) (name string, plaintextCheck
 	if _, err = io.ReadFull(r, plaintextChecksum); err != nil {
 		return "", nil, nil, nil, err
 	}
-	nonce = make([]byte, nonceSize)
+	nonce = make([]byte, NonceSize)
 	if _, err = io.ReadFull(r, nonce); err != nil {
 		return "", nil, nil, nil, err
 	}
@@ -398,6 +613,9 @@ func ReadEncryptedUpload(r io.Reader, maxSealed int64) (code string, name string
 	if err = binary.Read(r, binary.BigEndian, &nameLen); err != nil {
 		return "", "", nil, nil, nil, err
 	}
+	if err = checkNameLen(nameLen); err != nil {
+		return "", "", nil, nil, nil, err
+	}
 	nameBuf := make([]byte, nameLen)
 	if _, err = io.ReadFull(r, nameBuf); err != nil {
 		return "", "", nil, nil, nil, err
@@ -407,7 +625,7 @@ func ReadEncryptedUpload(r io.Reader, maxSealed int64) (code string, name string
 	if _, err = io.ReadFull(r, plaintextChecksum); err != nil {
 		return "", "", nil, nil, nil, err
 	}
-	nonce = make([]byte, nonceSize)
+	nonce = make([]byte, NonceSize)
 	if _, err = io.ReadFull(r, nonce); err != nil {
 		return "", "", nil, nil, nil, err
 	}
@@ -425,10 +643,30 @@ func ReadEncryptedUpload(r io.Reader, maxSealed int64) (code string, name string
 	return code, name, plaintextChecksum, nonce, sealed, nil
 }
 
-func WriteEncryptedUploadChunked(w io.Writer, code string, name string, totalPlainLen int64, storageDurationSec uint32, numChunks uint32, plaintextChecksum []byte, getChunk func() ([]byte, error), progress ProgressFunc) error {
+// WriteEncryptedUploadChunked writes a versioned chunked upload. keyMaterial
+// is the per-upload KDF salt, or the recipient frame for X25519 uploads.
+func WriteEncryptedUploadChunked(w io.Writer, code string, name string, totalPlainLen int64, storageDurationSec uint32, numChunks uint32, plaintextChecksum, chunkSums []byte, keyVersion byte, keyMaterial, key []byte, signerPub, signature []byte, meta *FileMeta, getChunk func() ([]byte, error), progress ProgressFunc) error {
 	if len(code) != CodeLength || len(plaintextChecksum) != sha256.Size {
 		return nil
 	}
+	if _, err := w.Write([]byte{UploadVersionMarker, keyVersion}); err != nil {
+		return err
+	}
+	if _, err := w.Write(keyMaterial); err != nil {
+		return err
+	}
+	if err := WriteSignatureFrame(w, signerPub, signature); err != nil {
+		return err
+	}
+	if HeaderHasMetaFrame(keyVersion) {
+		var m FileMeta
+		if meta != nil {
+			m = *meta
+		}
+		if err := WriteMetaFrame(w, m); err != nil {
+			return err
+		}
+	}
 	if _, err := w.Write([]byte(code)); err != nil {
 		return err
 	}
@@ -454,7 +692,13 @@ func WriteEncryptedUploadChunked(w io.Writer, code string, name string, totalPla
 	if _, err := w.Write(plaintextChecksum); err != nil {
 		return err
 	}
+	if len(chunkSums) > 0 {
+		if _, err := w.Write(chunkSums); err != nil {
+			return err
+		}
+	}
 	var sent int64
+	var chunkIndex uint64
 	for {
 		chunk, err := getChunk()
 		if err == io.EOF {
@@ -463,7 +707,8 @@ func WriteEncryptedUploadChunked(w io.Writer, code string, name string, totalPla
 		if err != nil {
 			return err
 		}
-		nonce, sealed, encErr := encryptChunk(code, chunk)
+		final := chunkIndex == uint64(numChunks)-1
+		nonce, sealed, encErr := EncryptChunkStream(key, chunkIndex, final, chunk)
 		if encErr != nil {
 			return encErr
 		}
@@ -476,6 +721,7 @@ func WriteEncryptedUploadChunked(w io.Writer, code string, name string, totalPla
 		if _, err := w.Write(sealed); err != nil {
 			return err
 		}
+		chunkIndex++
 		sent += int64(len(chunk))
 		if progress != nil {
 			progress(sent, totalPlainLen)
@@ -494,6 +740,9 @@ func ReadEncryptedUploadChunked(r io.Reader, maxTotalPlain int64) (code string,
 	if err = binary.Read(r, binary.BigEndian, &nameLen); err != nil {
 		return "", "", 0, nil, nil, err
 	}
+	if err = checkNameLen(nameLen); err != nil {
+		return "", "", 0, nil, nil, err
+	}
 	nameBuf := make([]byte, nameLen)
 	if _, err = io.ReadFull(r, nameBuf); err != nil {
 		return "", "", 0, nil, nil, err
@@ -513,6 +762,9 @@ func ReadEncryptedUploadChunked(r io.Reader, maxTotalPlain int64) (code string,
 	if err = binary.Read(r, binary.BigEndian, &numChunks); err != nil {
 		return "", "", 0, nil, nil, err
 	}
+	if err = CheckChunkCount(numChunks, totalPlainLen); err != nil {
+		return "", "", 0, nil, nil, err
+	}
 	plaintextChecksum = make([]byte, sha256.Size)
 	if _, err = io.ReadFull(r, plaintextChecksum); err != nil {
 		return "", "", 0, nil, nil, err
@@ -527,6 +779,9 @@ func ReadEncryptedUploadChunked(r io.Reader, maxTotalPlain int64) (code string,
 		if err = binary.Read(r, binary.BigEndian, &sealedLen); err != nil {
 			return "", "", 0, nil, nil, err
 		}
+		if err = checkChunkSealed(sealedLen); err != nil {
+			return "", "", 0, nil, nil, err
+		}
 		c.Sealed = make([]byte, sealedLen)
 		if _, err = io.ReadFull(r, c.Sealed); err != nil {
 			return "", "", 0, nil, nil, err
@@ -536,7 +791,9 @@ func ReadEncryptedUploadChunked(r io.Reader, maxTotalPlain int64) (code string,
 	return code, name, storageDurationSec, plaintextChecksum, chunks, nil
 }
 
-func WriteEncryptedBlob(w io.Writer, name string, plaintextChecksum []byte, nonce, sealed []byte, progress ProgressFunc) error {
+// WriteEncryptedBlobHeader writes the non-chunked blob header (name, checksum,
+// nonce, sealed length); the sealed payload follows separately.
+func WriteEncryptedBlobHeader(w io.Writer, name string, plaintextChecksum []byte, nonce []byte, sealedLen uint64) error {
 	nameBytes := []byte(name)
 	if len(nameBytes) > 0xFFFF {
 		nameBytes = nameBytes[:0xFFFF]
@@ -553,7 +810,11 @@ func WriteEncryptedBlob(w io.Writer, name string, plaintextChecksum []byte, nonc
 	if _, err := w.Write(nonce); err != nil {
 		return err
 	}
-	if err := binary.Write(w, binary.BigEndian, uint64(len(sealed))); err != nil {
+	return binary.Write(w, binary.BigEndian, sealedLen)
+}
+
+func WriteEncryptedBlob(w io.Writer, name string, plaintextChecksum []byte, nonce, sealed []byte, progress ProgressFunc) error {
+	if err := WriteEncryptedBlobHeader(w, name, plaintextChecksum, nonce, uint64(len(sealed))); err != nil {
 		return err
 	}
 	total := int64(len(sealed))
@@ -619,6 +880,9 @@ func ReadEncryptedBlobChunkedHeader(r io.Reader) (name string, totalPlainLen uin
 	if err = binary.Read(r, binary.BigEndian, &nameLen); err != nil {
 		return "", 0, 0, nil, err
 	}
+	if err = checkNameLen(nameLen); err != nil {
+		return "", 0, 0, nil, err
+	}
 	nameBuf := make([]byte, nameLen)
 	if _, err = io.ReadFull(r, nameBuf); err != nil {
 		return "", 0, 0, nil, err
@@ -630,6 +894,9 @@ func ReadEncryptedBlobChunkedHeader(r io.Reader) (name string, totalPlainLen uin
 	if err = binary.Read(r, binary.BigEndian, &numChunks); err != nil {
 		return "", 0, 0, nil, err
 	}
+	if err = CheckChunkCount(numChunks, totalPlainLen); err != nil {
+		return "", 0, 0, nil, err
+	}
 	plaintextChecksum = make([]byte, sha256.Size)
 	if _, err = io.ReadFull(r, plaintextChecksum); err != nil {
 		return "", 0, 0, nil, err
@@ -637,27 +904,14 @@ func ReadEncryptedBlobChunkedHeader(r io.Reader) (name string, totalPlainLen uin
 	return name, totalPlainLen, numChunks, plaintextChecksum, nil
 }
 
-func ReadEncryptedBlobNextChunk(r io.Reader, code string) (plaintext []byte, err error) {
-	var nonce [12]byte
-	if _, err = io.ReadFull(r, nonce[:]); err != nil {
-		return nil, err
-	}
-	var sealedLen uint32
-	if err = binary.Read(r, binary.BigEndian, &sealedLen); err != nil {
-		return nil, err
-	}
-	sealed := make([]byte, sealedLen)
-	if _, err = io.ReadFull(r, sealed); err != nil {
-		return nil, err
-	}
-	return decryptChunk(code, nonce[:], sealed)
-}
-
 func ReadEncryptedBlob(r io.Reader, progress ProgressFunc) (name string, plaintextChecksum []byte, nonce, sealed []byte, err error) {
 	var nameLen uint16
 	if err = binary.Read(r, binary.BigEndian, &nameLen); err != nil {
 		return "", nil, nil, nil, err
 	}
+	if err = checkNameLen(nameLen); err != nil {
+		return "", nil, nil, nil, err
+	}
 	nameBuf := make([]byte, nameLen)
 	if _, err = io.ReadFull(r, nameBuf); err != nil {
 		return "", nil, nil, nil, err
@@ -667,7 +921,7 @@ func ReadEncryptedBlob(r io.Reader, progress ProgressFunc) (name string, plainte
 	if _, err = io.ReadFull(r, plaintextChecksum); err != nil {
 		return "", nil, nil, nil, err
 	}
-	nonce = make([]byte, nonceSize)
+	nonce = make([]byte, NonceSize)
 	if _, err = io.ReadFull(r, nonce); err != nil {
 		return "", nil, nil, nil, err
 	}
@@ -675,20 +929,23 @@ func ReadEncryptedBlob(r io.Reader, progress ProgressFunc) (name string, plainte
 	if err = binary.Read(r, binary.BigEndian, &sealedLen); err != nil {
 		return "", nil, nil, nil, err
 	}
-	sealed = make([]byte, 0, sealedLen)
+	if sealedLen > MaxWireSealedLen {
+		return "", nil, nil, nil, fmt.Errorf("%w: sealed length %d", ErrWireLimit, sealedLen)
+	}
+	// One allocation up front; reads land directly in the final slice
+	// instead of going through per-chunk buffers and appends.
+	sealed = make([]byte, sealedLen)
 	total := int64(sealedLen)
 	var read int64
 	for read < total {
-		n := sendChunkSize
-		if total-read < int64(n) {
-			n = int(total - read)
+		n := int64(sendChunkSize)
+		if total-read < n {
+			n = total - read
 		}
-		chunk := make([]byte, n)
-		if _, err = io.ReadFull(r, chunk); err != nil {
+		if _, err = io.ReadFull(r, sealed[read:read+n]); err != nil {
 			return "", nil, nil, nil, err
 		}
-		sealed = append(sealed, chunk...)
-		read += int64(n)
+		read += n
 		if progress != nil {
 			progress(read, total)
 		}
@@ -696,14 +953,8 @@ func ReadEncryptedBlob(r io.Reader, progress ProgressFunc) (name string, plainte
 	return name, plaintextChecksum, nonce, sealed, nil
 }
 
-func checksumEqual(a, b []byte) bool {
-	if len(a) != len(b) {
-		return false
-	}
-	for i := range a {
-		if a[i] != b[i] {
-			return false
-		}
-	}
-	return true
+// ChecksumEqual compares two checksums in constant time so a byte-wise
+// mismatch position never shows up as a timing difference.
+func ChecksumEqual(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
 }
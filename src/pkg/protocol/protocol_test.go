@@ -0,0 +1,87 @@
+package protocol
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func buildBlobWire(b *testing.B, sealedLen int) []byte {
+	b.Helper()
+	sealed := make([]byte, sealedLen)
+	if _, err := rand.Read(sealed); err != nil {
+		b.Fatal(err)
+	}
+	var buf bytes.Buffer
+	checksum := make([]byte, 32)
+	nonce := make([]byte, NonceSize)
+	if err := WriteEncryptedBlob(&buf, "bench.bin", checksum, nonce, sealed, nil); err != nil {
+		b.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func buildChunkWire(b *testing.B, numChunks, chunkLen int) []byte {
+	b.Helper()
+	chunk := make([]byte, chunkLen)
+	if _, err := rand.Read(chunk); err != nil {
+		b.Fatal(err)
+	}
+	nonce := make([]byte, NonceSize)
+	var buf bytes.Buffer
+	for i := 0; i < numChunks; i++ {
+		if err := WriteChunk(&buf, nonce, chunk); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkReadEncryptedBlob(b *testing.B) {
+	const sealedLen = 8 * 1024 * 1024
+	wire := buildBlobWire(b, sealedLen)
+	b.SetBytes(sealedLen)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, _, err := ReadEncryptedBlob(bytes.NewReader(wire), nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadChunkRaw(b *testing.B) {
+	const numChunks = 64
+	wire := buildChunkWire(b, numChunks, FileChunkSize)
+	b.SetBytes(numChunks * FileChunkSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := bytes.NewReader(wire)
+		for j := 0; j < numChunks; j++ {
+			if _, _, err := ReadChunkRaw(r); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkReadChunkInto(b *testing.B) {
+	const numChunks = 64
+	wire := buildChunkWire(b, numChunks, FileChunkSize)
+	b.SetBytes(numChunks * FileChunkSize)
+	b.ReportAllocs()
+	nonce := make([]byte, NonceSize)
+	var sealed []byte
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := bytes.NewReader(wire)
+		for j := 0; j < numChunks; j++ {
+			var err error
+			sealed, err = ReadChunkInto(r, nonce, sealed)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package protocol
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// X25519 recipient encryption. `tcpraw keygen` produces an identity keypair,
+// `send -to <pubfile>` seals a random file key to the recipient's public key
+// and encrypts the chunks under that key, and `get -identity <keyfile>`
+// unwraps it – no secret travels alongside the code and only the holder of
+// the private key can decrypt. Identity files are hex text like signing
+// keys: <file> holds the private scalar (mode 0600), <file>.pub the public
+// key.
+
+// RecipientFrameSize is the wire size of a recipient frame: ephemeral public
+// key, GCM nonce and the sealed 32-byte file key.
+const RecipientFrameSize = 32 + gcmNonceSize + SecureKeySize + 16
+
+// RunKeygenX25519 generates an X25519 identity keypair and writes the private
+// key to path and the public key to path.pub. Refuses to overwrite.
+func RunKeygenX25519(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("generate key: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(priv.Bytes())+"\n"), 0600); err != nil {
+		return fmt.Errorf("write key: %w", err)
+	}
+	pubPath := path + ".pub"
+	if err := os.WriteFile(pubPath, []byte(hex.EncodeToString(priv.PublicKey().Bytes())+"\n"), 0644); err != nil {
+		return fmt.Errorf("write public key: %w", err)
+	}
+	fmt.Printf("Identity key written to %s, public key to %s\n", path, pubPath)
+	return nil
+}
+
+// LoadRecipientPub reads a hex-encoded X25519 public key from path.
+func LoadRecipientPub(path string) (*ecdh.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read recipient public key: %w", err)
+	}
+	raw, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("recipient public key %s must be 64 hex characters", path)
+	}
+	pub, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient public key: %w", err)
+	}
+	return pub, nil
+}
+
+// loadIdentityKey reads a hex-encoded X25519 private key from path.
+func loadIdentityKey(path string) (*ecdh.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read identity key: %w", err)
+	}
+	raw, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("identity key %s must be 64 hex characters", path)
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity key: %w", err)
+	}
+	return priv, nil
+}
+
+// wrapKEK derives the key-encryption key from the ECDH shared secret and both
+// public keys, so a frame cannot be replayed against a different recipient.
+func wrapKEK(shared, ephPub, recipientPub []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("tcpraw-x25519-v1"))
+	h.Write(shared)
+	h.Write(ephPub)
+	h.Write(recipientPub)
+	return h.Sum(nil)
+}
+
+// SealFileKey generates a random file key and seals it to recipientPub,
+// returning the key and the recipient frame carried in the upload header.
+func SealFileKey(recipientPub *ecdh.PublicKey) (fileKey, frame []byte, err error) {
+	fileKey = make([]byte, SecureKeySize)
+	if _, err := io.ReadFull(rand.Reader, fileKey); err != nil {
+		return nil, nil, fmt.Errorf("generate file key: %w", err)
+	}
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ephemeral key: %w", err)
+	}
+	shared, err := eph.ECDH(recipientPub)
+	if err != nil {
+		return nil, nil, fmt.Errorf("key agreement: %w", err)
+	}
+	ephPub := eph.PublicKey().Bytes()
+	kek := wrapKEK(shared, ephPub, recipientPub.Bytes())
+	nonce, sealed, err := EncryptWithKey(kek, fileKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("wrap file key: %w", err)
+	}
+	frame = make([]byte, 0, RecipientFrameSize)
+	frame = append(frame, ephPub...)
+	frame = append(frame, nonce...)
+	frame = append(frame, sealed...)
+	return fileKey, frame, nil
+}
+
+// UnsealFileKey recovers the file key from a recipient frame with the
+// identity key at path.
+func UnsealFileKey(path string, frame []byte) ([]byte, error) {
+	if len(frame) != RecipientFrameSize {
+		return nil, fmt.Errorf("invalid recipient frame length %d", len(frame))
+	}
+	priv, err := loadIdentityKey(path)
+	if err != nil {
+		return nil, err
+	}
+	ephPub, err := ecdh.X25519().NewPublicKey(frame[:32])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral key: %w", err)
+	}
+	shared, err := priv.ECDH(ephPub)
+	if err != nil {
+		return nil, fmt.Errorf("key agreement: %w", err)
+	}
+	kek := wrapKEK(shared, frame[:32], priv.PublicKey().Bytes())
+	fileKey, err := DecryptWithKey(kek, frame[32:32+gcmNonceSize], frame[32+gcmNonceSize:])
+	if err != nil {
+		return nil, fmt.Errorf("unwrap file key (wrong identity key?): %w", err)
+	}
+	return fileKey, nil
+}
+
+// ResolveTransferKey returns the decryption key for a download: the
+// code-derived key, or for recipient-encrypted uploads the file key unwrapped
+// with the identity key at identityPath.
+func ResolveTransferKey(code string, keyVersion byte, keyMaterial []byte, identityPath string) ([]byte, error) {
+	if keyVersion == KeyVersionX25519 {
+		if identityPath == "" {
+			return nil, fmt.Errorf("recipient-encrypted upload – pass -identity <keyfile>")
+		}
+		return UnsealFileKey(identityPath, keyMaterial)
+	}
+	return DeriveTransferKey(code, keyVersion, keyMaterial)
+}
@@ -0,0 +1,133 @@
+package protocol
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Ed25519 signing of uploads. `send -sign <keyfile>` signs the whole-file
+// integrity tag and embeds the signature plus public key in the versioned
+// upload header; `get -verify-signer <pubfile>` pins the expected signer and
+// refuses files whose signature is missing, forged or from a different key.
+// Keys live in hex text files: <keyfile> holds the 32-byte seed (mode 0600),
+// <keyfile>.pub the public key.
+
+// SignFrameSize is the wire size of a signer frame: public key then signature.
+const SignFrameSize = ed25519.PublicKeySize + ed25519.SignatureSize
+
+// RunKeygen generates an Ed25519 signing keypair and writes the seed to path
+// and the public key to path.pub. Refuses to overwrite an existing key.
+func RunKeygen(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return fmt.Errorf("generate key: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(priv.Seed())+"\n"), 0600); err != nil {
+		return fmt.Errorf("write key: %w", err)
+	}
+	pubPath := path + ".pub"
+	if err := os.WriteFile(pubPath, []byte(hex.EncodeToString(pub)+"\n"), 0644); err != nil {
+		return fmt.Errorf("write public key: %w", err)
+	}
+	fmt.Printf("Signing key written to %s, public key to %s\n", path, pubPath)
+	return nil
+}
+
+// LoadSigningKey reads a hex-encoded 32-byte Ed25519 seed from path.
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read signing key: %w", err)
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key %s must be %d hex characters", path, ed25519.SeedSize*2)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// LoadSignerPub reads a hex-encoded Ed25519 public key from path.
+func LoadSignerPub(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read signer public key: %w", err)
+	}
+	pub, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("signer public key %s must be %d hex characters", path, ed25519.PublicKeySize*2)
+	}
+	return ed25519.PublicKey(pub), nil
+}
+
+// WriteSignatureFrame writes the optional signer frame: a uint16 length that
+// is zero for unsigned uploads, or SignFrameSize followed by the public key
+// and the signature.
+func WriteSignatureFrame(w io.Writer, signerPub, signature []byte) error {
+	if len(signerPub) != ed25519.PublicKeySize || len(signature) != ed25519.SignatureSize {
+		return binary.Write(w, binary.BigEndian, uint16(0))
+	}
+	if err := binary.Write(w, binary.BigEndian, uint16(SignFrameSize)); err != nil {
+		return err
+	}
+	if _, err := w.Write(signerPub); err != nil {
+		return err
+	}
+	_, err := w.Write(signature)
+	return err
+}
+
+// ReadSignatureFrame reads a frame written by WriteSignatureFrame; both
+// returns are nil for unsigned uploads.
+func ReadSignatureFrame(r io.Reader) (signerPub, signature []byte, err error) {
+	var frameLen uint16
+	if err = binary.Read(r, binary.BigEndian, &frameLen); err != nil {
+		return nil, nil, err
+	}
+	if frameLen == 0 {
+		return nil, nil, nil
+	}
+	if frameLen != SignFrameSize {
+		return nil, nil, fmt.Errorf("invalid signer frame length %d", frameLen)
+	}
+	frame := make([]byte, SignFrameSize)
+	if _, err = io.ReadFull(r, frame); err != nil {
+		return nil, nil, err
+	}
+	return frame[:ed25519.PublicKeySize], frame[ed25519.PublicKeySize:], nil
+}
+
+// VerifyUploadSignature checks an embedded signer frame against the integrity
+// tag. With pinnedPath set (-verify-signer) the download is refused unless it
+// carries a valid signature from exactly that key; without it an embedded
+// signature is still verified but unsigned files pass.
+func VerifyUploadSignature(signerPub, signature, tag []byte, pinnedPath string) error {
+	if pinnedPath != "" {
+		pinned, err := LoadSignerPub(pinnedPath)
+		if err != nil {
+			return err
+		}
+		if len(signature) == 0 {
+			return fmt.Errorf("file is not signed but -verify-signer was given")
+		}
+		if !bytes.Equal(pinned, signerPub) {
+			return fmt.Errorf("signer public key does not match %s", pinnedPath)
+		}
+	}
+	if len(signature) == 0 {
+		return nil
+	}
+	if !ed25519.Verify(ed25519.PublicKey(signerPub), tag, signature) {
+		return fmt.Errorf("signature verification failed – file was not signed by the embedded key")
+	}
+	fmt.Printf("info: signature OK (signer %s…)\n", hex.EncodeToString(signerPub[:8]))
+	return nil
+}
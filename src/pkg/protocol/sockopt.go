@@ -0,0 +1,30 @@
+package protocol
+
+import (
+	"net"
+	"time"
+)
+
+// Socket option tuning, applied to every data connection on both the client
+// and the server. -nodelay=false re-enables Nagle batching for bulk-only
+// paths, -keepalive sets the probe period (0 = Go default, negative = off),
+// and -tcp-timeout bounds how long sent data may sit unacknowledged before
+// the kernel drops the connection (TCP_USER_TIMEOUT; Linux only).
+var (
+	TCPNoDelay     = true
+	TCPKeepAlive   time.Duration // 0 = Go default; <0 disables keepalive
+	TCPUserTimeout time.Duration // 0 = kernel default
+)
+
+func ApplySocketOptions(tc *net.TCPConn, warn func(string, error)) {
+	warn("set nodelay", tc.SetNoDelay(TCPNoDelay))
+	if TCPKeepAlive < 0 {
+		warn("disable keepalive", tc.SetKeepAlive(false))
+	} else if TCPKeepAlive > 0 {
+		warn("enable keepalive", tc.SetKeepAlive(true))
+		warn("set keepalive period", tc.SetKeepAlivePeriod(TCPKeepAlive))
+	}
+	if TCPUserTimeout > 0 {
+		warn("set tcp user timeout", setTCPUserTimeout(tc, TCPUserTimeout))
+	}
+}
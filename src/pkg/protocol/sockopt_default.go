@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package protocol
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+func setTCPUserTimeout(tc *net.TCPConn, d time.Duration) error {
+	return fmt.Errorf("TCP_USER_TIMEOUT is not supported on this platform")
+}
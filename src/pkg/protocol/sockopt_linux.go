@@ -0,0 +1,27 @@
+//go:build linux
+// +build linux
+
+package protocol
+
+import (
+	"net"
+	"syscall"
+	"time"
+)
+
+// tcpUserTimeoutOpt is TCP_USER_TIMEOUT, missing from the syscall package.
+const tcpUserTimeoutOpt = 0x12
+
+func setTCPUserTimeout(tc *net.TCPConn, d time.Duration) error {
+	raw, err := tc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpUserTimeoutOpt, int(d.Milliseconds()))
+	}); err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,126 @@
+package protocol
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// Server-side TLS state, set at RunServer start from flags.
+var (
+	ServerTLSConfig     *tls.Config
+	ServerMTLSDownloads bool
+)
+
+// Client-side TLS config, set in main from send/get flags; nil = plain TCP.
+var ClientTLSConfig *tls.Config
+
+// LoadServerTLSConfig builds the listener TLS config. If clientCAFile is set,
+// client certs are verified against that CA when presented; handleConn then
+// requires a verified cert for uploads (and downloads with -mtls-downloads).
+func LoadServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load server cert: %w", err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in client CA file %s", clientCAFile)
+		}
+		cfg.ClientCAs = pool
+		// Downloads stay open unless -mtls-downloads; enforcement per message
+		// type happens in handleConn after the type byte is read.
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
+
+// LoadClientTLSConfig builds the dial config for -tls connections.
+// certFile/keyFile present a client certificate (for mTLS servers), caFile
+// adds a private CA to the trust pool.
+func LoadClientTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cfg := &tls.Config{}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client cert: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA file %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// DialServer dials addr, wrapping the connection in TLS when the client was
+// started with -tls. Probes against the public list stay plain TCP. With
+// -tor the dial goes through the SOCKS5 proxy instead; .onion addresses
+// require it.
+func DialServer(addr string, timeout time.Duration) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	switch {
+	case IsPipeAddr(addr):
+		conn, err = DialNamedPipe(addr, timeout)
+	case TorSOCKSAddr != "":
+		conn, err = dialSOCKS5(TorSOCKSAddr, addr, timeout)
+	case IsOnionAddr(addr):
+		return nil, fmt.Errorf("%s only resolves inside Tor; add -tor=127.0.0.1:9050", addr)
+	default:
+		conn, err = net.DialTimeout(DialNetwork(), addr, timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	SetTCPBuffers(conn)
+	if ClientTLSConfig == nil {
+		return conn, nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	cfg := ClientTLSConfig.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	tc := tls.Client(conn, cfg)
+	tc.SetDeadline(time.Now().Add(timeout))
+	if err := tc.Handshake(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("tls handshake with %s: %w", addr, err)
+	}
+	tc.SetDeadline(time.Time{})
+	return tc, nil
+}
+
+// RequireClientCert reports whether conn carries a verified client
+// certificate. Always true for plain TCP or when no client CA is configured.
+func RequireClientCert(conn net.Conn) bool {
+	if ServerTLSConfig == nil || ServerTLSConfig.ClientCAs == nil {
+		return true
+	}
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return true
+	}
+	return len(tc.ConnectionState().PeerCertificates) > 0
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"tcpraw/pkg/protocol"
+	"tcpraw/pkg/store"
+)
+
+// Blocklist of codes and plaintext checksums the server refuses to serve,
+// persisted as one entry per line in <dataDir>/blocklist.txt. Entries are
+// either a 6-digit code or a 64-char hex SHA-256 of the plaintext (so a
+// re-uploaded identical file stays blocked under any new code).
+// Operators manage it by editing the file, via the /admin/block endpoint, or
+// through /report follow-up.
+
+const (
+	blocklistFilename  = "blocklist.txt"
+	reportLogFilename  = "reports.log"
+	maxReportReasonLen = 500
+)
+
+// serverBlocklist is loaded at RunServer start; nil outside server mode.
+var serverBlocklist *blocklist
+
+// AdminToken guards /admin/* endpoints on the web port; empty = disabled.
+var AdminToken string
+
+type blocklist struct {
+	mu      sync.RWMutex
+	entries map[string]bool // codes and lowercase hex checksums
+	path    string
+}
+
+func loadBlocklist(dataDir string) (*blocklist, error) {
+	bl := &blocklist{entries: make(map[string]bool), path: filepath.Join(dataDir, blocklistFilename)}
+	f, err := os.Open(bl.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return bl, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.ToLower(strings.TrimSpace(sc.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		bl.entries[line] = true
+	}
+	return bl, sc.Err()
+}
+
+// reload replaces the in-memory entries with the current file contents, so
+// operator edits to blocklist.txt take effect on SIGHUP without a restart.
+func (bl *blocklist) reload() error {
+	fresh, err := loadBlocklist(filepath.Dir(bl.path))
+	if err != nil {
+		return err
+	}
+	bl.mu.Lock()
+	bl.entries = fresh.entries
+	bl.mu.Unlock()
+	return nil
+}
+
+func (bl *blocklist) save() error {
+	bl.mu.RLock()
+	lines := make([]string, 0, len(bl.entries))
+	for e := range bl.entries {
+		lines = append(lines, e)
+	}
+	bl.mu.RUnlock()
+	return os.WriteFile(bl.path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+func (bl *blocklist) add(entry string) error {
+	entry = strings.ToLower(strings.TrimSpace(entry))
+	if entry == "" {
+		return fmt.Errorf("empty blocklist entry")
+	}
+	bl.mu.Lock()
+	bl.entries[entry] = true
+	bl.mu.Unlock()
+	return bl.save()
+}
+
+func (bl *blocklist) removeEntry(entry string) error {
+	entry = strings.ToLower(strings.TrimSpace(entry))
+	bl.mu.Lock()
+	delete(bl.entries, entry)
+	bl.mu.Unlock()
+	return bl.save()
+}
+
+// blocked reports whether a code or the blob's plaintext checksum is listed.
+func (bl *blocklist) blocked(code string, plaintextChecksum []byte) bool {
+	if bl == nil {
+		return false
+	}
+	bl.mu.RLock()
+	defer bl.mu.RUnlock()
+	if bl.entries[code] {
+		return true
+	}
+	if len(plaintextChecksum) > 0 && bl.entries[hex.EncodeToString(plaintextChecksum)] {
+		return true
+	}
+	return false
+}
+
+// handleReport appends an abuse report to <dataDir>/reports.log for operator
+// review. It does not auto-block: takedown decisions stay with the operator.
+func handleReport(st *store.Store, rl *rateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := extractIP(r.RemoteAddr)
+		if !rl.allow("report", ip) {
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		code := strings.TrimSpace(r.FormValue("code"))
+		reason := strings.TrimSpace(r.FormValue("reason"))
+		if !protocol.ValidCode(code) {
+			http.Error(w, "code must be 6 digits", http.StatusBadRequest)
+			return
+		}
+		if len(reason) > maxReportReasonLen {
+			reason = reason[:maxReportReasonLen]
+		}
+		reason = strings.ReplaceAll(reason, "\n", " ")
+		line := fmt.Sprintf("%s\t%s\t%s\t%s\n", time.Now().Format(time.RFC3339), ip, code, reason)
+		f, err := os.OpenFile(filepath.Join(st.DataDir(), reportLogFilename), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			http.Error(w, "report failed", http.StatusInternalServerError)
+			return
+		}
+		_, werr := f.WriteString(line)
+		if cerr := f.Close(); werr == nil {
+			werr = cerr
+		}
+		if werr != nil {
+			http.Error(w, "report failed", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "abuse report for code %s from %s\n", code, ip)
+		fmt.Fprintln(w, "report received")
+	}
+}
+
+// adminCookieName carries the token between dashboard page loads after the
+// one-time ?token= bootstrap, keeping it out of request lines that proxies
+// and access logs record.
+const adminCookieName = "tcpraw_admin"
+
+// adminRequestToken pulls the admin token out of a request: the
+// X-Admin-Token header, the session cookie, or a posted form field (the
+// dashboard buttons). Deliberately not the query string — URLs end up in
+// proxy and server logs.
+func adminRequestToken(r *http.Request) string {
+	if token := r.Header.Get("X-Admin-Token"); token != "" {
+		return token
+	}
+	if c, err := r.Cookie(adminCookieName); err == nil && c.Value != "" {
+		return c.Value
+	}
+	return r.PostFormValue("token")
+}
+
+// adminTokenOK compares in constant time; a plain != would let response
+// timing leak how much of a guessed token matches.
+func adminTokenOK(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(AdminToken)) == 1
+}
+
+// requireAdmin wraps admin endpoints with token auth: X-Admin-Token header,
+// session cookie, or posted form field. A valid ?token= is accepted once as
+// a browser bootstrap: it sets the cookie and redirects to the same URL
+// with the token stripped, so it never sticks around in the location bar.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if AdminToken == "" {
+			http.Error(w, "admin API disabled (start server with -admintoken)", http.StatusForbidden)
+			return
+		}
+		if !adminTokenOK(adminRequestToken(r)) {
+			if q := r.URL.Query(); adminTokenOK(q.Get("token")) {
+				http.SetCookie(w, &http.Cookie{Name: adminCookieName, Value: q.Get("token"), Path: "/admin", HttpOnly: true, SameSite: http.SameSiteStrictMode})
+				q.Del("token")
+				clean := *r.URL
+				clean.RawQuery = q.Encode()
+				http.Redirect(w, r, clean.String(), http.StatusFound)
+				return
+			}
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func handleAdminBlock(unblock bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entry := strings.TrimSpace(r.FormValue("entry"))
+		if entry == "" {
+			http.Error(w, "entry required (code or hex checksum)", http.StatusBadRequest)
+			return
+		}
+		var err error
+		if unblock {
+			err = serverBlocklist.removeEntry(entry)
+		} else {
+			err = serverBlocklist.add(entry)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"tcpraw/pkg/protocol"
+	"tcpraw/pkg/store"
+)
+
+// Admin pin operations: a pinned code is skipped by the cleanup loop and
+// never expires until unpinned (legal hold, long-running handoffs). Pins are
+// stored on the blob itself so they survive restarts.
+
+// adminDone finishes a mutating admin request: requests from the dashboard
+// buttons carry back=1 and bounce back to /admin, curl gets the plain line.
+func adminDone(w http.ResponseWriter, r *http.Request, format string, args ...any) {
+	if r.FormValue("back") != "" {
+		// The session cookie (or the form's hidden token) re-authenticates
+		// the dashboard; no token in the redirect URL.
+		http.Redirect(w, r, "/admin", http.StatusFound)
+		return
+	}
+	fmt.Fprintf(w, format+"\n", args...)
+}
+
+// handleAdminDelete removes a stored code immediately (the dashboard's
+// delete button; also usable from curl).
+func handleAdminDelete(st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := strings.TrimSpace(r.FormValue("code"))
+		if !protocol.ValidCode(code) {
+			http.Error(w, "code must be 6 digits", http.StatusBadRequest)
+			return
+		}
+		if _, ok := st.Get(code); !ok {
+			http.Error(w, "code not found or expired", http.StatusNotFound)
+			return
+		}
+		st.Remove(code)
+		adminDone(w, r, "deleted %s", code)
+	}
+}
+
+func handleAdminPin(st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := strings.TrimSpace(r.FormValue("code"))
+		if !protocol.ValidCode(code) {
+			http.Error(w, "code must be 6 digits", http.StatusBadRequest)
+			return
+		}
+		blob, ok := st.Get(code)
+		if !ok {
+			http.Error(w, "code not found or expired", http.StatusNotFound)
+			return
+		}
+		blob.Pinned = true
+		blob.PinnedBy = strings.TrimSpace(r.FormValue("by"))
+		blob.PinReason = strings.TrimSpace(r.FormValue("reason"))
+		blob.PinnedAt = time.Now()
+		if err := st.Put(code, blob); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		adminDone(w, r, "pinned %s", code)
+	}
+}
+
+func handleAdminUnpin(st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := strings.TrimSpace(r.FormValue("code"))
+		if !protocol.ValidCode(code) {
+			http.Error(w, "code must be 6 digits", http.StatusBadRequest)
+			return
+		}
+		blob, ok := st.Get(code)
+		if !ok {
+			http.Error(w, "code not found or expired", http.StatusNotFound)
+			return
+		}
+		blob.Pinned = false
+		blob.PinnedBy = ""
+		blob.PinReason = ""
+		blob.PinnedAt = time.Time{}
+		if err := st.Put(code, blob); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		adminDone(w, r, "unpinned %s", code)
+	}
+}
+
+// handleAdminCleanup runs an expiry sweep immediately instead of waiting for
+// the next -cleanup tick, e.g. after lowering -ttl or under disk pressure.
+func handleAdminCleanup(st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		removed := st.CleanupExpired()
+		fmt.Fprintf(w, "cleanup done, removed %d expired codes\n", removed)
+	}
+}
+
+// handleAdminPins lists pinned codes with who pinned them and why.
+func handleAdminPins(st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		codes := st.Codes()
+		count := 0
+		for _, code := range codes {
+			blob, ok := st.Get(code)
+			if !ok || !blob.Pinned {
+				continue
+			}
+			count++
+			fmt.Fprintf(w, "%s\t%s\tpinned %s by %q: %s\n",
+				code, blob.Name, blob.PinnedAt.Format(time.RFC3339), blob.PinnedBy, blob.PinReason)
+		}
+		if count == 0 {
+			fmt.Fprintln(w, "no pinned codes")
+		}
+	}
+}
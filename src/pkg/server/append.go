@@ -0,0 +1,77 @@
+package server
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"tcpraw/pkg/protocol"
+	"tcpraw/pkg/store"
+)
+
+// Appends (MsgAppend): the original uploader grows a stored blob with new
+// trailing chunks, so an expanding log or multi-part export is delivered
+// incrementally under one code. Unlike delta updates, authority is the
+// owner token minted at upload time — holding the code alone is not enough
+// — so passworded blobs may be appended to. The chunk splicing itself is
+// the delta machinery (delta.go); the client sends the old final chunk and
+// everything after it.
+
+// appendCapable reports whether a stored blob can take appends.
+func appendCapable(blob *store.StoredBlob) bool {
+	return blob.Chunked && !blob.Secure && blob.OwnerTokenHash != nil &&
+		protocol.HeaderHasChunkSums(blob.KeyVersion) &&
+		blob.KeyVersion != protocol.KeyVersionX25519 && blob.Signature == nil
+}
+
+func handleAppend(conn net.Conn, r io.Reader, st *store.Store) {
+	ip := extractIP(conn.RemoteAddr().String())
+	code, err := protocol.ReadDownloadRequest(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read code: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	token := make([]byte, protocol.OwnerTokenSize)
+	if _, err := io.ReadFull(r, token); err != nil {
+		fmt.Fprintf(os.Stderr, "read owner token: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	defer lockUpdate(code)()
+	blob, ok := st.Get(code)
+	if !ok || blob.Quarantined || serverBlocklist.blocked(code, blob.PlaintextChecksum) {
+		protocol.SendStatus(conn, protocol.StatusNotFound)
+		return
+	}
+	if !appendCapable(blob) {
+		fmt.Fprintf(os.Stderr, "append refused for code %s: blob not appendable (%s)\n", code, ip)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	if !hmac.Equal(protocol.HashOwnerToken(token), blob.OwnerTokenHash) {
+		fmt.Fprintf(os.Stderr, "append refused for code %s: bad owner token (%s)\n", code, ip)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	chunkPlainLen, err := storedChunkPlainLen(st.DataPath(code))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "append signature for %s: %v\n", code, err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+
+	bw := bufio.NewWriterSize(conn, protocol.BufSize)
+	bw.Write([]byte{protocol.StatusOK})
+	if err := protocol.WriteDeltaSignature(bw, blob.KeyVersion, blob.KeySalt, chunkPlainLen, blob.TotalPlainLen, blob.NumChunks, blob.Generation+1, blob.ChunkSums); err != nil {
+		fmt.Fprintf(os.Stderr, "send append signature: %v\n", err)
+		return
+	}
+	if err := bw.Flush(); err != nil {
+		return
+	}
+	spliceUpdate(conn, r, st, code, blob, "append")
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Explicit IP bans, managed through /admin/ban and /admin/unban and persisted
+// as one tab-separated line per ban in <dataDir>/bans.txt (ip, expiry in
+// RFC 3339, reason). An operator responding to live abuse bans an address
+// immediately instead of waiting for the limiter thresholds to trip, and the
+// ban survives a restart or a SIGUSR2 binary handover. Expired entries are
+// pruned whenever the file is loaded or rewritten.
+
+const bansFilename = "bans.txt"
+
+// loadBans attaches the bans file under dataDir to the limiter and loads the
+// still-active entries. A missing file is fine: no bans yet.
+func (rl *rateLimiter) loadBans(dataDir string) error {
+	rl.mu.Lock()
+	rl.bansPath = filepath.Join(dataDir, bansFilename)
+	rl.mu.Unlock()
+	f, err := os.Open(filepath.Join(dataDir, bansFilename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	now := time.Now()
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.SplitN(sc.Text(), "\t", 3)
+		if len(fields) < 2 {
+			continue
+		}
+		until, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil || until.Before(now) {
+			continue
+		}
+		rl.banned[fields[0]] = until
+		if len(fields) == 3 {
+			rl.reasons[fields[0]] = fields[2]
+		}
+	}
+	return sc.Err()
+}
+
+// saveBansLocked rewrites the bans file from the in-memory state, dropping
+// expired entries. Best effort: a write failure is logged, not fatal — the
+// ban still holds until this process exits. Called with mu held.
+func (rl *rateLimiter) saveBansLocked() {
+	if rl.bansPath == "" {
+		return
+	}
+	now := time.Now()
+	var b strings.Builder
+	for ip, until := range rl.banned {
+		if until.Before(now) {
+			continue
+		}
+		fmt.Fprintf(&b, "%s\t%s\t%s\n", ip, until.Format(time.RFC3339), rl.reasons[ip])
+	}
+	if err := os.WriteFile(rl.bansPath, []byte(b.String()), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "save bans: %v\n", err)
+	}
+}
+
+// handleAdminBan bans an IP immediately: ip (required), duration (optional,
+// default -ban), reason (optional, kept for the bans listing).
+func handleAdminBan(rl *rateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := strings.TrimSpace(r.FormValue("ip"))
+		if net.ParseIP(ip) == nil {
+			http.Error(w, "ip required (a literal IPv4 or IPv6 address)", http.StatusBadRequest)
+			return
+		}
+		var d time.Duration
+		if v := strings.TrimSpace(r.FormValue("duration")); v != "" {
+			var err error
+			if d, err = time.ParseDuration(v); err != nil || d <= 0 {
+				http.Error(w, "bad duration (e.g. 30m, 24h)", http.StatusBadRequest)
+				return
+			}
+		}
+		reason := strings.TrimSpace(r.FormValue("reason"))
+		if reason == "" {
+			reason = "banned by operator"
+		}
+		until := rl.banIP(ip, d, reason)
+		fmt.Fprintf(os.Stderr, "admin ban: %s until %s: %s\n", ip, until.Format(time.RFC3339), reason)
+		adminDone(w, r, "banned %s until %s", ip, until.Format(time.RFC3339))
+	}
+}
+
+// handleAdminUnban lifts an explicit ban immediately.
+func handleAdminUnban(rl *rateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := strings.TrimSpace(r.FormValue("ip"))
+		if ip == "" {
+			http.Error(w, "ip required", http.StatusBadRequest)
+			return
+		}
+		if !rl.unban(ip) {
+			http.Error(w, "ip not banned", http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "admin unban: %s\n", ip)
+		adminDone(w, r, "unbanned %s", ip)
+	}
+}
+
+// handleAdminBans lists the active explicit bans with expiry and reason.
+func handleAdminBans(rl *rateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		banned, _ := rl.snapshot()
+		ips := make([]string, 0, len(banned))
+		for ip := range banned {
+			ips = append(ips, ip)
+		}
+		sort.Strings(ips)
+		count := 0
+		for _, ip := range ips {
+			until := banned[ip]
+			if until.Before(time.Now()) {
+				continue
+			}
+			count++
+			fmt.Fprintf(w, "%s\tuntil %s\t%s\n", ip, until.Format(time.RFC3339), rl.banReason(ip))
+		}
+		if count == 0 {
+			fmt.Fprintln(w, "no active bans")
+		}
+	}
+}
+
+// banReason returns the recorded reason for a banned IP, if any.
+func (rl *rateLimiter) banReason(ip string) string {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.reasons[ip]
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"tcpraw/pkg/protocol"
+	"tcpraw/pkg/store"
+)
+
+// Existence and integrity check (MsgCheck): answer whether a code is still
+// stored and whether its payload passes the same framing validation the
+// offline verify pass runs, plus a digest of the sealed data — all without
+// streaming the payload. A sender runs it right before telling someone
+// "it's ready".
+
+func handleCheck(conn net.Conn, r io.Reader, st *store.Store) {
+	code, err := protocol.ReadDownloadRequest(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read code: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	blob, ok := st.Get(code)
+	if !ok || blob.Quarantined || serverBlocklist.blocked(code, blob.PlaintextChecksum) {
+		protocol.SendStatus(conn, protocol.StatusNotFound)
+		return
+	}
+	if blob.RedirectCode != "" {
+		if protocol.SendStatus(conn, protocol.StatusRedirect) == nil {
+			protocol.WriteDownloadRequest(conn, blob.RedirectCode)
+		}
+		return
+	}
+	if remaining := time.Until(blob.NotBefore); remaining > 0 {
+		if protocol.SendStatus(conn, protocol.StatusEmbargoed) == nil {
+			binary.Write(conn, binary.BigEndian, uint32(remaining.Seconds())+1)
+		}
+		return
+	}
+	if err := st.VerifyBlob(code, blob); err != nil {
+		fmt.Fprintf(os.Stderr, "check: code %s corrupt: %v\n", code, err)
+		protocol.SendStatus(conn, protocol.StatusCorrupt)
+		return
+	}
+	digest, err := sealedDigest(st, code, blob)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "check: digest for code %s: %v\n", code, err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	remaining := time.Until(st.ExpiryOf(blob))
+	if remaining < 0 {
+		remaining = 0
+	}
+	protocol.SendStatus(conn, protocol.StatusOK)
+	if err := protocol.WriteCheckReport(conn, blob.Name, blob.TotalPlainLen, blob.NumChunks, uint32(remaining.Seconds()), digest); err != nil {
+		fmt.Fprintf(os.Stderr, "send check report: %v\n", err)
+	}
+}
+
+// sealedDigest hashes the sealed payload exactly as stored, whichever of
+// the store's representations holds it.
+func sealedDigest(st *store.Store, code string, blob *store.StoredBlob) ([]byte, error) {
+	h := sha256.New()
+	switch {
+	case blob.Chunked || blob.SealedInFile:
+		df, err := os.Open(st.DataPath(code))
+		if err != nil {
+			return nil, err
+		}
+		defer df.Close()
+		if _, err := io.Copy(h, diskReader(df)); err != nil {
+			return nil, err
+		}
+	case blob.Chunks != nil:
+		for _, c := range blob.Chunks {
+			h.Write(c.Sealed)
+		}
+	default:
+		h.Write(blob.Sealed)
+	}
+	return h.Sum(nil), nil
+}
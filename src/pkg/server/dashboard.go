@@ -0,0 +1,145 @@
+package server
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"tcpraw/pkg/protocol"
+	"tcpraw/pkg/store"
+)
+
+// /admin: an HTML companion to the plain-text admin endpoints for operators
+// who prefer a browser over curl. One page, no JavaScript beyond a refresh
+// meta tag: live counters, the stored codes with sizes and expiry
+// countdowns, the rate-limiter state, and per-code delete / pin / unpin
+// buttons that post to the existing endpoints. Guarded by the same
+// -admintoken as the rest of /admin/*.
+
+var dashboardTmpl = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="10">
+<title>tcpraw admin</title>
+<style>
+body { font-family: monospace; margin: 2em; background: #f7f7f7; }
+table { border-collapse: collapse; margin: 1em 0; background: #fff; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: left; }
+th { background: #eee; }
+.stats { background: #fff; border: 1px solid #ccc; padding: 8px 12px; display: inline-block; }
+.pinned { color: #0a0; }
+.quarantined { color: #a00; }
+form { display: inline; margin: 0; }
+button { font-family: monospace; }
+</style>
+</head>
+<body>
+<h2>tcpraw admin</h2>
+<div class="stats">{{.Stats}}</div>
+
+<h3>stored codes ({{len .Codes}})</h3>
+<table>
+<tr><th>code</th><th>name</th><th>size</th><th>expires in</th><th>flags</th><th></th></tr>
+{{range .Codes}}
+<tr>
+<td>{{.Code}}</td>
+<td>{{.Name}}</td>
+<td>{{.Size}}</td>
+<td>{{.ExpiresIn}}</td>
+<td>{{if .Pinned}}<span class="pinned">pinned</span>{{end}} {{if .Quarantined}}<span class="quarantined">quarantined</span>{{end}} {{if .Secure}}secure{{end}}</td>
+<td>
+<form method="post" action="/admin/delete"><input type="hidden" name="token" value="{{$.Token}}"><input type="hidden" name="code" value="{{.Code}}"><input type="hidden" name="back" value="1"><button>delete</button></form>
+{{if .Pinned}}<form method="post" action="/admin/unpin"><input type="hidden" name="token" value="{{$.Token}}"><input type="hidden" name="code" value="{{.Code}}"><input type="hidden" name="back" value="1"><button>unpin</button></form>
+{{else}}<form method="post" action="/admin/pin"><input type="hidden" name="token" value="{{$.Token}}"><input type="hidden" name="code" value="{{.Code}}"><input type="hidden" name="back" value="1"><button>pin</button></form>{{end}}
+</td>
+</tr>
+{{else}}
+<tr><td colspan="6">nothing stored</td></tr>
+{{end}}
+</table>
+
+<h3>rate limiter</h3>
+<table>
+<tr><th>banned ip</th><th>lifted in</th></tr>
+{{range .Bans}}<tr><td>{{.IP}}</td><td>{{.LiftedIn}}</td></tr>
+{{else}}<tr><td colspan="2">no bans</td></tr>{{end}}
+</table>
+<table>
+<tr><th>ip</th><th>attempts in window</th></tr>
+{{range .Attempts}}<tr><td>{{.IP}}</td><td>{{.Count}}</td></tr>
+{{else}}<tr><td colspan="2">no recent attempts</td></tr>{{end}}
+</table>
+</body>
+</html>
+`))
+
+type dashboardCode struct {
+	Code, Name, Size, ExpiresIn string
+	Pinned, Quarantined, Secure bool
+}
+
+type dashboardBan struct {
+	IP, LiftedIn string
+}
+
+type dashboardAttempt struct {
+	IP    string
+	Count int
+}
+
+func handleAdminDashboard(st *store.Store, rl *rateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		var codes []dashboardCode
+		for _, code := range st.Codes() {
+			blob, ok := st.Get(code)
+			if !ok {
+				continue
+			}
+			expires := "pinned"
+			if !blob.Pinned {
+				expires = st.ExpiryOf(blob).Sub(now).Round(time.Second).String()
+			}
+			codes = append(codes, dashboardCode{
+				Code:        code,
+				Name:        blob.Name,
+				Size:        protocol.FormatBytes(float64(blob.TotalPlainLen)),
+				ExpiresIn:   expires,
+				Pinned:      blob.Pinned,
+				Quarantined: blob.Quarantined,
+				Secure:      blob.Secure,
+			})
+		}
+		sort.Slice(codes, func(i, j int) bool { return codes[i].Code < codes[j].Code })
+
+		banned, spent := rl.snapshot()
+		var bans []dashboardBan
+		for ip, until := range banned {
+			bans = append(bans, dashboardBan{IP: ip, LiftedIn: until.Sub(now).Round(time.Second).String()})
+		}
+		sort.Slice(bans, func(i, j int) bool { return bans[i].IP < bans[j].IP })
+		var atts []dashboardAttempt
+		for ip, used := range spent {
+			atts = append(atts, dashboardAttempt{IP: ip, Count: used})
+		}
+		sort.Slice(atts, func(i, j int) bool { return atts[i].Count > atts[j].Count })
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		dashboardTmpl.Execute(w, struct {
+			Stats    string
+			Token    string
+			Codes    []dashboardCode
+			Bans     []dashboardBan
+			Attempts []dashboardAttempt
+		}{
+			Stats:    strings.TrimPrefix(statsLine(st), "stats: "),
+			Token:    adminRequestToken(r),
+			Codes:    codes,
+			Bans:     bans,
+			Attempts: atts,
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"tcpraw/pkg/protocol"
+	"tcpraw/pkg/store"
+)
+
+// Delta updates (MsgDeltaUpload): splice replacement chunks into a stored
+// chunked blob so a re-transfer of a slightly changed file only costs the
+// changed blocks. Knowing the code already means full read access, so the
+// code is also accepted as update authority; blobs where that would break a
+// stronger guarantee (passworded, signed, recipient-encrypted, secure) are
+// refused.
+
+// updateLocks serializes delta/append sessions per code. Two concurrent
+// updates would both be told to seal under the same next nonce generation —
+// recreating exactly the (key, nonce) reuse the generation scheme exists to
+// prevent — and their rename + index writes would race as a lost update.
+// Entries are a mutex each and the code space caps at a million, so they are
+// never evicted.
+var updateLocks = struct {
+	mu sync.Mutex
+	m  map[string]*sync.Mutex
+}{m: make(map[string]*sync.Mutex)}
+
+// lockUpdate takes the per-code update lock; hold it from reading the
+// blob's generation through st.Put.
+func lockUpdate(code string) func() {
+	updateLocks.mu.Lock()
+	l, ok := updateLocks.m[code]
+	if !ok {
+		l = &sync.Mutex{}
+		updateLocks.m[code] = l
+	}
+	updateLocks.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+// deltaCapable reports whether a stored blob can take delta updates.
+func deltaCapable(blob *store.StoredBlob) bool {
+	return blob.Chunked && !blob.Secure &&
+		protocol.HeaderHasChunkSums(blob.KeyVersion) &&
+		blob.KeyVersion != protocol.KeyVersionX25519 &&
+		blob.PasswordHash == nil && blob.Signature == nil
+}
+
+// storedChunkPlainLen reads the first record header of the .dat to recover
+// the chunk size the original upload used; the client must chunk the new
+// file on the same boundaries for the digests to line up.
+func storedChunkPlainLen(path string) (uint32, error) {
+	df, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer df.Close()
+	var header [16]byte
+	if _, err := io.ReadFull(df, header[:]); err != nil {
+		return 0, err
+	}
+	sealedLen := binary.BigEndian.Uint32(header[12:16])
+	if sealedLen < 16 {
+		return 0, fmt.Errorf("corrupt chunk record")
+	}
+	return sealedLen - 16, nil
+}
+
+func handleDeltaUpload(conn net.Conn, r io.Reader, st *store.Store) {
+	ip := extractIP(conn.RemoteAddr().String())
+	code, err := protocol.ReadDownloadRequest(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read code: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	defer lockUpdate(code)()
+	blob, ok := st.Get(code)
+	if !ok || blob.Quarantined || serverBlocklist.blocked(code, blob.PlaintextChecksum) {
+		protocol.SendStatus(conn, protocol.StatusNotFound)
+		return
+	}
+	if !deltaCapable(blob) {
+		fmt.Fprintf(os.Stderr, "delta refused for code %s: blob not delta-capable (%s)\n", code, ip)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	chunkPlainLen, err := storedChunkPlainLen(st.DataPath(code))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "delta signature for %s: %v\n", code, err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+
+	bw := bufio.NewWriterSize(conn, protocol.BufSize)
+	bw.Write([]byte{protocol.StatusOK})
+	if err := protocol.WriteDeltaSignature(bw, blob.KeyVersion, blob.KeySalt, chunkPlainLen, blob.TotalPlainLen, blob.NumChunks, blob.Generation+1, blob.ChunkSums); err != nil {
+		fmt.Fprintf(os.Stderr, "send delta signature: %v\n", err)
+		return
+	}
+	if err := bw.Flush(); err != nil {
+		return
+	}
+	spliceUpdate(conn, r, st, code, blob, "delta update")
+}
+
+// spliceUpdate receives the client's new layout and replacement chunks and
+// splices them into the stored blob. Shared tail of the delta-update and
+// append handlers; the signature frame has already been sent.
+func spliceUpdate(conn net.Conn, r io.Reader, st *store.Store, code string, blob *store.StoredBlob, verb string) {
+	ip := extractIP(conn.RemoteAddr().String())
+	newTotal, newNum, err := protocol.ReadDeltaLayout(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read delta layout: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	// Size check and disk reservation before the digest block: newNum sizes
+	// that allocation, so an oversize declaration must die here, not after
+	// the server has buffered gigabytes of digests.
+	if maxSize := serverMaxBlobSize.Load(); maxSize > 0 && int64(newTotal) > maxSize {
+		fmt.Fprintf(os.Stderr, "%s rejected: blob exceeds max size %d MB\n", verb, maxSize/(1024*1024))
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	release, err := uploadLedger.reserve(reservedUploadBytes(newTotal, newNum), st.DataDir())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s rejected: %v\n", verb, err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	defer release()
+	checksum, newSums, changed, err := protocol.ReadDeltaSums(r, newNum)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read delta header: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+
+	fmt.Printf("info: %s for code %s: %d of %d chunks\n", verb, code, changed, newNum)
+
+	old, err := os.Open(st.DataPath(code))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open data file: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	defer old.Close()
+	tmpPath := st.TempDataPath(code)
+	df, err := os.Create(tmpPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "create data file: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	dw := diskWriter(df)
+	or := diskReader(old)
+
+	fail := func(format string, args ...any) {
+		df.Close()
+		os.Remove(tmpPath)
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+		protocol.SendStatus(conn, protocol.StatusError)
+	}
+
+	// Walk the new chunk list once; the old file is read strictly forward,
+	// so a reused record is copied and a replaced one is skipped in step.
+	nonce := make([]byte, protocol.NonceSize)
+	var sealed []byte
+	var plainCount, changedPlain uint64
+	nextIdx := uint32(0)
+	pending := changed
+	haveNext := false
+	var header [16]byte
+	for i := uint32(0); i < newNum; i++ {
+		if !haveNext && pending > 0 {
+			var idx uint32
+			idx, sealed, err = protocol.ReadDeltaChunk(r, nonce, sealed)
+			if err != nil {
+				fail("read delta chunk: %v", err)
+				return
+			}
+			if idx < i || idx >= newNum {
+				fail("delta chunk index %d out of order", idx)
+				return
+			}
+			nextIdx, haveNext = idx, true
+			pending--
+		}
+		if haveNext && nextIdx == i {
+			binary.BigEndian.PutUint32(header[12:16], uint32(len(sealed)))
+			copy(header[:12], nonce)
+			if _, err := dw.Write(header[:]); err != nil {
+				fail("write chunk record: %v", err)
+				return
+			}
+			if _, err := dw.Write(sealed); err != nil {
+				fail("write chunk record: %v", err)
+				return
+			}
+			plainCount += uint64(len(sealed) - 16)
+			changedPlain += uint64(len(sealed) - 16)
+			haveNext = false
+			if i < blob.NumChunks {
+				// Skip the record this one replaces.
+				if err := skipOldRecord(or); err != nil {
+					fail("skip old chunk %d: %v", i, err)
+					return
+				}
+			}
+			continue
+		}
+		if i >= blob.NumChunks {
+			fail("chunk %d beyond stored blob and not in delta", i)
+			return
+		}
+		n, err := copyOldRecord(or, dw)
+		if err != nil {
+			fail("copy old chunk %d: %v", i, err)
+			return
+		}
+		plainCount += n
+	}
+	if pending > 0 || haveNext {
+		fail("delta carries chunks beyond the new layout")
+		return
+	}
+	if plainCount != newTotal {
+		fail("mismatched plaintext length: header=%d, spliced=%d", newTotal, plainCount)
+		return
+	}
+	if store.DurableUploads {
+		if err := df.Sync(); err != nil {
+			fail("sync data file: %v", err)
+			return
+		}
+	}
+	if err := df.Close(); err != nil {
+		os.Remove(tmpPath)
+		fmt.Fprintf(os.Stderr, "close data file: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	old.Close()
+	if err := os.Rename(tmpPath, st.DataPath(code)); err != nil {
+		os.Remove(tmpPath)
+		fmt.Fprintf(os.Stderr, "finalize data file: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	if store.DurableUploads {
+		store.SyncDir(st.DataDir())
+	}
+
+	blob.TotalPlainLen = newTotal
+	blob.NumChunks = newNum
+	blob.PlaintextChecksum = checksum
+	blob.ChunkSums = newSums
+	// The client recomputed the tag with the key version's default hasher,
+	// so the advertised checksum algorithm must match again.
+	blob.MetaFrame = protocol.MetaFrameWithHash(blob.MetaFrame, protocol.HashSHA256)
+	// The replacement chunks were sealed under the next nonce generation
+	// (announced in the signature frame); record it so the following
+	// update moves on again.
+	blob.Generation++
+	now := time.Now()
+	blob.CreatedAt = now
+	// An accepted update restarts the clock like a fresh upload — the reply
+	// below promises the remaining TTL — but never shortens an expiry
+	// already granted (long-term blobs keep theirs).
+	if e := now.Add(st.TTL()); st.ExpiryOf(blob).Before(e) {
+		blob.ExpiresAt = e
+	}
+	if err := st.Put(code, blob); err != nil {
+		fmt.Fprintf(os.Stderr, "save to disk: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	srvStats.uploads.Add(1)
+	srvStats.bytesIn.Add(int64(changedPlain))
+	hookUploadComplete(code, blob.Name, int64(changedPlain), ip)
+	fmt.Printf("Updated: %s (code %s), %d of %d chunks replaced\n", blob.Name, code, changed, newNum)
+	protocol.SendStatus(conn, protocol.StatusOK)
+	binary.Write(conn, binary.BigEndian, uint32(time.Until(st.ExpiryOf(blob)).Seconds()))
+	if scanEnabled() {
+		go scanStoredUpload(st, code)
+	}
+}
+
+// skipOldRecord advances past one chunk record of the old .dat.
+func skipOldRecord(r io.Reader) error {
+	var header [16]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+	sealedLen := binary.BigEndian.Uint32(header[12:16])
+	_, err := io.CopyN(io.Discard, r, int64(sealedLen))
+	return err
+}
+
+// copyOldRecord copies one chunk record of the old .dat into the new one
+// and returns its plaintext length.
+func copyOldRecord(r io.Reader, w io.Writer) (uint64, error) {
+	var header [16]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, err
+	}
+	sealedLen := binary.BigEndian.Uint32(header[12:16])
+	if sealedLen < 16 {
+		return 0, fmt.Errorf("corrupt chunk record")
+	}
+	if _, err := w.Write(header[:]); err != nil {
+		return 0, err
+	}
+	if _, err := io.CopyN(w, r, int64(sealedLen)); err != nil {
+		return 0, err
+	}
+	return uint64(sealedLen - 16), nil
+}
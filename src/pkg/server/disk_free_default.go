@@ -1,6 +1,7 @@
+//go:build !linux && !darwin && !freebsd && !windows
 // +build !linux,!darwin,!freebsd,!windows
 
-package main
+package server
 
 import "math"
 
@@ -1,6 +1,7 @@
+//go:build linux || darwin || freebsd
 // +build linux darwin freebsd
 
-package main
+package server
 
 import (
 	"syscall"
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"tcpraw/pkg/client"
+)
+
+// GatewayMode (-gateway) turns the web port into a front for the whole
+// network: a code that is not stored locally is routed to its owning server
+// — first digit, same rule the CLI uses — fetched over the TCP protocol and
+// decrypted here, then streamed to the browser. One well-known HTTPS URL
+// can then serve any valid network code.
+var GatewayMode bool
+
+// gatewayDownload fetches code from its owning server and streams the
+// plaintext to w. The filename is not known until the remote header has
+// been parsed, which is after response headers are out, so the
+// Content-Disposition falls back to the code.
+func gatewayDownload(w http.ResponseWriter, code string, fail func(status int, msg string)) {
+	c := &client.Client{} // empty Addr = route by the code's first digit
+	w.Header().Set("Content-Disposition", "attachment; filename=\"tcpraw-"+code+"\"")
+	w.Header().Set("Content-Type", "application/octet-stream")
+	name, err := c.Get(context.Background(), code, w)
+	if err == nil {
+		fmt.Printf("gateway: served %s (code %s) from the owning server\n", name, code)
+		return
+	}
+	switch {
+	case errors.Is(err, client.ErrNotFound):
+		fail(http.StatusNotFound, "Code not found or expired")
+	case errors.Is(err, client.ErrPasswordRequired):
+		fail(http.StatusUnauthorized, "This code requires a password; use the tcpraw client")
+	case errors.Is(err, client.ErrSecureKeyRequired):
+		fail(http.StatusForbidden, "Secure upload. Use tcpraw get with your key to download.")
+	case errors.Is(err, client.ErrChecksumMismatch):
+		fail(http.StatusBadGateway, "Owning server returned corrupted data")
+	default:
+		var netErr net.Error
+		if errors.As(err, &netErr) {
+			fail(http.StatusBadGateway, "Owning server unreachable")
+			return
+		}
+		fail(http.StatusBadGateway, "Gateway fetch failed")
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+)
+
+// Hooks receives server lifecycle events for custom accounting, notification
+// or policy pipelines. Programs embedding Server register their own
+// implementation with RegisterHooks; CLI operators get the two built-in
+// dispatchers instead: -webhook posts the events as JSON and -hook-cmd runs
+// an external command per event. Every callback is invoked on its own
+// goroutine, so implementations may block without stalling transfers.
+type Hooks interface {
+	OnUploadComplete(code, name string, size int64, ip string)
+	OnDownload(code, name, ip string)
+	OnExpire(code string)
+	OnReject(code, name, reason, ip string)
+}
+
+// HookCommand is the external event dispatcher (-hook-cmd): it is run once
+// per event with the event name as the only argument and the details in
+// TCPRAW_CODE, TCPRAW_NAME, TCPRAW_SIZE, TCPRAW_IP and TCPRAW_REASON
+// environment variables. Empty = disabled.
+var HookCommand string
+
+var (
+	hooksMu    sync.RWMutex
+	eventHooks []Hooks
+)
+
+// RegisterHooks adds h to the dispatch list. Safe to call concurrently, but
+// registered hooks cannot be removed.
+func RegisterHooks(h Hooks) {
+	hooksMu.Lock()
+	eventHooks = append(eventHooks, h)
+	hooksMu.Unlock()
+}
+
+func eachHook(f func(Hooks)) {
+	hooksMu.RLock()
+	hs := eventHooks
+	hooksMu.RUnlock()
+	for _, h := range hs {
+		go f(h)
+	}
+}
+
+func hookUploadComplete(code, name string, size int64, ip string) {
+	eachHook(func(h Hooks) { h.OnUploadComplete(code, name, size, ip) })
+}
+
+func hookDownload(code, name, ip string) {
+	eachHook(func(h Hooks) { h.OnDownload(code, name, ip) })
+}
+
+func hookExpire(code string) {
+	eachHook(func(h Hooks) { h.OnExpire(code) })
+}
+
+func hookReject(code, name, reason, ip string) {
+	eachHook(func(h Hooks) { h.OnReject(code, name, reason, ip) })
+}
+
+// reportReject is what the upload handlers call when they turn a transfer
+// away: it posts the existing size_rejected / policy_rejected webhook event
+// and fans the rejection out to registered hooks. No code has been issued at
+// that point, so OnReject sees an empty code.
+func reportReject(event, name, detail, ip string) {
+	notifyWebhook(webhookEvent{Event: event, IP: ip, Name: name, Detail: detail})
+	hookReject("", name, detail, ip)
+}
+
+// registerBuiltinHooks wires up the CLI dispatchers once per process; Serve
+// calls it so embedded servers that never set the vars pay nothing.
+var registerBuiltinHooks = sync.OnceFunc(func() {
+	if HookCommand != "" {
+		RegisterHooks(commandHooks{})
+	}
+	if WebhookURL != "" {
+		RegisterHooks(webhookHooks{})
+	}
+})
+
+// commandHooks runs HookCommand per event. Failures are logged and never
+// affect the transfer that triggered the event.
+type commandHooks struct{}
+
+func runHookCommand(event string, env ...string) {
+	cmd := exec.Command(HookCommand, event)
+	cmd.Env = append(os.Environ(), env...)
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "hook-cmd %s: %v\n", event, err)
+	}
+}
+
+func (commandHooks) OnUploadComplete(code, name string, size int64, ip string) {
+	runHookCommand("upload_complete", "TCPRAW_CODE="+code, "TCPRAW_NAME="+name,
+		"TCPRAW_SIZE="+strconv.FormatInt(size, 10), "TCPRAW_IP="+ip)
+}
+
+func (commandHooks) OnDownload(code, name, ip string) {
+	runHookCommand("download", "TCPRAW_CODE="+code, "TCPRAW_NAME="+name, "TCPRAW_IP="+ip)
+}
+
+func (commandHooks) OnExpire(code string) {
+	runHookCommand("expire", "TCPRAW_CODE="+code)
+}
+
+func (commandHooks) OnReject(code, name, reason, ip string) {
+	runHookCommand("reject", "TCPRAW_CODE="+code, "TCPRAW_NAME="+name,
+		"TCPRAW_REASON="+reason, "TCPRAW_IP="+ip)
+}
+
+// webhookHooks forwards the transfer events to the -webhook URL. Rejections
+// are skipped here because the handlers already post them with the richer
+// size_rejected / policy_rejected event names.
+type webhookHooks struct{}
+
+func (webhookHooks) OnUploadComplete(code, name string, size int64, ip string) {
+	notifyWebhook(webhookEvent{Event: "upload_complete", Code: code, Name: name, IP: ip,
+		Detail: strconv.FormatInt(size, 10) + " bytes"})
+}
+
+func (webhookHooks) OnDownload(code, name, ip string) {
+	notifyWebhook(webhookEvent{Event: "download", Code: code, Name: name, IP: ip})
+}
+
+func (webhookHooks) OnExpire(code string) {
+	notifyWebhook(webhookEvent{Event: "expire", Code: code})
+}
+
+func (webhookHooks) OnReject(code, name, reason, ip string) {}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Aggregate disk bandwidth throttle, set at server start from -iolimit. All
+// transfer reads and writes against the data directory draw from one shared
+// token bucket, so a burst of large uploads on a small VPS cannot starve
+// co-hosted services of disk time. The throttle sits between the handlers
+// and the blob files; the network side just sees a slower peer.
+
+// DiskIOLimit caps aggregate transfer disk bandwidth in bytes per second.
+// 0 (the default) leaves disk I/O unthrottled. Atomic because a config
+// reload can rewrite it while transfers are drawing from the bucket.
+var DiskIOLimit atomic.Int64
+
+// diskIOChunk bounds how many bytes one read or write draws from the bucket
+// at a time, so a single large chunk cannot monopolize a small budget while
+// other transfers wait.
+const diskIOChunk = 256 * 1024
+
+var diskIOBucket struct {
+	sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// diskIOWait blocks until n bytes of disk budget are available and spends
+// them. The bucket holds at most one second of budget, so an idle server
+// absorbs a short burst at full speed before the cap bites.
+func diskIOWait(n int) {
+	limit := float64(DiskIOLimit.Load())
+	if limit <= 0 || n <= 0 {
+		return
+	}
+	for {
+		diskIOBucket.Lock()
+		now := time.Now()
+		if !diskIOBucket.last.IsZero() {
+			diskIOBucket.tokens += now.Sub(diskIOBucket.last).Seconds() * limit
+		}
+		if diskIOBucket.tokens > limit {
+			diskIOBucket.tokens = limit
+		}
+		diskIOBucket.last = now
+		if diskIOBucket.tokens >= float64(n) {
+			diskIOBucket.tokens -= float64(n)
+			diskIOBucket.Unlock()
+			return
+		}
+		wait := time.Duration((float64(n) - diskIOBucket.tokens) / limit * float64(time.Second))
+		diskIOBucket.Unlock()
+		time.Sleep(wait)
+	}
+}
+
+// diskReader wraps a blob file reader under the throttle; it returns r
+// unchanged when the throttle is off, so the hot path stays allocation-free.
+func diskReader(r io.Reader) io.Reader {
+	if DiskIOLimit.Load() <= 0 {
+		return r
+	}
+	return &throttledReader{r: r}
+}
+
+// diskWriter is the write-side counterpart of diskReader.
+func diskWriter(w io.Writer) io.Writer {
+	if DiskIOLimit.Load() <= 0 {
+		return w
+	}
+	return &throttledWriter{w: w}
+}
+
+type throttledReader struct {
+	r io.Reader
+}
+
+// Read caps each underlying read at diskIOChunk and pays for what it got.
+// Short reads are fine: every caller loops via io.ReadFull or io.Copy.
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > diskIOChunk {
+		p = p[:diskIOChunk]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		diskIOWait(n)
+	}
+	return n, err
+}
+
+type throttledWriter struct {
+	w io.Writer
+}
+
+// Write pushes p through in diskIOChunk slices, paying for each before it
+// hits the disk.
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	var total int
+	for len(p) > 0 {
+		c := p
+		if len(c) > diskIOChunk {
+			c = c[:diskIOChunk]
+		}
+		diskIOWait(len(c))
+		n, err := t.w.Write(c)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
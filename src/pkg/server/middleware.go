@@ -0,0 +1,193 @@
+// Per-connection middleware chain. handleConn reads the message type, then
+// runs the connection through connPipeline — metrics, shared-secret auth,
+// client-certificate policy, rate limiting — before dispatching to the
+// per-message handler. Cross-cutting checks compose here once instead of
+// being re-implemented inside every handler.
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+
+	"tcpraw/pkg/protocol"
+	"tcpraw/pkg/store"
+)
+
+// connState carries a single accepted connection through the chain: the
+// connection and its buffered reader, the already-read message type, the
+// peer IP, and the collaborators the handlers need.
+type connState struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	msgType  byte
+	ip       string
+	st       *store.Store
+	rl       *rateLimiter
+	serverID int
+}
+
+// logf reports a per-connection condition to stderr, tagged with the peer IP.
+func (cs *connState) logf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+" (%s)\n", append(args, cs.ip)...)
+}
+
+// reject logs why the connection is being refused and answers status before
+// the chain unwinds.
+func (cs *connState) reject(status byte, format string, args ...any) {
+	cs.logf(format, args...)
+	protocol.SendStatus(cs.conn, status)
+}
+
+type connHandler func(*connState)
+
+// A middleware wraps a connHandler with one cross-cutting concern; it either
+// calls next or rejects the connection itself.
+type middleware func(next connHandler) connHandler
+
+// chain applies mws left to right, so the first middleware is the outermost.
+func chain(h connHandler, mws ...middleware) connHandler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// connPipeline is the assembled chain handleConn runs every connection
+// through. New cross-cutting features slot in here.
+var connPipeline = chain(dispatchMessage,
+	withConnMetrics,
+	withAuth,
+	withClientCertPolicy,
+	withRateLimit,
+	withBenchPolicy,
+)
+
+// withConnMetrics tracks the active-connection gauge around the rest of the
+// chain.
+func withConnMetrics(next connHandler) connHandler {
+	return func(cs *connState) {
+		srvStats.activeConns.Add(1)
+		defer srvStats.activeConns.Add(-1)
+		next(cs)
+	}
+}
+
+// withAuth enforces the timestamped HMAC auth frame when -secret is set.
+func withAuth(next connHandler) connHandler {
+	return func(cs *connState) {
+		if len(protocol.ProtocolSecret) > 0 {
+			if err := protocol.VerifyAuthFrame(cs.r, cs.msgType); err != nil {
+				cs.reject(protocol.StatusError, "auth: %v", err)
+				return
+			}
+		}
+		next(cs)
+	}
+}
+
+// withClientCertPolicy rejects messages that require a verified client
+// certificate (uploads, plus downloads under -mtls-downloads) when the peer
+// did not present one.
+func withClientCertPolicy(next connHandler) connHandler {
+	return func(cs *connState) {
+		needCert := cs.msgType == protocol.MsgUpload || cs.msgType == protocol.MsgUploadPw || cs.msgType == protocol.MsgUploadTimed || cs.msgType == protocol.MsgSecureUpload || cs.msgType == protocol.MsgDeltaUpload || cs.msgType == protocol.MsgAppend || cs.msgType == protocol.MsgMigrate ||
+			(protocol.ServerMTLSDownloads && (cs.msgType == protocol.MsgDownload || cs.msgType == protocol.MsgDownloadPw || cs.msgType == protocol.MsgDownloadRange || cs.msgType == protocol.MsgCheck))
+		if needCert && !protocol.RequireClientCert(cs.conn) {
+			cs.reject(protocol.StatusError, "rejected: client certificate required")
+			return
+		}
+		next(cs)
+	}
+}
+
+// withRateLimit gates the download messages through the per-IP limiter.
+// Uploads are not limited here; their cost is bounded by the size checks and
+// the disk reservation ledger instead.
+func withRateLimit(next connHandler) connHandler {
+	return func(cs *connState) {
+		switch cs.msgType {
+		// MsgDeltaUpload and MsgAppend count too: their replies would
+		// otherwise be a rate-limit-free way to probe the code space.
+		case protocol.MsgDownload, protocol.MsgDownloadPw, protocol.MsgDownloadPake, protocol.MsgDownloadRange, protocol.MsgDeltaUpload, protocol.MsgAppend, protocol.MsgCheck:
+			if !cs.rl.allow(string(cs.msgType), cs.ip) {
+				// Answer like an unknown code so a guesser cannot tell the
+				// limiter kicked in (a distinct status would confirm the
+				// code space is live).
+				cs.reject(protocol.StatusNotFound, "rate limit / ban")
+				return
+			}
+		}
+		next(cs)
+	}
+}
+
+// withBenchPolicy applies the bench abuse controls: -nobench refuses the
+// message outright and the bench limiter caps requests per IP. A refused
+// connection closes without a reply, which clients already report as
+// "server unreachable or older version without benchmark".
+func withBenchPolicy(next connHandler) connHandler {
+	return func(cs *connState) {
+		if cs.msgType == protocol.MsgBench {
+			if BenchDisabled {
+				cs.logf("bench refused: disabled")
+				return
+			}
+			if benchLimiter != nil && !benchLimiter.allow("bench", cs.ip) {
+				cs.logf("bench refused: rate limit / ban")
+				return
+			}
+		}
+		next(cs)
+	}
+}
+
+// dispatchMessage is the end of the chain: route to the per-message handler.
+func dispatchMessage(cs *connState) {
+	conn, r, st := cs.conn, cs.r, cs.st
+	switch cs.msgType {
+	case protocol.MsgUpload:
+		handleUpload(conn, r, st, "", 0)
+	case protocol.MsgUploadPw:
+		password, err := protocol.ReadPasswordFrame(r)
+		if err != nil || password == "" {
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		handleUpload(conn, r, st, password, 0)
+	case protocol.MsgUploadTimed:
+		var notBeforeSec uint32
+		if err := binary.Read(r, binary.BigEndian, &notBeforeSec); err != nil || notBeforeSec == 0 {
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		handleUpload(conn, r, st, "", notBeforeSec)
+	case protocol.MsgDownload:
+		handleDownload(conn, r, st, false)
+	case protocol.MsgDownloadPw:
+		handleDownload(conn, r, st, true)
+	case protocol.MsgDownloadPake:
+		handleDownloadPake(conn, r, st)
+	case protocol.MsgDownloadRange:
+		handleDownloadRange(conn, r, st)
+	case protocol.MsgSecureUpload:
+		handleSecureUpload(conn, r, st, cs.serverID)
+	case protocol.MsgDeltaUpload:
+		handleDeltaUpload(conn, r, st)
+	case protocol.MsgAppend:
+		handleAppend(conn, r, st)
+	case protocol.MsgCheck:
+		handleCheck(conn, r, st)
+	case protocol.MsgMigrate:
+		handleMigrate(conn, r, st, cs.serverID)
+	case protocol.MsgTest:
+		handleTest(conn, r, st)
+	case protocol.MsgBench:
+		handleBench(conn, r, st)
+	default:
+		cs.logf("unknown type: %c", cs.msgType)
+		protocol.SendStatus(conn, protocol.StatusError)
+	}
+}
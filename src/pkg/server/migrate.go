@@ -0,0 +1,261 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"tcpraw/pkg/protocol"
+	"tcpraw/pkg/store"
+)
+
+// Code migration (/admin/migrate + MsgMigrate): move a stored blob to
+// another server so a node can be drained before maintenance without
+// invalidating codes people have already shared. The operator asks the old
+// server to push a blob; the target stores the sealed payload verbatim under
+// a fresh code carrying its own first digit and answers that code back. The
+// old server then replaces its copy with a redirect stub, and downloads of
+// the old code answer StatusRedirect with the new code for the remainder of
+// the TTL. The sealed bytes never change, so receivers keep decrypting with
+// the code the sender shared — the new code is only a storage locator the
+// client follows.
+
+// maxMigrateMetaLen bounds the metadata frame of a migration push. Chunk
+// sums and an inlined small payload are the only variable parts, both far
+// below this for any blob a server accepts.
+const maxMigrateMetaLen = 64 * 1024 * 1024
+
+// handleMigrate is the receiving side of a migration push: metadata length,
+// gob-encoded StoredBlob, payload length, then the .dat payload verbatim
+// (zero length when the sealed bytes live inside the metadata). Answers
+// StatusOK and the code the blob is now stored under.
+func handleMigrate(conn net.Conn, r io.Reader, st *store.Store, serverID int) {
+	var metaLen uint32
+	if err := binary.Read(r, binary.BigEndian, &metaLen); err != nil {
+		fmt.Fprintf(os.Stderr, "read migrate metadata length: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	if metaLen == 0 || metaLen > maxMigrateMetaLen {
+		fmt.Fprintf(os.Stderr, "migrate rejected: metadata length %d\n", metaLen)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	metaBuf := make([]byte, metaLen)
+	if _, err := io.ReadFull(r, metaBuf); err != nil {
+		fmt.Fprintf(os.Stderr, "read migrate metadata: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	var blob store.StoredBlob
+	if err := gob.NewDecoder(bytes.NewReader(metaBuf)).Decode(&blob); err != nil {
+		fmt.Fprintf(os.Stderr, "decode migrate metadata: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	if blob.RedirectCode != "" || blob.Quarantined {
+		fmt.Fprintf(os.Stderr, "migrate rejected: redirect stub or quarantined blob\n")
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	// The metadata comes from the wire, and MsgMigrate is open unless the
+	// operator set -secret — so every field the server normally decides is
+	// overwritten here. Without this a crafted frame could arrive
+	// pre-pinned or with a far-future expiry and squat on disk forever.
+	now := time.Now()
+	blob.Pinned = false
+	blob.PinnedBy, blob.PinReason = "", ""
+	blob.PinnedAt = time.Time{}
+	blob.CreatedAt = now
+	if maxExpiry := now.Add(st.TTL()); blob.ExpiresAt.IsZero() || blob.ExpiresAt.After(maxExpiry) {
+		blob.ExpiresAt = maxExpiry
+	}
+	if maxSize := serverMaxBlobSize.Load(); maxSize > 0 && int64(blob.TotalPlainLen) > maxSize {
+		fmt.Fprintf(os.Stderr, "migrate rejected: blob exceeds max size %d MB\n", maxSize/(1024*1024))
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	var dataLen uint64
+	if err := binary.Read(r, binary.BigEndian, &dataLen); err != nil {
+		fmt.Fprintf(os.Stderr, "read migrate payload length: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	if dataLen > uint64(reservedUploadBytes(blob.TotalPlainLen, blob.NumChunks)) {
+		fmt.Fprintf(os.Stderr, "migrate rejected: payload length %d inconsistent with metadata\n", dataLen)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	release, err := uploadLedger.reserve(reservedUploadBytes(blob.TotalPlainLen, blob.NumChunks), st.DataDir())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate rejected: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	defer release()
+
+	code := protocol.GenerateCodeWithServerID(serverID)
+	if dataLen > 0 {
+		tmpPath := st.TempDataPath(code)
+		df, err := os.Create(tmpPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "create data file: %v\n", err)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		if _, err := io.CopyN(diskWriter(df), r, int64(dataLen)); err != nil {
+			df.Close()
+			os.Remove(tmpPath)
+			fmt.Fprintf(os.Stderr, "read migrate payload: %v\n", err)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		if err := df.Close(); err != nil {
+			os.Remove(tmpPath)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		if err := os.Rename(tmpPath, st.DataPath(code)); err != nil {
+			os.Remove(tmpPath)
+			fmt.Fprintf(os.Stderr, "store migrate payload: %v\n", err)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+	}
+	if err := st.Put(code, &blob); err != nil {
+		os.Remove(st.DataPath(code))
+		fmt.Fprintf(os.Stderr, "store migrated blob: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	fmt.Printf("info: imported migrated blob %q as code %s\n", blob.Name, code)
+	if err := protocol.SendStatus(conn, protocol.StatusOK); err != nil {
+		return
+	}
+	protocol.WriteDownloadRequest(conn, code)
+}
+
+// handleAdminMigrate pushes a stored code to another server and leaves a
+// redirect stub behind: /admin/migrate?code=...&target=host:port.
+func handleAdminMigrate(st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := strings.TrimSpace(r.FormValue("code"))
+		target := strings.TrimSpace(r.FormValue("target"))
+		if !protocol.ValidCode(code) {
+			http.Error(w, "code must be 6 digits", http.StatusBadRequest)
+			return
+		}
+		if target == "" {
+			http.Error(w, "target host:port required", http.StatusBadRequest)
+			return
+		}
+		blob, ok := st.Get(code)
+		if !ok {
+			http.Error(w, "code not found or expired", http.StatusNotFound)
+			return
+		}
+		if blob.RedirectCode != "" {
+			http.Error(w, "code already migrated to "+blob.RedirectCode, http.StatusConflict)
+			return
+		}
+		if blob.Quarantined || serverBlocklist.blocked(code, blob.PlaintextChecksum) {
+			http.Error(w, "refusing to migrate a quarantined or blocklisted code", http.StatusForbidden)
+			return
+		}
+		// Pin the absolute expiry so the remaining TTL carries over
+		// regardless of the target's default duration.
+		expiry := st.ExpiryOf(blob)
+		blob.ExpiresAt = expiry
+		newCode, err := pushBlob(st, code, blob, target)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("migrate %s: %v", code, err), http.StatusBadGateway)
+			return
+		}
+		stub := &store.StoredBlob{
+			Name:         blob.Name,
+			RedirectCode: newCode,
+			CreatedAt:    blob.CreatedAt,
+			ExpiresAt:    expiry,
+			Pinned:       blob.Pinned,
+			PinnedBy:     blob.PinnedBy,
+			PinReason:    blob.PinReason,
+			PinnedAt:     blob.PinnedAt,
+		}
+		st.Remove(code)
+		if err := st.Put(code, stub); err != nil {
+			http.Error(w, fmt.Sprintf("store redirect stub: %v", err), http.StatusInternalServerError)
+			return
+		}
+		fmt.Printf("info: migrated code %s to %s (now %s)\n", code, target, newCode)
+		adminDone(w, r, "migrated %s to %s as %s; redirect answered until %s", code, target, newCode, expiry.Format(time.RFC3339))
+	}
+}
+
+// pushBlob streams a blob's metadata and sealed payload to the target server
+// and returns the code the target stored it under.
+func pushBlob(st *store.Store, code string, blob *store.StoredBlob, target string) (string, error) {
+	var meta bytes.Buffer
+	if err := gob.NewEncoder(&meta).Encode(blob); err != nil {
+		return "", err
+	}
+	var df *os.File
+	var dataLen uint64
+	if blob.Chunked || blob.SealedInFile {
+		f, err := os.Open(st.DataPath(code))
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			return "", err
+		}
+		df, dataLen = f, uint64(fi.Size())
+	}
+	conn, err := protocol.DialServer(target, protocol.DialTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	bw := bufio.NewWriterSize(conn, protocol.BufSize)
+	if err := protocol.WriteMessageTypeAuth(bw, protocol.MsgMigrate); err != nil {
+		return "", err
+	}
+	if err := binary.Write(bw, binary.BigEndian, uint32(meta.Len())); err != nil {
+		return "", err
+	}
+	if _, err := bw.Write(meta.Bytes()); err != nil {
+		return "", err
+	}
+	if err := binary.Write(bw, binary.BigEndian, dataLen); err != nil {
+		return "", err
+	}
+	if df != nil {
+		if _, err := io.Copy(bw, diskReader(df)); err != nil {
+			return "", err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return "", err
+	}
+	status, err := protocol.ReadStatus(conn)
+	if err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+	if status != protocol.StatusOK {
+		return "", fmt.Errorf("target refused the blob (status %d)", status)
+	}
+	newCode, err := protocol.ReadDownloadRequest(conn)
+	if err != nil {
+		return "", fmt.Errorf("read new code: %w", err)
+	}
+	return newCode, nil
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// v3 onion service publication (-onion). The server asks an already-running
+// Tor daemon over its control port to expose the listener as a hidden
+// service, so a node behind NAT with no public address is still reachable —
+// clients dial the .onion through their own Tor proxy (-tor) and neither
+// side learns the other's IP. Only the slice of the control protocol this
+// needs (PROTOCOLINFO, AUTHENTICATE, ADD_ONION) is spoken directly. The
+// returned private key is kept in <dataDir>/onion.key so the address stays
+// stable across restarts, and the control connection is held open for the
+// life of the process: Tor tears the service down when it closes.
+
+const onionKeyFilename = "onion.key"
+
+// TorControlAddr is the Tor control port (e.g. 127.0.0.1:9051) or control
+// socket path, set from -onion; empty = no onion service.
+var TorControlAddr string
+
+// torControl pins the control connection open; the onion service lives
+// exactly as long as it does.
+var torControl *textproto.Conn
+
+// publishOnionService registers the onion service forwarding the service
+// port to the local listener and returns the .onion hostname.
+func publishOnionService(controlAddr, port, dataDir string) (string, error) {
+	network := "tcp"
+	if strings.ContainsRune(controlAddr, '/') {
+		network = "unix"
+	}
+	nc, err := net.Dial(network, controlAddr)
+	if err != nil {
+		return "", fmt.Errorf("tor control port %s: %w", controlAddr, err)
+	}
+	tp := textproto.NewConn(nc)
+	if err := authenticateTorControl(tp); err != nil {
+		tp.Close()
+		return "", err
+	}
+
+	keyPath := filepath.Join(dataDir, onionKeyFilename)
+	keySpec := "NEW:ED25519-V3"
+	if key, err := os.ReadFile(keyPath); err == nil {
+		keySpec = strings.TrimSpace(string(key))
+	}
+	if err := tp.PrintfLine("ADD_ONION %s Port=%s,127.0.0.1:%s", keySpec, port, port); err != nil {
+		tp.Close()
+		return "", err
+	}
+	_, msg, err := tp.ReadResponse(250)
+	if err != nil {
+		tp.Close()
+		return "", fmt.Errorf("ADD_ONION: %w", err)
+	}
+	var serviceID string
+	for _, line := range strings.Split(msg, "\n") {
+		if v, ok := strings.CutPrefix(line, "ServiceID="); ok {
+			serviceID = v
+		}
+		if v, ok := strings.CutPrefix(line, "PrivateKey="); ok {
+			if err := os.WriteFile(keyPath, []byte(v+"\n"), 0600); err != nil {
+				fmt.Fprintf(os.Stderr, "save onion key: %v (address will change on restart)\n", err)
+			}
+		}
+	}
+	if serviceID == "" {
+		tp.Close()
+		return "", fmt.Errorf("ADD_ONION: no ServiceID in reply")
+	}
+	torControl = tp
+	return serviceID + ".onion", nil
+}
+
+// authenticateTorControl runs PROTOCOLINFO to learn the accepted auth
+// methods and authenticates with the null method or the control cookie.
+// Password auth is not supported: cookie auth needs no secret in flags.
+func authenticateTorControl(tp *textproto.Conn) error {
+	if err := tp.PrintfLine("PROTOCOLINFO 1"); err != nil {
+		return err
+	}
+	_, msg, err := tp.ReadResponse(250)
+	if err != nil {
+		return fmt.Errorf("PROTOCOLINFO: %w", err)
+	}
+	var methods, cookieFile string
+	for _, line := range strings.Split(msg, "\n") {
+		if !strings.HasPrefix(line, "AUTH ") {
+			continue
+		}
+		for _, field := range strings.Fields(line[len("AUTH "):]) {
+			if v, ok := strings.CutPrefix(field, "METHODS="); ok {
+				methods = v
+			}
+			if v, ok := strings.CutPrefix(field, "COOKIEFILE="); ok {
+				cookieFile = strings.Trim(v, `"`)
+			}
+		}
+	}
+	auth := ""
+	switch {
+	case strings.Contains(methods, "NULL"):
+		// AUTHENTICATE with no argument.
+	case strings.Contains(methods, "COOKIE") && cookieFile != "":
+		cookie, err := os.ReadFile(cookieFile)
+		if err != nil {
+			return fmt.Errorf("read control cookie: %w", err)
+		}
+		auth = " " + hex.EncodeToString(cookie)
+	default:
+		return fmt.Errorf("control port offers auth methods %q; enable cookie auth (CookieAuthentication 1)", methods)
+	}
+	if err := tp.PrintfLine("AUTHENTICATE%s", auth); err != nil {
+		return err
+	}
+	if _, _, err := tp.ReadResponse(250); err != nil {
+		return fmt.Errorf("AUTHENTICATE: %w", err)
+	}
+	return nil
+}
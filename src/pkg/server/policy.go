@@ -0,0 +1,91 @@
+package server
+
+import (
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// Upload policy filters, set at server start from -deny-ext, -deny-mime and
+// -maxname. The three knobs live behind one atomically swapped pointer so a
+// config reload replaces them as a unit while upload handlers check the
+// policy concurrently. Empty lists = everything allowed (the default, as
+// before).
+type uploadPolicy struct {
+	denyExt    []string // lowercase extensions without dot, e.g. "exe"
+	denyMIME   []string // MIME patterns, e.g. "application/x-dosexec" or "video/*"
+	maxNameLen int      // 0 = no limit
+}
+
+var serverPolicy atomic.Pointer[uploadPolicy]
+
+// SetUploadPolicy installs the upload deny lists and filename length limit.
+func SetUploadPolicy(denyExt, denyMIME []string, maxNameLen int) {
+	serverPolicy.Store(&uploadPolicy{denyExt: denyExt, denyMIME: denyMIME, maxNameLen: maxNameLen})
+}
+
+// currentPolicy never returns nil, so callers need no special case before
+// the first SetUploadPolicy.
+func currentPolicy() *uploadPolicy {
+	if p := serverPolicy.Load(); p != nil {
+		return p
+	}
+	return &uploadPolicy{}
+}
+
+// ParsePolicyList splits a comma-separated flag value into trimmed lowercase entries.
+func ParsePolicyList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part != "" {
+			out = append(out, strings.TrimPrefix(part, "."))
+		}
+	}
+	return out
+}
+
+// checkUploadPolicy returns an error when the (already base-named) upload
+// filename violates the configured deny lists or length limit. The content
+// itself is encrypted at this point, so MIME matching goes by extension.
+func checkUploadPolicy(name string) error {
+	p := currentPolicy()
+	if p.maxNameLen > 0 && len(name) > p.maxNameLen {
+		return fmt.Errorf("filename longer than %d bytes", p.maxNameLen)
+	}
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	if ext != "" {
+		for _, deny := range p.denyExt {
+			if ext == deny {
+				return fmt.Errorf("extension .%s not allowed on this server", ext)
+			}
+		}
+		if len(p.denyMIME) > 0 {
+			mimeType := mime.TypeByExtension("." + ext)
+			if i := strings.IndexByte(mimeType, ';'); i >= 0 {
+				mimeType = mimeType[:i]
+			}
+			mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+			for _, pattern := range p.denyMIME {
+				if mimeMatches(mimeType, pattern) {
+					return fmt.Errorf("content type %s not allowed on this server", mimeType)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// mimeMatches matches a concrete MIME type against a pattern that may use a
+// "type/*" wildcard.
+func mimeMatches(mimeType, pattern string) bool {
+	if mimeType == "" {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mimeType, prefix+"/")
+	}
+	return mimeType == pattern
+}
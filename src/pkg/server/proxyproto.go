@@ -0,0 +1,160 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProxyProtocol makes the TCP listener require a HAProxy PROXY protocol
+// v1 or v2 header (-proxyproto) on every connection, so a server behind a
+// load balancer or port forwarder still sees real client IPs for rate
+// limiting, quotas and audit logs. Opt-in: with the flag set, connections
+// without a valid header are refused, exactly like HAProxy's own
+// accept-proxy mode, so never enable it on a directly reachable port.
+var ProxyProtocol = false
+
+// proxyHeaderTimeout bounds how long a connection may dawdle before
+// completing the header; proxies send it immediately, so a slow one is a
+// direct client or a scanner holding an FD.
+const proxyHeaderTimeout = 5 * time.Second
+
+// proxyV2Sig is the fixed 12-byte signature opening a v2 header.
+var proxyV2Sig = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// proxyListener wraps Accept so every connection parses its PROXY header
+// lazily on first read. TLS layers above it (the header travels in the
+// clear, before the handshake), so the wrap goes on the raw TCP listener.
+type proxyListener struct {
+	net.Listener
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: conn, br: bufio.NewReaderSize(conn, 256)}, nil
+}
+
+// proxyConn defers header parsing to the first Read so the accept loop
+// never blocks on a slow proxy. RemoteAddr reports the header's source
+// address once parsed; before that (the handler only asks after reading
+// the request) it falls back to the proxy's own address.
+type proxyConn struct {
+	net.Conn
+	br       *bufio.Reader
+	parseOne sync.Once
+	parseErr error
+	remote   net.Addr
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) {
+	c.parseOne.Do(c.parseHeader)
+	if c.parseErr != nil {
+		return 0, c.parseErr
+	}
+	return c.br.Read(p)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) parseHeader() {
+	c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+	sig, err := c.br.Peek(len(proxyV2Sig))
+	if err == nil && string(sig) == string(proxyV2Sig) {
+		c.parseErr = c.parseV2()
+		return
+	}
+	head, err := c.br.Peek(6)
+	if err == nil && string(head) == "PROXY " {
+		c.parseErr = c.parseV1()
+		return
+	}
+	c.parseErr = fmt.Errorf("proxy protocol: header missing (direct connection to a -proxyproto listener?)")
+}
+
+// parseV1 consumes the text form, e.g.
+//
+//	PROXY TCP4 192.0.2.1 198.51.100.7 56324 443\r\n
+//
+// "PROXY UNKNOWN" is legal and leaves the proxy's address in place.
+func (c *proxyConn) parseV1() error {
+	// Longest legal v1 line is 107 bytes; refuse to scan further.
+	line := make([]byte, 0, 107)
+	for {
+		b, err := c.br.ReadByte()
+		if err != nil {
+			return fmt.Errorf("proxy protocol: read v1 header: %w", err)
+		}
+		if b == '\n' {
+			break
+		}
+		if len(line) == cap(line) {
+			return fmt.Errorf("proxy protocol: v1 header too long")
+		}
+		line = append(line, b)
+	}
+	if len(line) == 0 || line[len(line)-1] != '\r' {
+		return fmt.Errorf("proxy protocol: v1 header not CRLF-terminated")
+	}
+	fields := strings.Split(string(line[:len(line)-1]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return fmt.Errorf("proxy protocol: malformed v1 header")
+	}
+	ip := net.ParseIP(fields[2])
+	var port int
+	if _, err := fmt.Sscanf(fields[4], "%d", &port); err != nil || ip == nil || port < 0 || port > 65535 {
+		return fmt.Errorf("proxy protocol: bad v1 source address")
+	}
+	c.remote = &net.TCPAddr{IP: ip, Port: port}
+	return nil
+}
+
+// parseV2 consumes the binary form: signature, version/command, family,
+// payload length, then the address block. LOCAL commands (health checks)
+// and non-TCP families keep the proxy's own address.
+func (c *proxyConn) parseV2() error {
+	var hdr [16]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return fmt.Errorf("proxy protocol: read v2 header: %w", err)
+	}
+	verCmd, fam := hdr[12], hdr[13]
+	if verCmd>>4 != 0x2 {
+		return fmt.Errorf("proxy protocol: unsupported v2 version %#x", verCmd>>4)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return fmt.Errorf("proxy protocol: read v2 addresses: %w", err)
+	}
+	if verCmd&0xf != 0x1 { // LOCAL: proxy's own traffic, no address to carry
+		return nil
+	}
+	switch fam {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return fmt.Errorf("proxy protocol: short v2 IPv4 block")
+		}
+		c.remote = &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return fmt.Errorf("proxy protocol: short v2 IPv6 block")
+		}
+		c.remote = &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}
+	}
+	return nil
+}
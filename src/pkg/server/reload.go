@@ -0,0 +1,181 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"tcpraw/pkg/protocol"
+	"tcpraw/pkg/store"
+)
+
+// Hot configuration reload. SIGHUP (or POST /admin/reload on the web port)
+// re-reads the file-backed policy state without touching the listener or any
+// in-flight transfer: the blocklist, the cached public address list, and the
+// optional <dataDir>/server.conf overrides. The overrides file uses the same
+// keys as the server flags, one "key value" per line, # comments:
+//
+//	ttl 1h
+//	maxsize 200
+//	iolimit 50
+//	maxname 120
+//	rl-attempts 10
+//	rl-window 1m
+//	ban 10m
+//	deny-ext exe,scr
+//	deny-mime application/x-dosexec,video/*
+//
+// Keys absent from the file keep their current (flag or previous reload)
+// value, so the file only needs the knobs an operator actually tweaks.
+
+const configOverridesFilename = "server.conf"
+
+// watchReloadSignal applies a config reload on every SIGHUP until done
+// closes.
+func watchReloadSignal(st *store.Store, done chan struct{}) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-hup:
+				reloadServerConfig(st)
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// reloadMu serializes reloads: SIGHUP and /admin/reload run on different
+// goroutines, and the per-key policy updates below are read-modify-write.
+var reloadMu sync.Mutex
+
+// reloadServerConfig is the shared implementation behind SIGHUP and
+// /admin/reload.
+func reloadServerConfig(st *store.Store) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if serverBlocklist != nil {
+		if err := serverBlocklist.reload(); err != nil {
+			fmt.Fprintf(os.Stderr, "reload blocklist: %v\n", err)
+		}
+	}
+	protocol.DropServerListCache()
+	applyConfigOverrides(st)
+	if serverRateLimiter != nil {
+		serverRateLimiter.setLimits(RateLimitAttempts, RateLimitWindow, BanDuration)
+	}
+	if benchLimiter != nil {
+		benchLimiter.setLimits(BenchPerIPLimit, RateLimitWindow, BanDuration)
+	}
+	fmt.Println("tcpraw server: configuration reloaded")
+}
+
+// applyConfigOverrides reads <dataDir>/server.conf, if present, and applies
+// each recognized key. A bad value skips that line with a warning; the rest
+// of the file still applies.
+func applyConfigOverrides(st *store.Store) {
+	path := filepath.Join(st.DataDir(), configOverridesFilename)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "read %s: %v\n", path, err)
+		}
+		return
+	}
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, " ")
+		value = strings.TrimSpace(value)
+		if !found || value == "" {
+			fmt.Fprintf(os.Stderr, "%s:%d: missing value for %q\n", path, n+1, key)
+			continue
+		}
+		if err := applyConfigKey(st, key, value); err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%d: %v\n", path, n+1, err)
+		}
+	}
+}
+
+func applyConfigKey(st *store.Store, key, value string) error {
+	switch key {
+	case "ttl":
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("ttl: bad duration %q", value)
+		}
+		// Only the store's own (locked) TTL matters once the server is up;
+		// the package default stays as started.
+		st.SetTTL(d)
+	case "maxsize":
+		mb, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || mb <= 0 {
+			return fmt.Errorf("maxsize: bad MB value %q", value)
+		}
+		serverMaxBlobSize.Store(mb * 1024 * 1024)
+	case "iolimit":
+		mb, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || mb < 0 {
+			return fmt.Errorf("iolimit: bad MB/s value %q", value)
+		}
+		DiskIOLimit.Store(mb * 1024 * 1024)
+	case "maxname":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("maxname: bad length %q", value)
+		}
+		p := *currentPolicy()
+		p.maxNameLen = n
+		serverPolicy.Store(&p)
+	case "rl-attempts":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("rl-attempts: bad count %q", value)
+		}
+		RateLimitAttempts = n
+	case "rl-window":
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("rl-window: bad duration %q", value)
+		}
+		RateLimitWindow = d
+	case "ban":
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("ban: bad duration %q", value)
+		}
+		BanDuration = d
+	case "deny-ext":
+		p := *currentPolicy()
+		p.denyExt = ParsePolicyList(value)
+		serverPolicy.Store(&p)
+	case "deny-mime":
+		p := *currentPolicy()
+		p.denyMIME = ParsePolicyList(value)
+		serverPolicy.Store(&p)
+	default:
+		return fmt.Errorf("unknown key %q", key)
+	}
+	return nil
+}
+
+// handleAdminReload triggers the same reload as SIGHUP, for operators
+// without shell access to the server process.
+func handleAdminReload(st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reloadServerConfig(st)
+		fmt.Fprintln(w, "reloaded")
+	}
+}
@@ -0,0 +1,442 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tcpraw/pkg/protocol"
+	"tcpraw/pkg/store"
+)
+
+// Resumable browser uploads (/upload/resumable): a tus-style protocol for
+// the web upload page, so a multi-GB upload over a flaky connection picks
+// up where it left off instead of starting over.
+//
+//	POST   /upload/resumable          Upload-Length: <bytes>  (?name=...)
+//	  -> 201, Location: /upload/resumable/<token>
+//	HEAD   /upload/resumable/<token>  -> Upload-Offset, Upload-Length
+//	PATCH  /upload/resumable/<token>  Upload-Offset: <offset>, body = bytes
+//	  -> 204 + Upload-Offset, or 200 + JSON {code,...} on the final PATCH
+//	DELETE /upload/resumable/<token>  abandon the upload
+//
+// Bytes are encrypted into the same chunked format as handleWebUpload as
+// they arrive, so a finished upload downloads like any other code. One
+// deliberate deviation from strict tus: the completing PATCH answers 200
+// with the download code as JSON, because the code is the whole point.
+// Sessions are held in memory and do not survive a server restart; idle
+// ones are pruned after resumableIdleLimit.
+//
+// Creation is the cheap step for the client and the expensive one for the
+// server — one unauthenticated POST parks an Upload-Length disk reservation
+// — so it is rate limited per IP, open sessions per IP are capped, and a
+// session that never delivers a byte loses its reservation on a much
+// shorter clock than one mid-transfer.
+
+const (
+	tusVersion         = "1.0.0"
+	resumableIdleLimit = 6 * time.Hour
+	// resumableStartLimit applies instead while a session's offset is still
+	// zero: its full reservation is held against zero demonstrated intent.
+	resumableStartLimit = 10 * time.Minute
+	// resumableMaxPerIP caps open sessions per client address, so one source
+	// cannot park the whole disk in reservations across many sessions.
+	resumableMaxPerIP = 8
+	// resumablePruneInterval drives the background sweep; without it an
+	// abandoned reservation would only be released by the next create.
+	resumablePruneInterval = time.Minute
+)
+
+type resumableUpload struct {
+	mu         sync.Mutex
+	name       string
+	ip         string
+	code       string
+	keyVersion byte
+	salt       []byte
+	key        []byte
+	total      int64
+	offset     int64
+	numChunks  uint32
+	hasher     hash.Hash
+	chunkSums  []byte
+	partial    []byte // plaintext tail shorter than one chunk
+	df         *os.File
+	tmpPath    string
+	lastSeen   time.Time
+	release    func()
+}
+
+var (
+	resumableMu       sync.Mutex
+	resumableSessions = map[string]*resumableUpload{}
+)
+
+// pruneResumable drops sessions idle past their limit, deleting their
+// partial files and returning their reserved disk space. Sessions that have
+// not delivered a byte yet run on the short clock.
+func pruneResumable() {
+	resumableMu.Lock()
+	defer resumableMu.Unlock()
+	for token, up := range resumableSessions {
+		up.mu.Lock()
+		limit := time.Duration(resumableIdleLimit)
+		if up.offset == 0 {
+			limit = resumableStartLimit
+		}
+		idle := time.Since(up.lastSeen) > limit
+		if idle {
+			up.discardLocked()
+		}
+		up.mu.Unlock()
+		if idle {
+			delete(resumableSessions, token)
+		}
+	}
+}
+
+// watchResumableSessions sweeps abandoned sessions on a timer for the life
+// of the web server.
+func watchResumableSessions() {
+	for range time.Tick(resumablePruneInterval) {
+		pruneResumable()
+	}
+}
+
+// resumableSessionsForIP counts the open sessions created from ip; the ip
+// field is immutable after creation.
+func resumableSessionsForIP(ip string) int {
+	resumableMu.Lock()
+	defer resumableMu.Unlock()
+	n := 0
+	for _, up := range resumableSessions {
+		if up.ip == ip {
+			n++
+		}
+	}
+	return n
+}
+
+// discardLocked releases a session's file and disk reservation; the caller
+// holds up.mu.
+func (up *resumableUpload) discardLocked() {
+	if up.df != nil {
+		up.df.Close()
+		os.Remove(up.tmpPath)
+		up.df = nil
+	}
+	if up.release != nil {
+		up.release()
+		up.release = nil
+	}
+}
+
+// handleResumableCreate starts a session: POST with Upload-Length (and the
+// file name as ?name=), answered with the session's Location. OPTIONS
+// advertises the supported tus subset.
+func handleResumableCreate(st *store.Store, rl *rateLimiter, serverID int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Tus-Version", tusVersion)
+			w.Header().Set("Tus-Extension", "creation,termination")
+			if maxSize := serverMaxBlobSize.Load(); maxSize > 0 {
+				w.Header().Set("Tus-Max-Size", strconv.FormatInt(maxSize, 10))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST with Upload-Length starts a resumable upload", http.StatusMethodNotAllowed)
+			return
+		}
+		pruneResumable()
+		ip := extractIP(r.RemoteAddr)
+		if !rl.allow("resumable", ip) {
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		if resumableSessionsForIP(ip) >= resumableMaxPerIP {
+			http.Error(w, "too many open uploads from this address", http.StatusTooManyRequests)
+			return
+		}
+		total, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+		if err != nil || total < 0 {
+			http.Error(w, "missing or invalid Upload-Length header", http.StatusBadRequest)
+			return
+		}
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			name = "upload.bin"
+		}
+		baseName := protocol.SanitizeFilename(name)
+		if err := checkUploadPolicy(baseName); err != nil {
+			reportReject("policy_rejected", baseName, err.Error(), ip)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if maxSize := serverMaxBlobSize.Load(); maxSize > 0 && total > maxSize {
+			reportReject("size_rejected", baseName, "exceeds max blob size", ip)
+			http.Error(w, "file exceeds the server's max upload size", http.StatusRequestEntityTooLarge)
+			return
+		}
+		release, err := uploadLedger.reserve(reservedUploadBytes(uint64(total), 0), st.DataDir())
+		if err != nil {
+			reportReject("size_rejected", baseName, "insufficient disk space", ip)
+			http.Error(w, "insufficient disk space", http.StatusInsufficientStorage)
+			return
+		}
+
+		code := protocol.GenerateCodeWithServerID(serverID)
+		keyVersion := protocol.CurrentKeyVersion
+		salt := make([]byte, protocol.HeaderSaltSize(keyVersion))
+		if _, err := rand.Read(salt); err != nil {
+			release()
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		key, err := protocol.DeriveTransferKey(code, keyVersion, salt)
+		if err != nil {
+			release()
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		tmpPath := st.TempDataPath(code)
+		df, err := os.Create(tmpPath)
+		if err != nil {
+			release()
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		tokenBytes := make([]byte, 16)
+		if _, err := rand.Read(tokenBytes); err != nil {
+			df.Close()
+			os.Remove(tmpPath)
+			release()
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		token := hex.EncodeToString(tokenBytes)
+
+		up := &resumableUpload{
+			name:       baseName,
+			ip:         ip,
+			code:       code,
+			keyVersion: keyVersion,
+			salt:       salt,
+			key:        key,
+			total:      total,
+			hasher:     protocol.NewIntegrityHasher(key, keyVersion),
+			df:         df,
+			tmpPath:    tmpPath,
+			lastSeen:   time.Now(),
+			release:    release,
+		}
+		resumableMu.Lock()
+		resumableSessions[token] = up
+		resumableMu.Unlock()
+
+		w.Header().Set("Location", "/upload/resumable/"+token)
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// handleResumableSession serves HEAD/PATCH/DELETE on one session.
+func handleResumableSession(st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		token := strings.TrimPrefix(r.URL.Path, "/upload/resumable/")
+		resumableMu.Lock()
+		up := resumableSessions[token]
+		resumableMu.Unlock()
+		if up == nil {
+			http.Error(w, "unknown or expired upload", http.StatusNotFound)
+			return
+		}
+		up.mu.Lock()
+		defer up.mu.Unlock()
+		if up.df == nil {
+			http.Error(w, "unknown or expired upload", http.StatusNotFound)
+			return
+		}
+		up.lastSeen = time.Now()
+
+		switch r.Method {
+		case http.MethodHead:
+			w.Header().Set("Upload-Offset", strconv.FormatInt(up.offset, 10))
+			w.Header().Set("Upload-Length", strconv.FormatInt(up.total, 10))
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(http.StatusOK)
+		case http.MethodPatch:
+			resumablePatch(w, r, st, token, up)
+		case http.MethodDelete:
+			up.discardLocked()
+			resumableMu.Lock()
+			delete(resumableSessions, token)
+			resumableMu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "HEAD, PATCH or DELETE", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// resumablePatch appends a body at the declared offset, encrypting every
+// completed chunk; the chunk holding the final byte carries the
+// final-chunk AAD, which is why a full chunk is only sealed once it
+// provably isn't last or it ends exactly at Upload-Length. The caller
+// holds up.mu.
+func resumablePatch(w http.ResponseWriter, r *http.Request, st *store.Store, token string, up *resumableUpload) {
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset != up.offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(up.offset, 10))
+		http.Error(w, "offset mismatch", http.StatusConflict)
+		return
+	}
+	abort := func(status int, msg string) {
+		up.discardLocked()
+		resumableMu.Lock()
+		delete(resumableSessions, token)
+		resumableMu.Unlock()
+		http.Error(w, msg, status)
+	}
+	dw := diskWriter(up.df)
+	sealChunk := func(plain []byte, final bool) error {
+		up.hasher.Write(plain)
+		if protocol.HeaderHasChunkSums(up.keyVersion) {
+			up.chunkSums = append(up.chunkSums, protocol.ChunkSum(up.key, uint64(up.numChunks), plain)...)
+		}
+		nonce, sealed, err := protocol.EncryptChunkStream(up.key, uint64(up.numChunks), final, plain)
+		if err != nil {
+			return err
+		}
+		var header [16]byte
+		copy(header[:12], nonce)
+		binary.BigEndian.PutUint32(header[12:16], uint32(len(sealed)))
+		if _, err := dw.Write(header[:]); err != nil {
+			return err
+		}
+		if _, err := dw.Write(sealed); err != nil {
+			return err
+		}
+		up.numChunks++
+		return nil
+	}
+
+	buf := make([]byte, protocol.FileChunkSize)
+	for {
+		n, readErr := r.Body.Read(buf)
+		if n > 0 {
+			if up.offset+int64(n) > up.total {
+				abort(http.StatusRequestEntityTooLarge, "body exceeds Upload-Length")
+				return
+			}
+			up.offset += int64(n)
+			up.partial = append(up.partial, buf[:n]...)
+			for len(up.partial) >= protocol.FileChunkSize {
+				chunk := up.partial[:protocol.FileChunkSize]
+				final := up.offset == up.total && len(up.partial) == protocol.FileChunkSize
+				if err := sealChunk(chunk, final); err != nil {
+					abort(http.StatusInternalServerError, "server error")
+					return
+				}
+				up.partial = up.partial[:copy(up.partial, up.partial[protocol.FileChunkSize:])]
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			// The connection dropped mid-PATCH: keep the session so the
+			// client can HEAD for the offset and resume.
+			return
+		}
+	}
+
+	if up.offset < up.total {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(up.offset, 10))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Complete: seal the plaintext tail (or the single empty chunk of an
+	// empty file) and move the session into the store.
+	if len(up.partial) > 0 || up.numChunks == 0 {
+		if err := sealChunk(up.partial, true); err != nil {
+			abort(http.StatusInternalServerError, "server error")
+			return
+		}
+		up.partial = nil
+	}
+	if store.DurableUploads {
+		if err := up.df.Sync(); err != nil {
+			abort(http.StatusInternalServerError, "server error")
+			return
+		}
+	}
+	if err := up.df.Close(); err != nil {
+		up.df = nil
+		abort(http.StatusInternalServerError, "server error")
+		return
+	}
+	up.df = nil
+	if err := os.Rename(up.tmpPath, st.DataPath(up.code)); err != nil {
+		os.Remove(up.tmpPath)
+		abort(http.StatusInternalServerError, "server error")
+		return
+	}
+	if store.DurableUploads {
+		store.SyncDir(st.DataDir())
+	}
+	createdAt := time.Now()
+	duration := st.TTL()
+	blob := &store.StoredBlob{
+		Name:              up.name,
+		PlaintextChecksum: up.hasher.Sum(nil),
+		TotalPlainLen:     uint64(up.total),
+		NumChunks:         up.numChunks,
+		ChunkSums:         up.chunkSums,
+		Chunked:           true,
+		KeyVersion:        up.keyVersion,
+		KeySalt:           up.salt,
+		CreatedAt:         createdAt,
+		ExpiresAt:         createdAt.Add(duration),
+	}
+	if err := st.Put(up.code, blob); err != nil {
+		os.Remove(st.DataPath(up.code))
+		abort(http.StatusInternalServerError, "server error")
+		return
+	}
+	if up.release != nil {
+		up.release()
+		up.release = nil
+	}
+	resumableMu.Lock()
+	delete(resumableSessions, token)
+	resumableMu.Unlock()
+	srvStats.uploads.Add(1)
+	srvStats.bytesIn.Add(up.total)
+	hookUploadComplete(up.code, up.name, up.total, up.ip)
+	fmt.Printf("Received via resumable web upload: %s (code %s), stored encrypted to disk\n", up.name, up.code)
+	if scanEnabled() {
+		go scanStoredUpload(st, up.code)
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(up.offset, 10))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Code      string `json:"code"`
+		Name      string `json:"name"`
+		Bytes     uint64 `json:"bytes"`
+		ExpiresIn int64  `json:"expires_in_sec"`
+	}{up.code, up.name, uint64(up.total), int64(duration.Seconds())})
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package server
+
+import (
+	"errors"
+	"syscall"
+)
+
+// reusePortControl is unavailable on this platform; shared-mode processes
+// must listen on distinct ports behind an external balancer.
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT not supported on this platform")
+}
@@ -0,0 +1,22 @@
+//go:build linux
+// +build linux
+
+package server
+
+import "syscall"
+
+// soReusePortOpt is SO_REUSEPORT, missing from the syscall package.
+const soReusePortOpt = 0xf
+
+// reusePortControl sets SO_REUSEPORT on the listening socket so several
+// server processes can accept on the same port, with the kernel spreading
+// connections across them.
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	if err := c.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePortOpt, 1)
+	}); err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"tcpraw/pkg/protocol"
+	"tcpraw/pkg/store"
+)
+
+// Optional antivirus hook for code-encrypted uploads. The server can decrypt
+// these itself (the key derives from the code), so after an upload completes
+// the plaintext is scanned with clamd (-scan-clamd) or an external command
+// (-scan-cmd). Flagged codes are quarantined: kept on disk but never served.
+// Secure uploads are skipped – the server cannot decrypt them.
+var (
+	ScanClamdAddr string // clamd socket: "host:port" or unix socket path
+	ScanCommand   string // external scanner; gets the plaintext file as last arg, exit 1 = infected
+)
+
+func scanEnabled() bool {
+	return ScanClamdAddr != "" || ScanCommand != ""
+}
+
+// scanStoredUpload decrypts the stored blob for code to a temp file, runs the
+// configured scanner and quarantines the code if flagged. Runs in its own
+// goroutine after upload; errors only log so uploads never fail on scanner
+// trouble.
+func scanStoredUpload(st *store.Store, code string) {
+	blob, ok := st.Get(code)
+	if !ok || blob.Secure || blob.KeyVersion == protocol.KeyVersionX25519 {
+		return
+	}
+	tmp, err := os.CreateTemp("", "tcpraw-scan-*")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "scan %s: create temp: %v\n", code, err)
+		return
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	if err := decryptBlobToWriter(st, code, blob, tmp); err != nil {
+		tmp.Close()
+		fmt.Fprintf(os.Stderr, "scan %s: decrypt: %v\n", code, err)
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "scan %s: close temp: %v\n", code, err)
+		return
+	}
+	infected, detail, err := runScanner(tmpPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "scan %s: %v\n", code, err)
+		return
+	}
+	if infected {
+		fmt.Fprintf(os.Stderr, "scan %s: flagged (%s), quarantining\n", code, detail)
+		if err := st.Quarantine(code); err != nil {
+			fmt.Fprintf(os.Stderr, "scan %s: quarantine: %v\n", code, err)
+		}
+		return
+	}
+	fmt.Printf("info: scan clean for code %s\n", code)
+}
+
+// decryptBlobToWriter streams the decrypted plaintext of a code-encrypted
+// blob to w (chunked from the .dat file, or the in-blob sealed payload).
+func decryptBlobToWriter(st *store.Store, code string, blob *store.StoredBlob, w io.Writer) error {
+	key, err := protocol.DeriveTransferKey(code, blob.KeyVersion, blob.KeySalt)
+	if err != nil {
+		return err
+	}
+	if blob.Chunked {
+		df, err := os.Open(st.DataPath(code))
+		if err != nil {
+			return err
+		}
+		defer df.Close()
+		for i := uint32(0); i < blob.NumChunks; i++ {
+			var header [16]byte
+			if _, err := io.ReadFull(df, header[:]); err != nil {
+				return err
+			}
+			sealedLen := binary.BigEndian.Uint32(header[12:16])
+			sealed := make([]byte, sealedLen)
+			if _, err := io.ReadFull(df, sealed); err != nil {
+				return err
+			}
+			var pt []byte
+			if protocol.ChunkStreamAAD(blob.KeyVersion) {
+				pt, err = protocol.DecryptChunkStream(key, uint64(i), i == blob.NumChunks-1, header[:12], sealed)
+			} else {
+				pt, err = protocol.DecryptWithKey(key, header[:12], sealed)
+			}
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(pt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if blob.Chunks != nil {
+		for i, c := range blob.Chunks {
+			var pt []byte
+			if protocol.ChunkStreamAAD(blob.KeyVersion) {
+				pt, err = protocol.DecryptChunkStream(key, uint64(i), i == len(blob.Chunks)-1, c.Nonce[:], c.Sealed)
+			} else {
+				pt, err = protocol.DecryptWithKey(key, c.Nonce[:], c.Sealed)
+			}
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(pt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	sealed, err := st.LoadSealed(code, blob)
+	if err != nil {
+		return err
+	}
+	pt, err := protocol.DecryptWithKey(key, blob.Nonce, sealed)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(pt)
+	return err
+}
+
+func runScanner(path string) (infected bool, detail string, err error) {
+	if ScanClamdAddr != "" {
+		return scanWithClamd(path)
+	}
+	cmd := exec.Command(ScanCommand, path)
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return false, "", nil
+	}
+	if ee, ok := err.(*exec.ExitError); ok && ee.ExitCode() == 1 {
+		// clamscan convention: exit 1 = virus found
+		return true, strings.TrimSpace(string(out)), nil
+	}
+	return false, "", fmt.Errorf("scanner command: %w", err)
+}
+
+// scanWithClamd streams the file to clamd via INSTREAM.
+func scanWithClamd(path string) (infected bool, detail string, err error) {
+	network := "tcp"
+	if strings.HasPrefix(ScanClamdAddr, "/") {
+		network = "unix"
+	}
+	conn, err := net.DialTimeout(network, ScanClamdAddr, 10*time.Second)
+	if err != nil {
+		return false, "", fmt.Errorf("dial clamd: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Minute))
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return false, "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false, "", err
+	}
+	defer f.Close()
+	buf := make([]byte, 64*1024)
+	for {
+		n, readErr := f.Read(buf)
+		if n > 0 {
+			var sz [4]byte
+			binary.BigEndian.PutUint32(sz[:], uint32(n))
+			if _, err := conn.Write(sz[:]); err != nil {
+				return false, "", err
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return false, "", err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return false, "", readErr
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return false, "", err
+	}
+	reply, err := io.ReadAll(io.LimitReader(conn, 4096))
+	if err != nil {
+		return false, "", err
+	}
+	resp := strings.TrimRight(string(reply), "\x00\n")
+	if strings.HasSuffix(resp, "FOUND") {
+		return true, resp, nil
+	}
+	if strings.HasSuffix(resp, "OK") {
+		return false, "", nil
+	}
+	return false, "", fmt.Errorf("clamd: unexpected reply %q", resp)
+}
@@ -0,0 +1,1994 @@
+// Package server implements the tcpraw server: the TCP accept loop and
+// per-message handlers, rate limiting and abuse handling, the web download
+// page, and the admin endpoints.
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tcpraw/pkg/protocol"
+	"tcpraw/pkg/store"
+)
+
+const publicIPURL = "https://api.ipify.org"
+
+func getServerPublicIP() (string, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(publicIPURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// findServerIDByIP returns (id, true) if a list address matches ourIP, else (0, false).
+func findServerIDByIP(ourIP string) (int, bool) {
+	addrs, err := protocol.FetchServerList()
+	if err != nil {
+		return 0, false
+	}
+	for id, hostPort := range addrs {
+		if hostPort == "" {
+			continue
+		}
+		host, _, err := net.SplitHostPort(hostPort)
+		if err != nil {
+			continue
+		}
+		if host == ourIP {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// Server tunables, overridable from the CLI flags before RunServer.
+var (
+	CleanupInterval   = 5 * time.Minute
+	MaxBlobSize       = int64(15 * 1024 * 1024 * 1024) // 15 GB per upload
+	RateLimitAttempts = 50
+	RateLimitWindow   = 10 * time.Minute
+	BanDuration       = 15 * time.Minute
+
+	// Bench abuse controls. A bench streams full-rate traffic for the
+	// requested duration in each direction, which makes an uncapped public
+	// server an easy bandwidth-exhaustion target.
+	BenchDisabled   = false // refuse MsgBench outright
+	BenchMaxSeconds = 30    // longest per-phase duration a client may request
+	BenchPerIPLimit = 6     // bench requests per IP per RateLimitWindow; 0 = unlimited
+
+	// NamedPipePath adds a Windows named-pipe listener (-pipe) next to the
+	// TCP one, for local IPC clients; empty = disabled.
+	NamedPipePath = ""
+
+	// Version is the build's version string, set from main; advertised in
+	// the probe capability frame so clients can show what a node runs.
+	Version = ""
+)
+
+// benchLimiter tracks bench requests per IP, separate from the download
+// limiter so probing codes and benchmarking do not count against each other.
+// Created in Serve when BenchPerIPLimit > 0.
+var benchLimiter *rateLimiter
+
+// serverRateLimiter is the live download limiter; kept in a package var so a
+// config reload can adjust its limits in place.
+var serverRateLimiter *rateLimiter
+
+// serverMaxBlobSize is the upload size limit the handlers enforce; set at
+// RunServer start. Atomic because a config reload rewrites it while
+// transfers are in flight.
+var serverMaxBlobSize atomic.Int64
+
+// serverLongTerm enables long-term storage (client can request e.g. 7d; max 150 MB).
+var serverLongTerm bool
+
+// uploadLedger reserves the declared size of every in-flight upload. The
+// client-side free-space probe only sees the disk at probe time, so several
+// concurrent uploads that each fit on their own could jointly fill the disk
+// mid-transfer; admission goes through the ledger instead.
+var uploadLedger reservationLedger
+
+type reservationLedger struct {
+	mu       sync.Mutex
+	reserved int64
+}
+
+// reserve claims n bytes against the free space in dir, counting what other
+// in-flight uploads have already claimed. The returned release must be
+// called when the upload finishes, successfully or not.
+func (l *reservationLedger) reserve(n int64, dir string) (release func(), err error) {
+	free, ferr := getDiskFreeSpace(dir)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ferr == nil && l.reserved+n > int64(free) {
+		return nil, fmt.Errorf("insufficient disk space: %s free, %s reserved by in-flight uploads, %s declared",
+			protocol.FormatBytes(float64(free)), protocol.FormatBytes(float64(l.reserved)), protocol.FormatBytes(float64(n)))
+	}
+	l.reserved += n
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			l.reserved -= n
+			l.mu.Unlock()
+		})
+	}, nil
+}
+
+// reservedUploadBytes is the on-disk footprint to reserve for a declared
+// plaintext length: payload, per-chunk GCM tag and framing, and a little
+// slack for the .blob metadata.
+func reservedUploadBytes(totalPlainLen uint64, numChunks uint32) int64 {
+	return int64(totalPlainLen) + int64(numChunks)*28 + 4096
+}
+
+// chunkBufPool recycles sealed-chunk buffers on the hot paths (upload
+// streaming, chunked download, web decrypt loop). Without it one large
+// transfer allocates a fresh buffer per 256 KB chunk, which adds up to
+// gigabytes of garbage.
+var chunkBufPool = sync.Pool{
+	New: func() any { return make([]byte, protocol.FileChunkSize+16) },
+}
+
+// getChunkBuf returns a pooled buffer of length n. Buffers larger than a
+// sealed chunk are allocated directly and never pooled.
+func getChunkBuf(n uint32) []byte {
+	buf := chunkBufPool.Get().([]byte)
+	if uint32(cap(buf)) < n {
+		chunkBufPool.Put(buf)
+		return make([]byte, n)
+	}
+	return buf[:n]
+}
+
+func putChunkBuf(buf []byte) {
+	if cap(buf) >= protocol.FileChunkSize+16 {
+		chunkBufPool.Put(buf[:cap(buf)])
+	}
+}
+
+// A Server is an embeddable tcpraw server. Populate the config fields, then
+// call Serve; the zero value listens on the default port with a ./data
+// directory. Tests and third-party programs can set Port to "0" for an
+// ephemeral port and read it back from Addr once Serve is running.
+type Server struct {
+	ID          int    // server id 0-9 (first digit of generated codes)
+	Port        string // listen port; "0" picks an ephemeral port
+	DataDir     string // directory for stored encrypted blobs
+	WebPort     string // web download page port; empty = disabled
+	MaxBlobSize int64  // max upload size in bytes; 0 = MaxBlobSize default
+	LongTerm    bool   // allow long-term storage requests
+	AutoID      bool   // detect the id from the public server list (CLI behavior)
+
+	mu       sync.Mutex
+	ln       net.Listener
+	st       *store.Store
+	handlers sync.WaitGroup
+	done     chan struct{}
+}
+
+// Serve listens and handles connections until ctx is cancelled or Shutdown
+// is called; it returns nil on a clean stop. It owns the store, cleanup
+// sweeps, stats reporting and (when WebPort is set) the web server.
+func (s *Server) Serve(ctx context.Context) error {
+	port := s.Port
+	if port == "" {
+		port = "9999"
+	}
+	dataDir := s.DataDir
+	if dataDir == "" {
+		dataDir = "./data"
+	}
+	maxBlob := s.MaxBlobSize
+	if maxBlob == 0 {
+		maxBlob = MaxBlobSize
+	}
+	serverMaxBlobSize.Store(maxBlob)
+	serverLongTerm = s.LongTerm
+	serverID := s.ID
+	if s.AutoID {
+		if ourIP, err := getServerPublicIP(); err == nil {
+			if id, ok := findServerIDByIP(ourIP); ok {
+				serverID = id
+				fmt.Printf("tcpraw server: auto-detected id=%d (address %s is on the list)\n", serverID, ourIP)
+			} else {
+				fmt.Println("tcpraw server: running outside main network (your address is not on the list).")
+				fmt.Printf("  To send files to this server, specify address manually, e.g.:\n")
+				fmt.Printf("  tcpraw send <file> %s:%s\n", ourIP, port)
+				fmt.Printf("  tcpraw secure send <file> %s:%s\n", ourIP, port)
+			}
+		}
+	}
+
+	st, err := store.NewStore(dataDir)
+	if err != nil {
+		return err
+	}
+	fmt.Println(st.Report())
+	registerBuiltinHooks()
+	st.NotifyExpire = hookExpire
+	serverBlocklist, err = loadBlocklist(st.DataDir())
+	if err != nil {
+		return fmt.Errorf("load blocklist: %w", err)
+	}
+	// Pick up a server.conf left from a previous run before accepting.
+	applyConfigOverrides(st)
+
+	var ln net.Listener
+	if inherited := inheritedListener(); inherited != nil {
+		ln = inherited
+		fmt.Println("tcpraw server: resumed listener from previous binary (upgrade)")
+	} else if store.SharedDir {
+		// Sibling processes accept on the same port; the kernel spreads
+		// incoming connections across them.
+		lc := net.ListenConfig{Control: reusePortControl}
+		ln, err = lc.Listen(ctx, "tcp", ":"+port)
+		if err == nil {
+			fmt.Println("tcpraw server: shared data dir mode (locked index, SO_REUSEPORT listener)")
+		}
+	} else {
+		ln, err = net.Listen("tcp", ":"+port)
+	}
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	rawLn := ln // pre-TLS TCP listener; the upgrade handover needs its fd
+	if ProxyProtocol {
+		// Below TLS: the PROXY header travels in the clear before the
+		// handshake, the way HAProxy and cloud L4 balancers send it.
+		ln = &proxyListener{ln}
+		fmt.Println("tcpraw server: PROXY protocol required on listener (v1/v2)")
+	}
+	if protocol.ServerTLSConfig != nil {
+		ln = tls.NewListener(ln, protocol.ServerTLSConfig)
+		fmt.Println("tcpraw server: TLS enabled on listener")
+		if protocol.ServerTLSConfig.ClientCAs != nil {
+			if protocol.ServerMTLSDownloads {
+				fmt.Println("tcpraw server: client certificates required for uploads and downloads")
+			} else {
+				fmt.Println("tcpraw server: client certificates required for uploads")
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.ln = ln
+	s.st = st
+	s.done = make(chan struct{})
+	done := s.done
+	s.mu.Unlock()
+	defer close(done)
+	defer ln.Close()
+
+	go func() {
+		tick := time.NewTicker(CleanupInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				st.CleanupExpired()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	startStatsReporter(st, StatsInterval)
+	startTelemetry()
+
+	rl := newRateLimiter(RateLimitAttempts, RateLimitWindow, BanDuration)
+	if err := rl.loadBans(st.DataDir()); err != nil {
+		fmt.Fprintf(os.Stderr, "load bans: %v\n", err)
+	}
+	serverRateLimiter = rl
+	if BenchPerIPLimit > 0 {
+		benchLimiter = newRateLimiter(BenchPerIPLimit, RateLimitWindow, BanDuration)
+	}
+	watchReloadSignal(st, done)
+	watchUpgradeSignal(rawLn, done)
+	if s.WebPort != "" {
+		go RunWebServer(s.WebPort, st, rl, serverID)
+		fmt.Printf("tcpraw server: web download page on :%s (open in browser, enter code to download)\n", s.WebPort)
+	}
+	if NamedPipePath != "" {
+		pln, err := protocol.ListenNamedPipe(NamedPipePath)
+		if err != nil {
+			return fmt.Errorf("pipe listen: %w", err)
+		}
+		defer pln.Close()
+		fmt.Printf("tcpraw server: named pipe listener on %s\n", NamedPipePath)
+		go func() {
+			for {
+				conn, err := pln.Accept()
+				if err != nil {
+					if errors.Is(err, net.ErrClosed) {
+						return
+					}
+					fmt.Fprintf(os.Stderr, "pipe accept: %v\n", err)
+					continue
+				}
+				s.handlers.Add(1)
+				go func() {
+					defer s.handlers.Done()
+					handleConn(conn, st, rl, serverID)
+				}()
+			}
+		}()
+	}
+	if TorControlAddr != "" {
+		if onion, err := publishOnionService(TorControlAddr, port, st.DataDir()); err != nil {
+			fmt.Fprintf(os.Stderr, "onion service: %v\n", err)
+		} else {
+			fmt.Printf("tcpraw server: reachable as onion service %s:%s\n", onion, port)
+		}
+	}
+
+	// Cancelling ctx unblocks Accept by closing the listener.
+	stop := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stop()
+
+	fmt.Printf("tcpraw server: id=%d, listening on %s, data dir %s, blobs kept %v, max %d MB, rate limit %d/%v sustained\n",
+		serverID, ln.Addr(), dataDir, store.StorageDuration, serverMaxBlobSize.Load()/(1024*1024), RateLimitAttempts, RateLimitWindow)
+
+	// Accept-loop resilience: a burst that exhausts file descriptors would
+	// otherwise make Accept spin-fail at full CPU while spamming stderr.
+	// Transient errors back off exponentially, and a semaphore caps the
+	// concurrent handlers so a flood is shed instead of eating every FD.
+	sem := make(chan struct{}, maxConcurrentConns)
+	backoff := acceptBackoffMin
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				// Graceful stop (Shutdown, ctx cancel or binary upgrade):
+				// let in-flight transfers finish before returning.
+				s.handlers.Wait()
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "accept: %v (retrying in %v)\n", err, backoff)
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > acceptBackoffMax {
+				backoff = acceptBackoffMax
+			}
+			continue
+		}
+		backoff = acceptBackoffMin
+		select {
+		case sem <- struct{}{}:
+		default:
+			// Above the cap: reject instead of queueing into exhaustion.
+			fmt.Fprintf(os.Stderr, "too many connections (%d), rejecting %s\n", maxConcurrentConns, conn.RemoteAddr())
+			protocol.SendStatus(conn, protocol.StatusError)
+			conn.Close()
+			continue
+		}
+		s.handlers.Add(1)
+		go func() {
+			defer func() { <-sem; s.handlers.Done() }()
+			handleConn(conn, st, rl, serverID)
+		}()
+	}
+}
+
+// Shutdown stops accepting new connections and waits for in-flight handlers
+// to finish, or for ctx to expire, whichever comes first.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	ln := s.ln
+	s.mu.Unlock()
+	if ln != nil {
+		ln.Close()
+	}
+	idle := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(idle)
+	}()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Addr returns the listener address once Serve is running, or nil before.
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln == nil {
+		return nil
+	}
+	return s.ln.Addr()
+}
+
+// RunServer runs a server with the CLI defaults (public-list id detection
+// on) and blocks until the listener fails.
+func RunServer(serverIDFromFlag int, port, dataDir, webPort string, maxBlobSize int64, longTerm bool) error {
+	srv := &Server{
+		ID:          serverIDFromFlag,
+		Port:        port,
+		DataDir:     dataDir,
+		WebPort:     webPort,
+		MaxBlobSize: maxBlobSize,
+		LongTerm:    longTerm,
+		AutoID:      true,
+	}
+	return srv.Serve(context.Background())
+}
+
+// Accept-loop tuning: handler cap and error backoff bounds.
+const (
+	maxConcurrentConns = 512
+	acceptBackoffMin   = 10 * time.Millisecond
+	acceptBackoffMax   = time.Second
+)
+
+// Token-bucket rate limiting. Each IP gets one bucket per traffic class (a
+// class is a message type, or "web"/"report" on the web port); a bucket
+// holds up to burst tokens and refills continuously at the sustained rate
+// derived from the flag pair (-rl-attempts per -rl-window). Draining a
+// bucket only means waiting for the next token: a NAT full of legitimate
+// users is slowed to the sustained rate instead of banned outright, and a
+// guesser can no longer fire a full window's worth of attempts in one burst
+// because the burst capacity is a fraction of the window allowance. The
+// banned map holds only explicit bans; exhaustion never populates it.
+type tbBucket struct {
+	tokens   float64
+	last     time.Time
+	notified bool // throttle webhook sent for the current dry spell
+}
+
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tbBucket // key: class + "|" + ip
+	banned    map[string]time.Time
+	reasons   map[string]string // why each banned IP was banned
+	bansPath  string            // persisted bans file; empty = in-memory only
+	rate      float64           // sustained tokens per second
+	burst     float64           // bucket capacity
+	ban       time.Duration
+	lastSweep time.Time
+}
+
+// rlBurstDivisor: the burst capacity is the window allowance divided by
+// this, so the default 50-per-10-minutes pair yields 10 back-to-back
+// requests before the sustained rate takes over.
+const rlBurstDivisor = 5
+
+// rlSweepInterval bounds how often the lazy full-bucket sweep runs.
+const rlSweepInterval = 10 * time.Minute
+
+func newRateLimiter(maxAttempts int, window, ban time.Duration) *rateLimiter {
+	rl := &rateLimiter{
+		buckets:   make(map[string]*tbBucket),
+		banned:    make(map[string]time.Time),
+		reasons:   make(map[string]string),
+		lastSweep: time.Now(),
+	}
+	rl.configure(maxAttempts, window, ban)
+	return rl
+}
+
+func (rl *rateLimiter) configure(maxAttempts int, window, ban time.Duration) {
+	rl.rate = float64(maxAttempts) / window.Seconds()
+	burst := float64(maxAttempts) / rlBurstDivisor
+	if burst < 1 {
+		burst = 1
+	}
+	rl.burst = burst
+	rl.ban = ban
+}
+
+// setLimits updates a live limiter in place (config reload); existing
+// buckets keep their fill and refill under the new numbers.
+func (rl *rateLimiter) setLimits(maxAttempts int, window, ban time.Duration) {
+	rl.mu.Lock()
+	rl.configure(maxAttempts, window, ban)
+	rl.mu.Unlock()
+}
+
+func (rl *rateLimiter) allow(class, ip string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := time.Now()
+	if until, ok := rl.banned[ip]; ok {
+		if now.Before(until) {
+			srvStats.rateLimited.Add(1)
+			return false
+		}
+		delete(rl.banned, ip)
+		delete(rl.reasons, ip)
+	}
+	rl.maybeSweep(now)
+	key := class + "|" + ip
+	b := rl.buckets[key]
+	if b == nil {
+		b = &tbBucket{tokens: rl.burst, last: now}
+		rl.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * rl.rate
+	if b.tokens > rl.burst {
+		b.tokens = rl.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		srvStats.rateLimited.Add(1)
+		if !b.notified {
+			b.notified = true
+			notifyWebhook(webhookEvent{Event: "throttle", IP: ip, Detail: fmt.Sprintf("%s bucket drained", class)})
+		}
+		return false
+	}
+	b.tokens--
+	b.notified = false
+	return true
+}
+
+// maybeSweep drops buckets that have refilled completely; they carry no
+// state a fresh bucket wouldn't, and without the sweep one entry per client
+// IP would sit in the map forever. Called with mu held.
+func (rl *rateLimiter) maybeSweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < rlSweepInterval {
+		return
+	}
+	rl.lastSweep = now
+	for key, b := range rl.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rl.rate >= rl.burst {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// banIP bans ip explicitly; every class is refused until the ban lifts.
+// A non-positive duration falls back to the limiter's -ban default. The ban
+// is written through to the bans file, so it survives a restart.
+func (rl *rateLimiter) banIP(ip string, d time.Duration, reason string) time.Time {
+	rl.mu.Lock()
+	if d <= 0 {
+		d = rl.ban
+	}
+	until := time.Now().Add(d)
+	rl.banned[ip] = until
+	rl.reasons[ip] = reason
+	rl.saveBansLocked()
+	rl.mu.Unlock()
+	srvStats.bans.Add(1)
+	notifyWebhook(webhookEvent{Event: "ban", IP: ip, Detail: reason})
+	return until
+}
+
+// unban lifts an explicit ban immediately and reports whether one existed.
+func (rl *rateLimiter) unban(ip string) bool {
+	rl.mu.Lock()
+	_, ok := rl.banned[ip]
+	delete(rl.banned, ip)
+	delete(rl.reasons, ip)
+	if ok {
+		rl.saveBansLocked()
+	}
+	rl.mu.Unlock()
+	return ok
+}
+
+// snapshot copies the limiter state for the admin dashboard: explicit bans,
+// and per-IP tokens spent across classes (how hard each client is pushing).
+func (rl *rateLimiter) snapshot() (banned map[string]time.Time, spent map[string]int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	banned = make(map[string]time.Time, len(rl.banned))
+	for ip, until := range rl.banned {
+		banned[ip] = until
+	}
+	now := time.Now()
+	spent = make(map[string]int)
+	for key, b := range rl.buckets {
+		_, ip, found := strings.Cut(key, "|")
+		if !found {
+			continue
+		}
+		tokens := b.tokens + now.Sub(b.last).Seconds()*rl.rate
+		if tokens > rl.burst {
+			tokens = rl.burst
+		}
+		if used := int(rl.burst - tokens); used > 0 {
+			spent[ip] += used
+		}
+	}
+	return banned, spent
+}
+
+func extractIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func handleConn(conn net.Conn, st *store.Store, rl *rateLimiter, serverID int) {
+	defer conn.Close()
+	protocol.SetTCPBuffers(conn)
+	r := bufio.NewReaderSize(conn, protocol.BufSize)
+
+	msgType, err := protocol.ReadMessageType(r)
+	if err != nil {
+		if err != io.EOF {
+			fmt.Fprintf(os.Stderr, "read type: %v\n", err)
+		}
+		return
+	}
+
+	connPipeline(&connState{
+		conn:     conn,
+		r:        r,
+		msgType:  msgType,
+		ip:       extractIP(conn.RemoteAddr().String()),
+		st:       st,
+		rl:       rl,
+		serverID: serverID,
+	})
+}
+
+func handleTest(conn net.Conn, r io.Reader, st *store.Store) {
+	fileSize, err := protocol.ReadTestRequest(r)
+	if err != nil {
+		return
+	}
+	free, err := getDiskFreeSpace(st.DataDir())
+	if err != nil {
+		free = 0
+	}
+	if err := binary.Write(conn, binary.BigEndian, free); err != nil {
+		return
+	}
+	payloadSize := uint32(protocol.TestPayloadSize)
+	if err := binary.Write(conn, binary.BigEndian, payloadSize); err != nil {
+		return
+	}
+	// Send pseudo-random (incompressible) payload for bandwidth test
+	buf := make([]byte, payloadSize)
+	io.ReadFull(protocol.NewBenchStream(), buf)
+	for len(buf) > 0 {
+		n, _ := conn.Write(buf)
+		if n <= 0 {
+			return
+		}
+		buf = buf[n:]
+	}
+	// Capability frame last: legacy clients have stopped reading by now,
+	// new clients read it to feature-detect without trial messages.
+	protocol.WriteServerCaps(conn, serverCaps(), protocol.FileChunkSize, protocol.CurrentKeyVersion, Version)
+	// Client may close; we don't check fileSize vs free here, client does
+	_ = fileSize
+}
+
+// serverCaps assembles the capability bitmap advertised to probing clients.
+// Message types this build always serves are static; the conditional bits
+// reflect runtime flags.
+func serverCaps() uint64 {
+	caps := uint64(protocol.CapRange | protocol.CapPake | protocol.CapDelta | protocol.CapAppend | protocol.CapCheck | protocol.CapMigrate)
+	if !BenchDisabled {
+		caps |= protocol.CapBench
+	}
+	if protocol.ServerTLSConfig != nil {
+		caps |= protocol.CapTLS
+	}
+	return caps
+}
+
+func handleBench(conn net.Conn, r io.Reader, st *store.Store) {
+	maxSec := uint16(30)
+	if BenchMaxSeconds > 0 && BenchMaxSeconds < 30 {
+		maxSec = uint16(BenchMaxSeconds)
+	}
+	phase, durationSec, err := protocol.ReadBenchRequest(r)
+	if err != nil || durationSec < 1 || durationSec > maxSec {
+		return
+	}
+	duration := time.Duration(durationSec) * time.Second
+	if phase == 0 {
+		// Download: server sends free, then stream for duration, then totalBytes
+		free, err := getDiskFreeSpace(st.DataDir())
+		if err != nil {
+			free = 0
+		}
+		if err := binary.Write(conn, binary.BigEndian, free); err != nil {
+			return
+		}
+		deadline := time.Now().Add(duration + 10*time.Second)
+		conn.SetWriteDeadline(deadline)
+		payload := protocol.NewBenchStream()
+		buf := make([]byte, 64*1024)
+		var total int64
+		stop := time.Now().Add(duration)
+		for time.Now().Before(stop) || total < protocol.BenchMinBytes {
+			io.ReadFull(payload, buf)
+			n, err := conn.Write(buf)
+			if err != nil {
+				return
+			}
+			total += int64(n)
+		}
+		conn.SetWriteDeadline(time.Time{})
+		if err := binary.Write(conn, binary.BigEndian, uint64(total)); err != nil {
+			return
+		}
+		// Next request: upload phase
+		phase2, dur2, err := protocol.ReadBenchRequest(r)
+		if err != nil || phase2 != 1 {
+			return
+		}
+		if dur2 < 1 || dur2 > maxSec {
+			return
+		}
+		durationSec = dur2
+		phase = 1
+	}
+	if phase == 1 {
+		// Upload: the client streams for at least its duration and at least
+		// protocol.BenchMinBytes, then appends an 8-byte totalBytes with no
+		// marker. Read until the stream goes quiet and take the trailing 8
+		// bytes as the total; reading for a fixed time instead races the
+		// total into the window and desyncs the phases.
+		dur := time.Duration(durationSec) * time.Second
+		deadline := time.Now().Add(dur + 10*time.Second)
+		until := time.Now().Add(dur)
+		hardStop := until.Add(10 * time.Second)
+		buf := make([]byte, 64*1024)
+		var totalRead int64
+		lastData := time.Now()
+		var tail []byte
+		for {
+			conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+			n, readErr := r.Read(buf)
+			if n > 0 {
+				totalRead += int64(n)
+				lastData = time.Now()
+				tail = append(tail, buf[:n]...)
+				if len(tail) > 8 {
+					tail = tail[len(tail)-8:]
+				}
+			}
+			if readErr != nil {
+				if ne, ok := readErr.(net.Error); ok && ne.Timeout() {
+					if time.Now().After(hardStop) {
+						return
+					}
+					if time.Now().After(until) && totalRead >= 8 && time.Since(lastData) > 600*time.Millisecond {
+						break
+					}
+					continue
+				}
+				return
+			}
+		}
+		conn.SetReadDeadline(deadline)
+		clientTotal := binary.BigEndian.Uint64(tail)
+		if err := binary.Write(conn, binary.BigEndian, clientTotal); err != nil {
+			return
+		}
+		// Next request: crypto phase. Older clients just close instead.
+		phase3, _, err := protocol.ReadBenchRequest(r)
+		if err != nil || phase3 != 2 {
+			return
+		}
+		phase = 2
+	}
+	if phase == 2 {
+		// Crypto: measure local AES-GCM throughput and report single-core
+		// and all-core bytes/sec.
+		single, multi := protocol.CryptoBenchThroughput()
+		if err := binary.Write(conn, binary.BigEndian, single); err != nil {
+			return
+		}
+		_ = binary.Write(conn, binary.BigEndian, multi)
+	}
+}
+
+func handleUpload(conn net.Conn, r io.Reader, st *store.Store, password string, notBeforeSec uint32) {
+	// Stream read of upload header (chunked) and write encrypted chunks straight to disk.
+	// New clients prefix the header with a version marker; legacy headers
+	// start directly with the 6-digit code.
+	first := make([]byte, 1)
+	if _, err := io.ReadFull(r, first); err != nil {
+		if err != io.EOF {
+			fmt.Fprintf(os.Stderr, "read code: %v\n", err)
+		}
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	keyVersion := protocol.KeyVersionSHA256
+	var kdfSalt []byte
+	var signerPub, signature []byte
+	var metaFrame []byte
+	codeBuf := make([]byte, protocol.CodeLength)
+	if first[0] == protocol.UploadVersionMarker {
+		verBuf := make([]byte, 1)
+		if _, err := io.ReadFull(r, verBuf); err != nil {
+			fmt.Fprintf(os.Stderr, "read key version: %v\n", err)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		keyVersion = verBuf[0]
+		if _, err := protocol.SchemeFor(keyVersion); err != nil {
+			fmt.Fprintf(os.Stderr, "upload rejected: %v\n", err)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		if size := protocol.HeaderSaltSize(keyVersion); size > 0 {
+			kdfSalt = make([]byte, size)
+			if _, err := io.ReadFull(r, kdfSalt); err != nil {
+				fmt.Fprintf(os.Stderr, "read key salt: %v\n", err)
+				protocol.SendStatus(conn, protocol.StatusError)
+				return
+			}
+		}
+		if protocol.HeaderHasSignFrame(keyVersion) {
+			var err error
+			signerPub, signature, err = protocol.ReadSignatureFrame(r)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "read signer frame: %v\n", err)
+				protocol.SendStatus(conn, protocol.StatusError)
+				return
+			}
+		}
+		if protocol.HeaderHasMetaFrame(keyVersion) {
+			var err error
+			metaFrame, err = protocol.ReadRawMetaFrame(r)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "read metadata frame: %v\n", err)
+				protocol.SendStatus(conn, protocol.StatusError)
+				return
+			}
+		}
+		if _, err := io.ReadFull(r, codeBuf); err != nil {
+			fmt.Fprintf(os.Stderr, "read code: %v\n", err)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+	} else {
+		codeBuf[0] = first[0]
+		if _, err := io.ReadFull(r, codeBuf[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "read code: %v\n", err)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+	}
+	code := string(codeBuf)
+	if !protocol.ValidCode(code) {
+		fmt.Fprintf(os.Stderr, "upload rejected: malformed code %q\n", code)
+		protocol.SendStatus(conn, protocol.StatusMalformedCode)
+		return
+	}
+
+	var nameLen uint16
+	if err := binary.Read(r, binary.BigEndian, &nameLen); err != nil {
+		fmt.Fprintf(os.Stderr, "read name len: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	if nameLen > protocol.MaxWireNameLen {
+		fmt.Fprintf(os.Stderr, "upload rejected: name length %d\n", nameLen)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	nameBuf := make([]byte, nameLen)
+	if _, err := io.ReadFull(r, nameBuf); err != nil {
+		fmt.Fprintf(os.Stderr, "read name: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	name := string(nameBuf)
+
+	var totalPlainLen uint64
+	if err := binary.Read(r, binary.BigEndian, &totalPlainLen); err != nil {
+		fmt.Fprintf(os.Stderr, "read totalPlainLen: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	var storageDurationSec uint32
+	if err := binary.Read(r, binary.BigEndian, &storageDurationSec); err != nil {
+		fmt.Fprintf(os.Stderr, "read storageDurationSec: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	if storageDurationSec > 0 {
+		if !serverLongTerm {
+			fmt.Fprintf(os.Stderr, "upload rejected: long-term not supported on this server\n")
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		if int64(totalPlainLen) > protocol.LongTermMaxBytes {
+			fmt.Fprintf(os.Stderr, "upload rejected: long-term max %d MB\n", protocol.LongTermMaxBytes/(1024*1024))
+			reportReject("size_rejected", name, "long-term max exceeded", extractIP(conn.RemoteAddr().String()))
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+	}
+	if maxSize := serverMaxBlobSize.Load(); maxSize > 0 && int64(totalPlainLen) > maxSize {
+		fmt.Fprintf(os.Stderr, "upload rejected: blob exceeds max size %d MB\n", maxSize/(1024*1024))
+		reportReject("size_rejected", name, "exceeds max blob size", extractIP(conn.RemoteAddr().String()))
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+
+	var numChunks uint32
+	if err := binary.Read(r, binary.BigEndian, &numChunks); err != nil {
+		fmt.Fprintf(os.Stderr, "read numChunks: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+
+	plaintextChecksum := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(r, plaintextChecksum); err != nil {
+		fmt.Fprintf(os.Stderr, "read checksum: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+
+	// The declared count sizes the chunk-sums frame and the receive loop;
+	// bound it before either.
+	if err := protocol.CheckChunkCount(numChunks, totalPlainLen); err != nil {
+		fmt.Fprintf(os.Stderr, "upload rejected: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+
+	var chunkSums []byte
+	if protocol.HeaderHasChunkSums(keyVersion) {
+		chunkSums = make([]byte, int64(numChunks)*protocol.ChunkSumSize)
+		if _, err := io.ReadFull(r, chunkSums); err != nil {
+			fmt.Fprintf(os.Stderr, "read chunk sums: %v\n", err)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+	}
+
+	baseName := protocol.SanitizeFilename(name)
+	if err := checkUploadPolicy(baseName); err != nil {
+		fmt.Fprintf(os.Stderr, "upload rejected by policy: %v\n", err)
+		reportReject("policy_rejected", baseName, err.Error(), extractIP(conn.RemoteAddr().String()))
+		protocol.SendStatus(conn, protocol.StatusPolicyRejected)
+		return
+	}
+
+	release, err := uploadLedger.reserve(reservedUploadBytes(totalPlainLen, numChunks), st.DataDir())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "upload rejected: %v\n", err)
+		reportReject("size_rejected", baseName, "insufficient disk space", extractIP(conn.RemoteAddr().String()))
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	defer release()
+
+	fmt.Println("info: receiving encrypted file", baseName)
+
+	dataPath := st.DataPath(code)
+	tmpPath := st.TempDataPath(code)
+	df, err := os.Create(tmpPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "create data file: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	dw := diskWriter(df)
+	var plainCount uint64
+	for i := uint32(0); i < numChunks; i++ {
+		// nonce (12)
+		var header [16]byte
+		if _, err := io.ReadFull(r, header[:12]); err != nil {
+			df.Close()
+			os.Remove(tmpPath)
+			fmt.Fprintf(os.Stderr, "read nonce: %v\n", err)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		// sealedLen (4)
+		if _, err := io.ReadFull(r, header[12:16]); err != nil {
+			df.Close()
+			os.Remove(tmpPath)
+			fmt.Fprintf(os.Stderr, "read sealedLen: %v\n", err)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		sealedLen := binary.BigEndian.Uint32(header[12:16])
+		if sealedLen < 16 || sealedLen > protocol.MaxWireChunkSealed {
+			df.Close()
+			os.Remove(tmpPath)
+			fmt.Fprintf(os.Stderr, "invalid sealedLen: %d\n", sealedLen)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		plainCount += uint64(sealedLen - 16)
+		if maxSize := serverMaxBlobSize.Load(); maxSize > 0 && int64(plainCount) > maxSize {
+			df.Close()
+			os.Remove(tmpPath)
+			fmt.Fprintf(os.Stderr, "upload rejected mid-stream: blob exceeds max size %d MB\n", maxSize/(1024*1024))
+			reportReject("size_rejected", baseName, "exceeds max blob size", extractIP(conn.RemoteAddr().String()))
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		// Write header to file
+		if _, err := dw.Write(header[:16]); err != nil {
+			df.Close()
+			os.Remove(tmpPath)
+			fmt.Fprintf(os.Stderr, "write header to data file: %v\n", err)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		// Write encrypted chunk
+		sealed := getChunkBuf(sealedLen)
+		if _, err := io.ReadFull(r, sealed); err != nil {
+			df.Close()
+			os.Remove(tmpPath)
+			fmt.Fprintf(os.Stderr, "read sealed chunk: %v\n", err)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		if _, err := dw.Write(sealed); err != nil {
+			df.Close()
+			os.Remove(tmpPath)
+			fmt.Fprintf(os.Stderr, "write sealed chunk: %v\n", err)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		putChunkBuf(sealed)
+	}
+	if store.DurableUploads {
+		if err := df.Sync(); err != nil {
+			df.Close()
+			os.Remove(tmpPath)
+			fmt.Fprintf(os.Stderr, "sync data file: %v\n", err)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+	}
+	if err := df.Close(); err != nil {
+		os.Remove(tmpPath)
+		fmt.Fprintf(os.Stderr, "close data file: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	if plainCount != totalPlainLen {
+		os.Remove(tmpPath)
+		fmt.Fprintf(os.Stderr, "mismatched plaintext length: header=%d, counted=%d\n", totalPlainLen, plainCount)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	if err := os.Rename(tmpPath, dataPath); err != nil {
+		os.Remove(tmpPath)
+		fmt.Fprintf(os.Stderr, "finalize data file: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	if store.DurableUploads {
+		store.SyncDir(st.DataDir())
+	}
+
+	createdAt := time.Now()
+	duration := st.TTL()
+	if storageDurationSec > 0 {
+		duration = time.Duration(storageDurationSec) * time.Second
+	}
+	if notBeforeSec > 0 && time.Duration(notBeforeSec)*time.Second >= duration {
+		// An embargo outlasting the blob would store something nobody can
+		// ever fetch.
+		os.Remove(dataPath)
+		fmt.Fprintf(os.Stderr, "upload rejected: embargo of %ds ends after the blob expires\n", notBeforeSec)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	blob := &store.StoredBlob{
+		Name:              baseName,
+		PlaintextChecksum: plaintextChecksum,
+		TotalPlainLen:     totalPlainLen,
+		NumChunks:         numChunks,
+		Chunked:           true,
+		KeyVersion:        keyVersion,
+		KeySalt:           kdfSalt,
+		ChunkSums:         chunkSums,
+		MetaFrame:         metaFrame,
+		SignerPub:         signerPub,
+		Signature:         signature,
+		CreatedAt:         createdAt,
+		ExpiresAt:         createdAt.Add(duration),
+	}
+	if notBeforeSec > 0 {
+		blob.NotBefore = createdAt.Add(time.Duration(notBeforeSec) * time.Second)
+	}
+	if password != "" {
+		salt, err := protocol.NewPasswordSalt()
+		if err != nil {
+			os.Remove(dataPath)
+			fmt.Fprintf(os.Stderr, "password salt: %v\n", err)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		blob.PasswordSalt = salt
+		blob.PasswordHash = protocol.HashPassword(password, salt)
+	}
+	// Uploads whose key derives from the code get an owner token, echoed
+	// after the TTL, so the sender can later append under the same code
+	// (append.go). Signed blobs are excluded: appending would invalidate
+	// the signature.
+	var ownerToken []byte
+	if protocol.HeaderHasChunkSums(keyVersion) && keyVersion != protocol.KeyVersionX25519 && signature == nil {
+		if t, err := protocol.NewOwnerToken(); err == nil {
+			ownerToken = t
+			blob.OwnerTokenHash = protocol.HashOwnerToken(t)
+		}
+	}
+	if err := st.Put(code, blob); err != nil {
+		fmt.Fprintf(os.Stderr, "save to disk: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	srvStats.uploads.Add(1)
+	srvStats.bytesIn.Add(int64(plainCount))
+	hookUploadComplete(code, baseName, int64(plainCount), extractIP(conn.RemoteAddr().String()))
+	fmt.Printf("Received: %s (code %s), stored encrypted to disk\n", baseName, code)
+	protocol.SendStatus(conn, protocol.StatusOK)
+	binary.Write(conn, binary.BigEndian, uint32(duration.Seconds()))
+	if ownerToken != nil {
+		conn.Write(ownerToken)
+	}
+	if scanEnabled() {
+		go scanStoredUpload(st, code)
+	}
+}
+
+func handleSecureUpload(conn net.Conn, r io.Reader, st *store.Store, serverID int) {
+	formatByte := make([]byte, 1)
+	if _, err := io.ReadFull(r, formatByte); err != nil {
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	if formatByte[0] == 1 {
+		handleSecureUploadChunked(conn, r, st, serverID)
+		return
+	}
+	var storageDurationSec uint32
+	if err := binary.Read(r, binary.BigEndian, &storageDurationSec); err != nil {
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	if storageDurationSec > 0 {
+		if !serverLongTerm {
+			fmt.Fprintf(os.Stderr, "secure upload rejected: long-term not supported on this server\n")
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+	}
+	maxSize := serverMaxBlobSize.Load()
+	name, plaintextChecksum, nonce, sealed, err := protocol.ReadSecureUpload(r, maxSize)
+	if err != nil {
+		if err == protocol.ErrBlobTooLarge {
+			fmt.Fprintf(os.Stderr, "secure upload rejected: blob exceeds max size %d MB\n", maxSize/(1024*1024))
+			reportReject("size_rejected", "", "exceeds max blob size", extractIP(conn.RemoteAddr().String()))
+		} else if err != io.EOF {
+			fmt.Fprintf(os.Stderr, "read secure upload: %v\n", err)
+		}
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	if storageDurationSec > 0 && int64(len(sealed)+12+32+2+len(name)) > protocol.LongTermMaxBytes {
+		fmt.Fprintf(os.Stderr, "secure upload rejected: long-term max %d MB\n", protocol.LongTermMaxBytes/(1024*1024))
+		reportReject("size_rejected", name, "long-term max exceeded", extractIP(conn.RemoteAddr().String()))
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	baseName := protocol.SanitizeFilename(name)
+	if err := checkUploadPolicy(baseName); err != nil {
+		fmt.Fprintf(os.Stderr, "secure upload rejected by policy: %v\n", err)
+		reportReject("policy_rejected", baseName, err.Error(), extractIP(conn.RemoteAddr().String()))
+		protocol.SendStatus(conn, protocol.StatusPolicyRejected)
+		return
+	}
+	code := protocol.GenerateCodeWithServerID(serverID)
+	createdAt := time.Now()
+	duration := st.TTL()
+	if storageDurationSec > 0 {
+		duration = time.Duration(storageDurationSec) * time.Second
+	}
+	blob := &store.StoredBlob{
+		Name:              baseName,
+		PlaintextChecksum: plaintextChecksum,
+		Nonce:             nonce,
+		Sealed:            sealed,
+		Secure:            true,
+		CreatedAt:         createdAt,
+		ExpiresAt:         createdAt.Add(duration),
+	}
+	release, err := uploadLedger.reserve(reservedUploadBytes(uint64(len(sealed)), 0), st.DataDir())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "secure upload rejected: %v\n", err)
+		reportReject("size_rejected", baseName, "insufficient disk space", extractIP(conn.RemoteAddr().String()))
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	defer release()
+	if err := st.Put(code, blob); err != nil {
+		fmt.Fprintf(os.Stderr, "save secure blob: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	srvStats.uploads.Add(1)
+	srvStats.bytesIn.Add(int64(len(sealed)))
+	hookUploadComplete(code, baseName, int64(len(sealed)), extractIP(conn.RemoteAddr().String()))
+	fmt.Printf("Secure upload: %s (code %s)\n", baseName, code)
+	if err := protocol.SendCodeResponse(conn, protocol.StatusOK, code); err != nil {
+		return
+	}
+	binary.Write(conn, binary.BigEndian, uint32(duration.Seconds()))
+}
+
+func handleSecureUploadChunked(conn net.Conn, r io.Reader, st *store.Store, serverID int) {
+	name, totalPlainLen, storageDurationSec, numChunks, plaintextChecksum, err := protocol.ReadSecureUploadChunkedHeader(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read secure chunked header: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	if storageDurationSec > 0 {
+		if !serverLongTerm {
+			fmt.Fprintf(os.Stderr, "secure chunked upload rejected: long-term not supported on this server\n")
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		if int64(totalPlainLen) > protocol.LongTermMaxBytes {
+			fmt.Fprintf(os.Stderr, "secure chunked upload rejected: long-term max %d MB\n", protocol.LongTermMaxBytes/(1024*1024))
+			reportReject("size_rejected", name, "long-term max exceeded", extractIP(conn.RemoteAddr().String()))
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+	}
+	if maxSize := serverMaxBlobSize.Load(); maxSize > 0 && int64(totalPlainLen) > maxSize {
+		fmt.Fprintf(os.Stderr, "secure chunked upload rejected: exceeds max size %d MB\n", maxSize/(1024*1024))
+		reportReject("size_rejected", name, "exceeds max blob size", extractIP(conn.RemoteAddr().String()))
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	baseName := protocol.SanitizeFilename(name)
+	if err := checkUploadPolicy(baseName); err != nil {
+		fmt.Fprintf(os.Stderr, "secure chunked upload rejected by policy: %v\n", err)
+		reportReject("policy_rejected", baseName, err.Error(), extractIP(conn.RemoteAddr().String()))
+		protocol.SendStatus(conn, protocol.StatusPolicyRejected)
+		return
+	}
+	release, err := uploadLedger.reserve(reservedUploadBytes(totalPlainLen, numChunks), st.DataDir())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "secure chunked upload rejected: %v\n", err)
+		reportReject("size_rejected", baseName, "insufficient disk space", extractIP(conn.RemoteAddr().String()))
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	defer release()
+	code := protocol.GenerateCodeWithServerID(serverID)
+	dataPath := st.DataPath(code)
+	tmpPath := st.TempDataPath(code)
+	df, err := os.Create(tmpPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "create data file: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	dw := diskWriter(df)
+	nonce := make([]byte, protocol.NonceSize)
+	var sealed []byte
+	for i := uint32(0); i < numChunks; i++ {
+		var err error
+		sealed, err = protocol.ReadChunkInto(r, nonce, sealed)
+		if err != nil {
+			df.Close()
+			os.Remove(tmpPath)
+			fmt.Fprintf(os.Stderr, "read secure chunk: %v\n", err)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		if _, err := dw.Write(nonce); err != nil {
+			df.Close()
+			os.Remove(tmpPath)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		if err := binary.Write(dw, binary.BigEndian, uint32(len(sealed))); err != nil {
+			df.Close()
+			os.Remove(tmpPath)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+		if _, err := dw.Write(sealed); err != nil {
+			df.Close()
+			os.Remove(tmpPath)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+	}
+	if store.DurableUploads {
+		if err := df.Sync(); err != nil {
+			df.Close()
+			os.Remove(tmpPath)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+	}
+	if err := df.Close(); err != nil {
+		os.Remove(tmpPath)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	if err := os.Rename(tmpPath, dataPath); err != nil {
+		os.Remove(tmpPath)
+		fmt.Fprintf(os.Stderr, "finalize data file: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	if store.DurableUploads {
+		store.SyncDir(st.DataDir())
+	}
+	createdAt := time.Now()
+	duration := st.TTL()
+	if storageDurationSec > 0 {
+		duration = time.Duration(storageDurationSec) * time.Second
+	}
+	blob := &store.StoredBlob{
+		Name:              baseName,
+		PlaintextChecksum: plaintextChecksum,
+		TotalPlainLen:     totalPlainLen,
+		NumChunks:         numChunks,
+		Chunked:           true,
+		Secure:            true,
+		CreatedAt:         createdAt,
+		ExpiresAt:         createdAt.Add(duration),
+	}
+	if err := st.Put(code, blob); err != nil {
+		os.Remove(dataPath)
+		fmt.Fprintf(os.Stderr, "save secure chunked: %v\n", err)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	srvStats.uploads.Add(1)
+	srvStats.bytesIn.Add(int64(totalPlainLen))
+	hookUploadComplete(code, baseName, int64(totalPlainLen), extractIP(conn.RemoteAddr().String()))
+	fmt.Printf("Secure upload (chunked): %s (code %s)\n", baseName, code)
+	if err := protocol.SendCodeResponse(conn, protocol.StatusOK, code); err != nil {
+		return
+	}
+	binary.Write(conn, binary.BigEndian, uint32(duration.Seconds()))
+}
+
+func handleDownload(conn net.Conn, r io.Reader, st *store.Store, withPassword bool) {
+	ip := extractIP(conn.RemoteAddr().String())
+	code, err := protocol.ReadDownloadRequest(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read code: %v\n", err)
+		if err == protocol.ErrMalformedCode {
+			protocol.SendStatus(conn, protocol.StatusMalformedCode)
+		} else {
+			protocol.SendStatus(conn, protocol.StatusError)
+		}
+		return
+	}
+	password := ""
+	if withPassword {
+		password, err = protocol.ReadPasswordFrame(r)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "read password: %v\n", err)
+			protocol.SendStatus(conn, protocol.StatusError)
+			return
+		}
+	}
+
+	blob, ok := st.Get(code)
+	if !ok {
+		protocol.SendStatus(conn, protocol.StatusNotFound)
+		return
+	}
+	if blob.Quarantined {
+		fmt.Fprintf(os.Stderr, "refused quarantined code %s for %s\n", code, ip)
+		protocol.SendStatus(conn, protocol.StatusNotFound)
+		return
+	}
+	if serverBlocklist.blocked(code, blob.PlaintextChecksum) {
+		fmt.Fprintf(os.Stderr, "refused blocklisted code %s for %s\n", code, ip)
+		protocol.SendStatus(conn, protocol.StatusNotFound)
+		return
+	}
+	if blob.RedirectCode != "" {
+		fmt.Printf("info: redirecting code %s to %s\n", code, blob.RedirectCode)
+		if protocol.SendStatus(conn, protocol.StatusRedirect) == nil {
+			protocol.WriteDownloadRequest(conn, blob.RedirectCode)
+		}
+		return
+	}
+	if remaining := time.Until(blob.NotBefore); remaining > 0 {
+		fmt.Fprintf(os.Stderr, "refused embargoed code %s for %s (%s left)\n", code, ip, remaining.Round(time.Second))
+		if protocol.SendStatus(conn, protocol.StatusEmbargoed) == nil {
+			binary.Write(conn, binary.BigEndian, uint32(remaining.Seconds())+1)
+		}
+		return
+	}
+	if blob.PasswordHash != nil {
+		if password == "" {
+			protocol.SendStatus(conn, protocol.StatusPasswordRequired)
+			return
+		}
+		if !protocol.VerifyPassword(password, blob.PasswordSalt, blob.PasswordHash) {
+			// Same response as an unknown code: a wrong password must not
+			// confirm that the code itself exists.
+			fmt.Fprintf(os.Stderr, "wrong download password for code %s from %s\n", code, ip)
+			protocol.SendStatus(conn, protocol.StatusNotFound)
+			return
+		}
+	}
+
+	fmt.Println("info: sending encrypted file for code", code)
+	if err := protocol.SendStatus(conn, protocol.StatusOK); err != nil {
+		return
+	}
+	bw := bufio.NewWriterSize(conn, protocol.BufSize)
+	if err := writeBlobResponse(bw, st, code, blob); err == nil {
+		hookDownload(code, blob.Name, ip)
+	}
+}
+
+// handleDownloadRange serves a contiguous chunk range of a chunked blob, the
+// building block of parallel downloads: each connection of a parallel get
+// requests its own range and the client reassembles locally. Password-
+// protected uploads answer StatusPasswordRequired (the range request carries
+// no password frame) and non-chunked blobs StatusError; the client falls
+// back to a single-stream download on either.
+func handleDownloadRange(conn net.Conn, r io.Reader, st *store.Store) {
+	ip := extractIP(conn.RemoteAddr().String())
+	code, start, count, err := protocol.ReadRangeRequest(r)
+	if err != nil {
+		if err == protocol.ErrMalformedCode {
+			protocol.SendStatus(conn, protocol.StatusMalformedCode)
+		} else {
+			protocol.SendStatus(conn, protocol.StatusError)
+		}
+		return
+	}
+	blob, ok := st.Get(code)
+	if !ok || blob.Quarantined || serverBlocklist.blocked(code, blob.PlaintextChecksum) {
+		protocol.SendStatus(conn, protocol.StatusNotFound)
+		return
+	}
+	if blob.RedirectCode != "" {
+		if protocol.SendStatus(conn, protocol.StatusRedirect) == nil {
+			protocol.WriteDownloadRequest(conn, blob.RedirectCode)
+		}
+		return
+	}
+	if remaining := time.Until(blob.NotBefore); remaining > 0 {
+		if protocol.SendStatus(conn, protocol.StatusEmbargoed) == nil {
+			binary.Write(conn, binary.BigEndian, uint32(remaining.Seconds())+1)
+		}
+		return
+	}
+	if blob.PasswordHash != nil {
+		protocol.SendStatus(conn, protocol.StatusPasswordRequired)
+		return
+	}
+	if !blob.Chunked || start >= blob.NumChunks {
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	if err := protocol.SendStatus(conn, protocol.StatusOK); err != nil {
+		return
+	}
+	bw := bufio.NewWriterSize(conn, protocol.BufSize)
+	if blob.Secure {
+		if _, err := bw.Write([]byte{protocol.FormatSecureChunked}); err != nil {
+			return
+		}
+	} else if err := writeFormatFrame(bw, blob, protocol.FormatChunked, protocol.FormatChunkedV); err != nil {
+		return
+	}
+	if err := sendChunkedRangeFromFile(bw, st.DataPath(code), blob, start, count); err != nil {
+		fmt.Fprintf(os.Stderr, "send range: %v\n", err)
+		return
+	}
+	if err := bw.Flush(); err != nil {
+		return
+	}
+	srvStats.bytesOut.Add(int64(blob.TotalPlainLen) * int64(count) / int64(blob.NumChunks))
+	// One parallel get spans several range connections; count the download
+	// and fire hooks once, on the range that starts the blob.
+	if start == 0 && count > 0 {
+		srvStats.downloads.Add(1)
+		hookDownload(code, blob.Name, ip)
+		fmt.Printf("Sent (range): %s (code %s)\n", blob.Name, code)
+	}
+}
+
+// sendSealedBlob writes a non-chunked blob body, streaming the sealed payload
+// from the .dat file when put spilled it there instead of loading it into RAM.
+func sendSealedBlob(w io.Writer, st *store.Store, code string, blob *store.StoredBlob) error {
+	if !blob.SealedInFile {
+		return protocol.WriteEncryptedBlob(w, blob.Name, blob.PlaintextChecksum, blob.Nonce, blob.Sealed, nil)
+	}
+	if err := protocol.WriteEncryptedBlobHeader(w, blob.Name, blob.PlaintextChecksum, blob.Nonce, blob.SealedLen); err != nil {
+		return err
+	}
+	df, err := os.Open(st.DataPath(code))
+	if err != nil {
+		return err
+	}
+	defer df.Close()
+	n, err := io.Copy(w, diskReader(df))
+	if err != nil {
+		return err
+	}
+	if uint64(n) != blob.SealedLen {
+		return fmt.Errorf("sealed payload truncated: have %d, want %d", n, blob.SealedLen)
+	}
+	return nil
+}
+
+// writeBlobResponse writes the download body (format byte, header, chunks)
+// for a blob to bw and flushes it. Shared by the plain download handler and
+// the PAKE session channel.
+// writeFormatFrame writes the download format byte and, for non-legacy KDFs,
+// the versioned key frame (key version, salt, signature frame) so the client
+// knows how to derive the key; legacy blobs keep formats 0/1.
+func writeFormatFrame(bw *bufio.Writer, blob *store.StoredBlob, plain, versioned byte) error {
+	if blob.KeyVersion == protocol.KeyVersionSHA256 {
+		_, err := bw.Write([]byte{plain})
+		return err
+	}
+	if _, err := bw.Write([]byte{versioned, blob.KeyVersion}); err != nil {
+		return err
+	}
+	if len(blob.KeySalt) > 0 {
+		if _, err := bw.Write(blob.KeySalt); err != nil {
+			return err
+		}
+	}
+	if protocol.HeaderHasSignFrame(blob.KeyVersion) {
+		if err := protocol.WriteSignatureFrame(bw, blob.SignerPub, blob.Signature); err != nil {
+			return err
+		}
+	}
+	if protocol.HeaderHasMetaFrame(blob.KeyVersion) {
+		if err := protocol.WriteRawMetaFrame(bw, blob.MetaFrame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeBlobResponse(bw *bufio.Writer, st *store.Store, code string, blob *store.StoredBlob) error {
+	writeFormat := func(plain, versioned byte) error {
+		return writeFormatFrame(bw, blob, plain, versioned)
+	}
+	if blob.Secure && blob.Chunked {
+		if _, err := bw.Write([]byte{protocol.FormatSecureChunked}); err != nil {
+			return err
+		}
+		if err := sendChunkedFromFile(bw, st.DataPath(code), blob); err != nil {
+			fmt.Fprintf(os.Stderr, "send secure chunked: %v\n", err)
+			return err
+		}
+	} else if blob.Secure {
+		if _, err := bw.Write([]byte{protocol.FormatSecure}); err != nil {
+			return err
+		}
+		if err := sendSealedBlob(bw, st, code, blob); err != nil {
+			fmt.Fprintf(os.Stderr, "send secure: %v\n", err)
+			return err
+		}
+	} else if blob.Chunked {
+		if err := writeFormat(protocol.FormatChunked, protocol.FormatChunkedV); err != nil {
+			return err
+		}
+		if err := sendChunkedFromFile(bw, st.DataPath(code), blob); err != nil {
+			fmt.Fprintf(os.Stderr, "send (stream): %v\n", err)
+			return err
+		}
+	} else if blob.Chunks != nil {
+		if err := writeFormat(protocol.FormatChunked, protocol.FormatChunkedV); err != nil {
+			return err
+		}
+		if err := protocol.WriteEncryptedBlobChunked(bw, blob.Name, blob.PlaintextChecksum, blob.Chunks); err != nil {
+			fmt.Fprintf(os.Stderr, "send: %v\n", err)
+			return err
+		}
+	} else {
+		if err := writeFormat(protocol.FormatPlain, protocol.FormatPlainV); err != nil {
+			return err
+		}
+		if err := sendSealedBlob(bw, st, code, blob); err != nil {
+			fmt.Fprintf(os.Stderr, "send: %v\n", err)
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	srvStats.downloads.Add(1)
+	if blob.Chunked || blob.Chunks != nil {
+		srvStats.bytesOut.Add(int64(blob.TotalPlainLen))
+	} else if blob.SealedInFile {
+		srvStats.bytesOut.Add(int64(blob.SealedLen))
+	} else {
+		srvStats.bytesOut.Add(int64(len(blob.Sealed)))
+	}
+	fmt.Printf("Sent: %s (code %s)\n", blob.Name, code)
+	return nil
+}
+
+const webPageHTML = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Download by code</title>
+  <style>
+    body { font-family: sans-serif; max-width: 360px; margin: 60px auto; padding: 20px; }
+    h1 { font-size: 1.3em; }
+    input[type="text"] { width: 100%; padding: 12px; font-size: 1.2em; letter-spacing: 0.2em; text-align: center; box-sizing: border-box; }
+    button { width: 100%; margin-top: 12px; padding: 12px; font-size: 1em; cursor: pointer; }
+    .error { color: #c00; margin-top: 12px; }
+    .hint { color: #666; font-size: 0.9em; margin-top: 8px; }
+  </style>
+</head>
+<body>
+  <h1>Download file</h1>
+  <p class="hint">Enter the 6-digit code you received.</p>
+  <form action="/get" method="GET">
+    <input type="text" name="code" placeholder="000000" maxlength="6" pattern="[0-9]{6}" required autofocus>
+    <input type="password" name="pw" placeholder="password (if set by sender)" style="margin-top:8px; letter-spacing:normal; font-size:1em;">
+    <button type="submit">Download</button>
+  </form>
+  <p id="err" class="error"></p>
+  <script>
+    var params = new URLSearchParams(location.search);
+    if (params.get('err')) document.getElementById('err').textContent = params.get('err');
+  </script>
+</body>
+</html>
+`
+
+// webDownload validates a code and streams the decrypted file to w. Both
+// web entry points go through it: the form handler turns failures into
+// redirects back to the page, /d/<code> into plain HTTP errors. With
+// headOnly (a HEAD request) it stops after the headers, so download
+// managers and link previewers get size, filename and expiry without the
+// server decrypting a byte.
+func webDownload(w http.ResponseWriter, st *store.Store, code, pw string, headOnly bool, fail func(status int, msg string)) {
+	code = strings.TrimSpace(code)
+	if !protocol.ValidCode(code) {
+		fail(http.StatusBadRequest, "Invalid code (must be 6 digits)")
+		return
+	}
+	blob, ok := st.Get(code)
+	if !ok {
+		// A gateway answers for the whole network: route codes we do not
+		// hold to their owning server instead of a dead end. Quarantined
+		// and blocklisted codes never take this path.
+		if GatewayMode {
+			// Also on HEAD: existence is only knowable by asking the
+			// owning server, and net/http drops the body for us.
+			gatewayDownload(w, code, fail)
+			return
+		}
+		fail(http.StatusNotFound, "Code not found or expired")
+		return
+	}
+	if blob.Quarantined || serverBlocklist.blocked(code, blob.PlaintextChecksum) {
+		fail(http.StatusNotFound, "Code not found or expired")
+		return
+	}
+	if blob.Secure {
+		fail(http.StatusForbidden, "Secure upload. Use tcpraw get with your key to download.")
+		return
+	}
+	if remaining := time.Until(blob.NotBefore); remaining > 0 {
+		fail(http.StatusForbidden, fmt.Sprintf("Timed release: available in %s", remaining.Round(time.Second)))
+		return
+	}
+	if blob.PasswordHash != nil {
+		if pw == "" {
+			fail(http.StatusUnauthorized, "This code requires a password")
+			return
+		}
+		if !protocol.VerifyPassword(pw, blob.PasswordSalt, blob.PasswordHash) {
+			fail(http.StatusForbidden, "Wrong password")
+			return
+		}
+	}
+	webKey, err := protocol.DeriveTransferKey(code, blob.KeyVersion, blob.KeySalt)
+	if err != nil {
+		fail(http.StatusInternalServerError, "Decrypt failed")
+		return
+	}
+	safeName := protocol.SanitizeFilename(blob.Name)
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+safeName+"\"")
+	w.Header().Set("Content-Type", "application/octet-stream")
+	// Codes are single-use-ish and expire; a cached copy outliving the blob
+	// only confuses proxies and previewers.
+	w.Header().Set("Cache-Control", "no-store")
+	if expiry := st.ExpiryOf(blob); time.Until(expiry) > 0 {
+		w.Header().Set("X-Tcpraw-Expires-In", fmt.Sprintf("%d", int64(time.Until(expiry).Seconds())))
+		w.Header().Set("Expires", expiry.UTC().Format(http.TimeFormat))
+	}
+	// Legacy index entries may predate TotalPlainLen; advertise the size
+	// only when it is actually recorded.
+	if blob.TotalPlainLen > 0 {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", blob.TotalPlainLen))
+	}
+	if headOnly {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if blob.Chunked {
+		df, err := os.Open(st.DataPath(code))
+		if err != nil {
+			fail(http.StatusInternalServerError, "Decrypt failed")
+			return
+		}
+		defer df.Close()
+		dr := diskReader(df)
+		for i := uint32(0); i < blob.NumChunks; i++ {
+			var nonce [12]byte
+			if _, err := io.ReadFull(dr, nonce[:]); err != nil {
+				fail(http.StatusInternalServerError, "Decrypt failed")
+				return
+			}
+			var sealedLen uint32
+			if err := binary.Read(dr, binary.BigEndian, &sealedLen); err != nil {
+				fail(http.StatusInternalServerError, "Decrypt failed")
+				return
+			}
+			sealed := getChunkBuf(sealedLen)
+			if _, err := io.ReadFull(dr, sealed); err != nil {
+				putChunkBuf(sealed)
+				fail(http.StatusInternalServerError, "Decrypt failed")
+				return
+			}
+			var pt []byte
+			if protocol.ChunkStreamAAD(blob.KeyVersion) {
+				pt, err = protocol.DecryptChunkStream(webKey, uint64(i), i == blob.NumChunks-1, nonce[:], sealed)
+			} else {
+				pt, err = protocol.DecryptWithKey(webKey, nonce[:], sealed)
+			}
+			putChunkBuf(sealed)
+			if err != nil {
+				fail(http.StatusInternalServerError, "Decrypt failed")
+				return
+			}
+			if _, err := w.Write(pt); err != nil {
+				return
+			}
+		}
+		return
+	}
+	var plaintext []byte
+	if blob.Chunks != nil {
+		for i, c := range blob.Chunks {
+			var pt []byte
+			var err error
+			if protocol.ChunkStreamAAD(blob.KeyVersion) {
+				pt, err = protocol.DecryptChunkStream(webKey, uint64(i), i == len(blob.Chunks)-1, c.Nonce[:], c.Sealed)
+			} else {
+				pt, err = protocol.DecryptWithKey(webKey, c.Nonce[:], c.Sealed)
+			}
+			if err != nil {
+				fail(http.StatusInternalServerError, "Decrypt failed")
+				return
+			}
+			plaintext = append(plaintext, pt...)
+		}
+	} else {
+		sealed, err := st.LoadSealed(code, blob)
+		if err != nil {
+			fail(http.StatusInternalServerError, "Decrypt failed")
+			return
+		}
+		plaintext, err = protocol.DecryptWithKey(webKey, blob.Nonce, sealed)
+		if err != nil {
+			fail(http.StatusInternalServerError, "Decrypt failed")
+			return
+		}
+	}
+	w.Write(plaintext)
+}
+
+func RunWebServer(port string, st *store.Store, rl *rateLimiter, serverID int) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(webPageHTML))
+	})
+	mux.HandleFunc("/get", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "use GET or HEAD", http.StatusMethodNotAllowed)
+			return
+		}
+		// The redirect-with-?err= dance exists for the HTML form; anything
+		// else (HEAD probes, curl, download managers) gets the real status
+		// code so failures are machine-readable.
+		headOnly := r.Method == http.MethodHead
+		wantsHTML := !headOnly && strings.Contains(r.Header.Get("Accept"), "text/html")
+		fail := func(status int, msg string) {
+			if wantsHTML {
+				http.Redirect(w, r, "/?err="+url.QueryEscape(msg), http.StatusFound)
+				return
+			}
+			http.Error(w, msg, status)
+		}
+		ip := extractIP(r.RemoteAddr)
+		if !rl.allow("web", ip) {
+			fail(http.StatusTooManyRequests, "Too many attempts. Try again later.")
+			return
+		}
+		code := strings.TrimSpace(r.URL.Query().Get("code"))
+		webDownload(w, st, code, r.URL.Query().Get("pw"), headOnly, fail)
+	})
+	// Short direct links: /d/<code> streams the file straight away, so a
+	// shared link works from wget or curl without the HTML form redirect
+	// dance. Same rate limiting and restrictions as /get; a password, when
+	// required, is taken from ?pw=.
+	mux.HandleFunc("/d/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "use GET or HEAD", http.StatusMethodNotAllowed)
+			return
+		}
+		ip := extractIP(r.RemoteAddr)
+		if !rl.allow("web", ip) {
+			http.Error(w, "too many attempts, try again later", http.StatusTooManyRequests)
+			return
+		}
+		code := strings.TrimPrefix(r.URL.Path, "/d/")
+		webDownload(w, st, code, r.URL.Query().Get("pw"), r.Method == http.MethodHead, func(status int, msg string) {
+			http.Error(w, msg, status)
+		})
+	})
+	mux.HandleFunc("/upload", handleWebUpload(st, serverID))
+	mux.HandleFunc("/upload/", handleWebUpload(st, serverID))
+	mux.HandleFunc("/upload/resumable", handleResumableCreate(st, rl, serverID))
+	mux.HandleFunc("/upload/resumable/", handleResumableSession(st))
+	mux.HandleFunc("/report", handleReport(st, rl))
+	mux.HandleFunc("/admin", requireAdmin(handleAdminDashboard(st, rl)))
+	mux.HandleFunc("/admin/delete", requireAdmin(handleAdminDelete(st)))
+	mux.HandleFunc("/admin/block", requireAdmin(handleAdminBlock(false)))
+	mux.HandleFunc("/admin/unblock", requireAdmin(handleAdminBlock(true)))
+	mux.HandleFunc("/admin/pin", requireAdmin(handleAdminPin(st)))
+	mux.HandleFunc("/admin/unpin", requireAdmin(handleAdminUnpin(st)))
+	mux.HandleFunc("/admin/pins", requireAdmin(handleAdminPins(st)))
+	mux.HandleFunc("/admin/migrate", requireAdmin(handleAdminMigrate(st)))
+	mux.HandleFunc("/admin/stats", requireAdmin(handleAdminStats(st)))
+	mux.HandleFunc("/admin/cleanup", requireAdmin(handleAdminCleanup(st)))
+	mux.HandleFunc("/admin/reload", requireAdmin(handleAdminReload(st)))
+	mux.HandleFunc("/admin/ban", requireAdmin(handleAdminBan(rl)))
+	mux.HandleFunc("/admin/unban", requireAdmin(handleAdminUnban(rl)))
+	mux.HandleFunc("/admin/bans", requireAdmin(handleAdminBans(rl)))
+	go watchResumableSessions()
+	addr := ":" + port
+	fmt.Fprintf(os.Stderr, "web server listen %s: %v\n", addr, http.ListenAndServe(addr, mux))
+}
+
+// handleDownloadPake runs the server side of a PAKE download: tag lookup,
+// SPAKE2 handshake, mutual confirmation, then the normal download body over
+// the encrypted channel.
+func handleDownloadPake(conn net.Conn, r io.Reader, st *store.Store) {
+	ip := extractIP(conn.RemoteAddr().String())
+	tag := make([]byte, protocol.PakeTagSize)
+	if _, err := io.ReadFull(r, tag); err != nil {
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	xMsg := make([]byte, protocol.PakePointSize)
+	if _, err := io.ReadFull(r, xMsg); err != nil {
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	code, blob, ok := st.FindByPakeTag(tag)
+	if !ok {
+		protocol.SendStatus(conn, protocol.StatusNotFound)
+		return
+	}
+	if blob.Quarantined || serverBlocklist.blocked(code, blob.PlaintextChecksum) {
+		fmt.Fprintf(os.Stderr, "refused code %s for %s (pake)\n", code, ip)
+		protocol.SendStatus(conn, protocol.StatusNotFound)
+		return
+	}
+	if blob.PasswordHash != nil {
+		// Password frames are not part of the PAKE handshake.
+		protocol.SendStatus(conn, protocol.StatusPasswordRequired)
+		return
+	}
+	// Same redirect and timed-release gates as every other retrieval path;
+	// a PAKE fetch must not open an embargo early.
+	if blob.RedirectCode != "" {
+		fmt.Printf("info: redirecting code %s to %s (pake)\n", code, blob.RedirectCode)
+		if protocol.SendStatus(conn, protocol.StatusRedirect) == nil {
+			protocol.WriteDownloadRequest(conn, blob.RedirectCode)
+		}
+		return
+	}
+	if remaining := time.Until(blob.NotBefore); remaining > 0 {
+		fmt.Fprintf(os.Stderr, "refused embargoed code %s for %s (%s left, pake)\n", code, ip, remaining.Round(time.Second))
+		if protocol.SendStatus(conn, protocol.StatusEmbargoed) == nil {
+			binary.Write(conn, binary.BigEndian, uint32(remaining.Seconds())+1)
+		}
+		return
+	}
+	px, py := elliptic.Unmarshal(protocol.PakeCurve, xMsg)
+	if px == nil {
+		fmt.Fprintf(os.Stderr, "pake: invalid client point from %s\n", ip)
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	wRaw, w := protocol.PakeScalar(code)
+	yScalar := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, yScalar); err != nil {
+		protocol.SendStatus(conn, protocol.StatusError)
+		return
+	}
+	yx, yy := protocol.PakeBlind(yScalar, w, protocol.PakeNx, protocol.PakeNy)
+	yMsg := elliptic.Marshal(protocol.PakeCurve, yx, yy)
+	kx, ky := protocol.PakeUnblind(px, py, w, protocol.PakeMx, protocol.PakeMy, yScalar)
+	kMsg := elliptic.Marshal(protocol.PakeCurve, kx, ky)
+	base := protocol.PakeSessionKey(tag, wRaw, xMsg, yMsg, kMsg)
+	if err := protocol.SendStatus(conn, protocol.StatusOK); err != nil {
+		return
+	}
+	if _, err := conn.Write(yMsg); err != nil {
+		return
+	}
+	if _, err := conn.Write(protocol.PakeSubKey(base, "server-confirm")); err != nil {
+		return
+	}
+	// The client confirmation proves it knows the code before any data flows.
+	confirm := make([]byte, protocol.PakeConfirmSize)
+	if _, err := io.ReadFull(r, confirm); err != nil {
+		return
+	}
+	if !hmac.Equal(confirm, protocol.PakeSubKey(base, "client-confirm")) {
+		fmt.Fprintf(os.Stderr, "pake: bad confirmation for code %s from %s\n", code, ip)
+		return
+	}
+	fmt.Println("info: sending encrypted file for code", code, "(pake)")
+	ch := protocol.NewPakeChannel(struct {
+		io.Reader
+		io.Writer
+	}{r, conn}, base, false)
+	bw := bufio.NewWriterSize(ch, protocol.BufSize)
+	if err := writeBlobResponse(bw, st, code, blob); err != nil {
+		fmt.Fprintf(os.Stderr, "pake send: %v\n", err)
+	} else {
+		hookDownload(code, blob.Name, ip)
+	}
+}
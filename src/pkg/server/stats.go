@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"tcpraw/pkg/protocol"
+	"tcpraw/pkg/store"
+)
+
+// StatsInterval is how often the stats line is logged; set from -stats.
+var StatsInterval = 10 * time.Minute
+
+// Running counters for the periodic stats line and /admin/stats. Updated from
+// the handlers with atomics; throughput is reported as a delta since the
+// previous report.
+var srvStats struct {
+	startTime   time.Time
+	activeConns atomic.Int64
+	uploads     atomic.Int64
+	downloads   atomic.Int64
+	bytesIn     atomic.Int64
+	bytesOut    atomic.Int64
+	rateLimited atomic.Int64
+	bans        atomic.Int64
+
+	lastBytesIn  int64
+	lastBytesOut int64
+	lastReport   time.Time
+}
+
+// statsLine renders the compact one-line report. sinceLast controls whether
+// throughput deltas are consumed (periodic log) or totals shown (admin API).
+func statsLine(st *store.Store) string {
+	now := time.Now()
+	uptime := now.Sub(srvStats.startTime).Round(time.Second)
+	count, bytes := st.Usage()
+	in := srvStats.bytesIn.Load()
+	out := srvStats.bytesOut.Load()
+	deltaIn := in - srvStats.lastBytesIn
+	deltaOut := out - srvStats.lastBytesOut
+	interval := now.Sub(srvStats.lastReport)
+	srvStats.lastBytesIn = in
+	srvStats.lastBytesOut = out
+	srvStats.lastReport = now
+	var inRate, outRate float64
+	if s := interval.Seconds(); s > 0 {
+		inRate = float64(deltaIn) / s
+		outRate = float64(deltaOut) / s
+	}
+	return fmt.Sprintf("stats: uptime=%v blobs=%d stored=%s conns=%d uploads=%d downloads=%d in=%s/s out=%s/s ratelimited=%d bans=%d",
+		uptime, count, protocol.FormatBytes(float64(bytes)), srvStats.activeConns.Load(),
+		srvStats.uploads.Load(), srvStats.downloads.Load(),
+		protocol.FormatBytes(inRate), protocol.FormatBytes(outRate),
+		srvStats.rateLimited.Load(), srvStats.bans.Load())
+}
+
+// startStatsReporter logs a stats line every interval; 0 disables it.
+func startStatsReporter(st *store.Store, interval time.Duration) {
+	srvStats.startTime = time.Now()
+	srvStats.lastReport = srvStats.startTime
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+		for range tick.C {
+			fmt.Println(statsLine(st))
+		}
+	}()
+}
+
+func handleAdminStats(st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, statsLine(st))
+		fmt.Fprintln(w, st.Report())
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+)
+
+// Opt-in anonymous usage metrics (-telemetry <url>). Disabled unless the
+// operator sets the endpoint explicitly. A report carries only coarse
+// counters — transfer counts collapsed into decade buckets, OS/arch,
+// version and uptime — so the maintainers of the public server list can
+// plan capacity. Filenames, codes, peer addresses and exact counts are
+// never sent.
+
+// TelemetryURL is the report endpoint; set from -telemetry, empty = off.
+var TelemetryURL string
+
+// TelemetryInterval is how often a report is posted.
+var TelemetryInterval = 6 * time.Hour
+
+type telemetryReport struct {
+	Version   string `json:"version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	Uploads   string `json:"uploads"`   // decade bucket, e.g. "10-99"
+	Downloads string `json:"downloads"` // decade bucket
+	UptimeH   int64  `json:"uptime_hours"`
+}
+
+// countBucket collapses a counter into a decade bucket, so a report can
+// never be narrowed down to an individual transfer.
+func countBucket(n int64) string {
+	switch {
+	case n <= 0:
+		return "0"
+	case n < 10:
+		return "1-9"
+	case n < 100:
+		return "10-99"
+	case n < 1000:
+		return "100-999"
+	case n < 10000:
+		return "1000-9999"
+	default:
+		return "10000+"
+	}
+}
+
+// startTelemetry posts a report shortly after start and then every
+// TelemetryInterval. Delivery is best-effort and never affects serving.
+func startTelemetry() {
+	if TelemetryURL == "" {
+		return
+	}
+	fmt.Printf("tcpraw server: telemetry enabled, posting coarse counters to %s\n", TelemetryURL)
+	go func() {
+		tick := time.NewTicker(TelemetryInterval)
+		defer tick.Stop()
+		for {
+			sendTelemetry()
+			<-tick.C
+		}
+	}()
+}
+
+func sendTelemetry() {
+	rep := telemetryReport{
+		Version:   Version,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Uploads:   countBucket(srvStats.uploads.Load()),
+		Downloads: countBucket(srvStats.downloads.Load()),
+		UptimeH:   int64(time.Since(srvStats.startTime).Hours()),
+	}
+	body, err := json.Marshal(rep)
+	if err != nil {
+		return
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(TelemetryURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "telemetry: %v\n", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		fmt.Fprintf(os.Stderr, "telemetry: %s returned %s\n", TelemetryURL, resp.Status)
+	}
+}
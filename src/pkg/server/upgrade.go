@@ -0,0 +1,79 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// Zero-downtime binary upgrade. SIGUSR2 re-execs the server binary at its
+// current path (typically just replaced by a deploy) with the listening
+// socket passed as an inherited file descriptor; the new process accepts on
+// the same socket immediately while the old one stops accepting and drains
+// its in-flight transfers before exiting. Servers in -shared mode have a
+// second option: start the new binary alongside the old one and stop the old
+// one, with SO_REUSEPORT keeping the port served throughout.
+
+// upgradeFdEnv tells a child process which inherited fd carries the listener.
+const upgradeFdEnv = "TCPRAW_UPGRADE_FD"
+
+// inheritedListener returns the listener handed over by the previous binary,
+// or nil when starting fresh.
+func inheritedListener() net.Listener {
+	v := os.Getenv(upgradeFdEnv)
+	if v == "" {
+		return nil
+	}
+	os.Unsetenv(upgradeFdEnv)
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return nil
+	}
+	f := os.NewFile(uintptr(fd), "upgrade-listener")
+	if f == nil {
+		return nil
+	}
+	ln, err := net.FileListener(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "inherit listener: %v\n", err)
+		return nil
+	}
+	return ln
+}
+
+// startUpgrade hands rawLn (the TCP listener, before any TLS wrapping) to a
+// freshly exec'd copy of the binary as fd 3, then closes it here so the
+// accept loop stops; Serve drains the running handlers and returns.
+func startUpgrade(rawLn net.Listener) {
+	tl, ok := rawLn.(*net.TCPListener)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "upgrade: listener cannot be handed over")
+		return
+	}
+	f, err := tl.File()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "upgrade: dup listener: %v\n", err)
+		return
+	}
+	defer f.Close()
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "upgrade: %v\n", err)
+		return
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{f} // becomes fd 3 in the child
+	cmd.Env = append(os.Environ(), upgradeFdEnv+"=3")
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "upgrade: start %s: %v\n", exe, err)
+		return
+	}
+	fmt.Printf("tcpraw server: upgrade: new binary running as pid %d; draining and exiting\n", cmd.Process.Pid)
+	rawLn.Close()
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package server
+
+import "net"
+
+// watchUpgradeSignal does nothing here: the platform has neither SIGUSR2 nor
+// listener fd inheritance.
+func watchUpgradeSignal(rawLn net.Listener, done chan struct{}) {}
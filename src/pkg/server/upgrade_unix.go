@@ -0,0 +1,25 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package server
+
+import (
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchUpgradeSignal starts the binary handover on SIGUSR2.
+func watchUpgradeSignal(rawLn net.Listener, done chan struct{}) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(ch)
+		select {
+		case <-ch:
+			startUpgrade(rawLn)
+		case <-done:
+		}
+	}()
+}
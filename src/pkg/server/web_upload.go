@@ -0,0 +1,210 @@
+package server
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"tcpraw/pkg/protocol"
+	"tcpraw/pkg/store"
+)
+
+// handleWebUpload accepts curl-style uploads on the web port:
+//
+//	curl -T backup.tgz http://server:8080/upload
+//
+// The body arrives as plaintext; the server generates a code, derives the
+// same code-based key a `tcpraw send` client would and encrypts chunk by
+// chunk before anything touches disk, so the result is downloadable with
+// `tcpraw get <code>` or the web page like any other upload. The response is
+// the bare code as text, or JSON with ?format=json / Accept:
+// application/json.
+func handleWebUpload(st *store.Store, serverID int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut && r.Method != http.MethodPost {
+			http.Error(w, "use PUT or POST with the file as the request body", http.StatusMethodNotAllowed)
+			return
+		}
+		ip := extractIP(r.RemoteAddr)
+		name := path.Base(r.URL.Path)
+		if name == "upload" || name == "/" || name == "." {
+			name = r.URL.Query().Get("name")
+		}
+		if name == "" {
+			name = "upload.bin"
+		}
+		baseName := protocol.SanitizeFilename(name)
+		if err := checkUploadPolicy(baseName); err != nil {
+			reportReject("policy_rejected", baseName, err.Error(), ip)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		declared := r.ContentLength
+		if maxSize := serverMaxBlobSize.Load(); maxSize > 0 && declared > maxSize {
+			reportReject("size_rejected", baseName, "exceeds max blob size", ip)
+			http.Error(w, "file exceeds the server's max upload size", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if declared < 0 {
+			declared = 0
+		}
+		release, err := uploadLedger.reserve(reservedUploadBytes(uint64(declared), 0), st.DataDir())
+		if err != nil {
+			reportReject("size_rejected", baseName, "insufficient disk space", ip)
+			http.Error(w, "insufficient disk space", http.StatusInsufficientStorage)
+			return
+		}
+		defer release()
+
+		code := protocol.GenerateCodeWithServerID(serverID)
+		keyVersion := protocol.CurrentKeyVersion
+		salt := make([]byte, protocol.HeaderSaltSize(keyVersion))
+		if _, err := rand.Read(salt); err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		key, err := protocol.DeriveTransferKey(code, keyVersion, salt)
+		if err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		hasher := protocol.NewIntegrityHasher(key, keyVersion)
+
+		tmpPath := st.TempDataPath(code)
+		df, err := os.Create(tmpPath)
+		if err != nil {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		dw := diskWriter(df)
+		fail := func(status int, msg string) {
+			df.Close()
+			os.Remove(tmpPath)
+			http.Error(w, msg, status)
+		}
+
+		// One-chunk lookahead so the last chunk gets the final-flag AAD; an
+		// empty body still produces one empty final chunk.
+		br := bufio.NewReaderSize(r.Body, protocol.BufSize)
+		var numChunks uint32
+		var total uint64
+		// The key version promises per-chunk digests after the header, so
+		// the web path has to produce them like any tcp sender would.
+		var chunkSums []byte
+		withSums := protocol.HeaderHasChunkSums(keyVersion)
+		buf := make([]byte, protocol.FileChunkSize)
+		for {
+			n, readErr := io.ReadFull(br, buf)
+			if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+				fail(http.StatusBadRequest, "read body: "+readErr.Error())
+				return
+			}
+			final := readErr != nil
+			if !final {
+				if _, err := br.Peek(1); err != nil {
+					final = true
+				}
+			}
+			if numChunks > 0 && n == 0 && final {
+				break
+			}
+			plain := buf[:n]
+			hasher.Write(plain)
+			if withSums {
+				chunkSums = append(chunkSums, protocol.ChunkSum(key, uint64(numChunks), plain)...)
+			}
+			total += uint64(n)
+			if maxSize := serverMaxBlobSize.Load(); maxSize > 0 && int64(total) > maxSize {
+				reportReject("size_rejected", baseName, "exceeds max blob size", ip)
+				fail(http.StatusRequestEntityTooLarge, "file exceeds the server's max upload size")
+				return
+			}
+			nonce, sealed, err := protocol.EncryptChunkStream(key, uint64(numChunks), final, plain)
+			if err != nil {
+				fail(http.StatusInternalServerError, "server error")
+				return
+			}
+			var header [16]byte
+			copy(header[:12], nonce)
+			binary.BigEndian.PutUint32(header[12:16], uint32(len(sealed)))
+			if _, err := dw.Write(header[:]); err != nil {
+				fail(http.StatusInternalServerError, "server error")
+				return
+			}
+			if _, err := dw.Write(sealed); err != nil {
+				fail(http.StatusInternalServerError, "server error")
+				return
+			}
+			numChunks++
+			if final {
+				break
+			}
+		}
+		if store.DurableUploads {
+			if err := df.Sync(); err != nil {
+				fail(http.StatusInternalServerError, "server error")
+				return
+			}
+		}
+		if err := df.Close(); err != nil {
+			os.Remove(tmpPath)
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		if err := os.Rename(tmpPath, st.DataPath(code)); err != nil {
+			os.Remove(tmpPath)
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		if store.DurableUploads {
+			store.SyncDir(st.DataDir())
+		}
+
+		createdAt := time.Now()
+		duration := st.TTL()
+		blob := &store.StoredBlob{
+			Name:              baseName,
+			PlaintextChecksum: hasher.Sum(nil),
+			TotalPlainLen:     total,
+			NumChunks:         numChunks,
+			ChunkSums:         chunkSums,
+			Chunked:           true,
+			KeyVersion:        keyVersion,
+			KeySalt:           salt,
+			CreatedAt:         createdAt,
+			ExpiresAt:         createdAt.Add(duration),
+		}
+		if err := st.Put(code, blob); err != nil {
+			os.Remove(st.DataPath(code))
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		srvStats.uploads.Add(1)
+		srvStats.bytesIn.Add(int64(total))
+		hookUploadComplete(code, baseName, int64(total), ip)
+		fmt.Printf("Received via web: %s (code %s), stored encrypted to disk\n", baseName, code)
+		if scanEnabled() {
+			go scanStoredUpload(st, code)
+		}
+
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(struct {
+				Code      string `json:"code"`
+				Name      string `json:"name"`
+				Bytes     uint64 `json:"bytes"`
+				ExpiresIn int64  `json:"expires_in_sec"`
+			}{code, baseName, total, int64(duration.Seconds())})
+			return
+		}
+		fmt.Fprintln(w, code)
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// WebhookURL receives a JSON POST for abuse-relevant events (IP bans, size
+// and policy rejections) so operators can feed alerting pipelines; set from
+// the server -webhook flag, empty = disabled.
+var WebhookURL string
+
+const webhookTimeout = 10 * time.Second
+
+type webhookEvent struct {
+	Event  string `json:"event"` // "ban", "size_rejected", "policy_rejected"
+	Time   string `json:"time"`
+	IP     string `json:"ip,omitempty"`
+	Code   string `json:"code,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// notifyWebhook posts the event in the background; delivery is best-effort
+// and never blocks or fails the triggering request.
+func notifyWebhook(ev webhookEvent) {
+	if WebhookURL == "" {
+		return
+	}
+	ev.Time = time.Now().Format(time.RFC3339)
+	go func() {
+		body, err := json.Marshal(ev)
+		if err != nil {
+			return
+		}
+		client := &http.Client{Timeout: webhookTimeout}
+		resp, err := client.Post(WebhookURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "webhook: %v\n", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			fmt.Fprintf(os.Stderr, "webhook: %s returned %s\n", WebhookURL, resp.Status)
+		}
+	}()
+}
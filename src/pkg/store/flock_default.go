@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package store
+
+import "errors"
+
+// lockIndexFile has no advisory-lock implementation on this platform, so a
+// shared data dir cannot be made safe; NewStore reports this at startup
+// instead of corrupting the index later.
+func lockIndexFile(dataDir string) (release func(), err error) {
+	return nil, errors.New("data dir locking not supported on this platform")
+}
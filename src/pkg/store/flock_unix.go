@@ -0,0 +1,29 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockIndexFile takes an exclusive advisory lock shared by every process
+// using dataDir, so index read-modify-write cycles from sibling servers
+// cannot interleave. Blocks until the lock is free; release unlocks and
+// closes the lock file.
+func lockIndexFile(dataDir string) (release func(), err error) {
+	f, err := os.OpenFile(filepath.Join(dataDir, indexLockFilename), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
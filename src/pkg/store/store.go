@@ -0,0 +1,798 @@
+// Package store persists uploaded blobs on disk: gob metadata next to the
+// sealed payload, a size-accounting index, expiry and cleanup, and the
+// offline verify pass.
+package store
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tcpraw/pkg/protocol"
+)
+
+type StoredBlob struct {
+	Name              string
+	PlaintextChecksum []byte
+	Nonce             []byte
+	Sealed            []byte
+	Chunks            []protocol.EncryptedChunk
+	TotalPlainLen     uint64
+	NumChunks         uint32
+	Chunked           bool
+	Secure            bool
+	SealedInFile      bool      // non-chunked payload spilled to the .dat file (see put)
+	SealedLen         uint64    // length of the spilled payload
+	KeyVersion        byte      // code KDF version; 0 = legacy SHA-256 (pre-versioning blobs)
+	KeySalt           []byte    // per-upload KDF salt, or the recipient frame for X25519 uploads
+	ChunkSums         []byte    // keyed per-chunk plaintext digests (NumChunks * ChunkSumSize), relayed opaquely
+	Generation        uint32    // bumped per accepted delta/append; leading nonce bytes of re-encrypted chunks
+	MetaFrame         []byte    // file metadata frame payload (mtime, mode), relayed opaquely
+	SignerPub         []byte    // Ed25519 public key when the upload was signed
+	Signature         []byte    // Ed25519 signature over the integrity tag
+	OwnerTokenHash    []byte    // SHA-256 of the owner token; non-nil = blob accepts appends
+	RedirectCode      string    // non-empty = blob migrated away; downloads answer a redirect to this code
+	NotBefore         time.Time // timed release: downloads are refused until this moment
+	CreatedAt         time.Time
+	ExpiresAt         time.Time // zero = use server default duration from CreatedAt
+	PasswordSalt      []byte    // non-nil = download requires password
+	PasswordHash      []byte
+	Quarantined       bool // flagged by the scan hook; never served
+	Pinned            bool // skipped by cleanup until unpinned (admin op)
+	PinnedBy          string
+	PinReason         string
+	PinnedAt          time.Time
+}
+
+const indexFilename = ".index.gob"
+
+// sealedFileThreshold: non-chunked sealed payloads at least this large are
+// kept in the .dat file instead of inside the gob metadata, so downloads can
+// stream them rather than load the whole payload into RAM.
+const sealedFileThreshold = 8 * 1024 * 1024
+
+// DurableUploads (-durable) fsyncs the data file and index entry before the
+// upload ack goes out, so a power loss right after StatusOK cannot lose a
+// blob the sender already deleted locally.
+var DurableUploads bool
+
+// SharedDir (-shared) makes the store safe for several server processes using
+// one data directory: every index read-modify-write happens under an
+// exclusive lock on .index.lock, local changes are merged into the on-disk
+// index instead of overwriting it, and blobs stored by a sibling process are
+// picked up on demand when a code misses the in-memory index.
+var SharedDir bool
+
+const indexLockFilename = ".index.lock"
+
+// SyncDir flushes directory metadata so a completed rename survives power
+// loss. Only called in -durable mode; failures are ignored because the data
+// itself is already synced.
+func SyncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// indexEntry is the per-code record in the on-disk index: when the blob was
+// stored and its on-disk footprint (.blob metadata plus .dat payload), so
+// storage reports don't have to stat every file.
+type indexEntry struct {
+	CreatedAt time.Time
+	Size      int64
+}
+
+type Store struct {
+	mu              sync.RWMutex
+	index           map[string]indexEntry
+	dataDir         string
+	storageDuration time.Duration
+	indexDirty      bool
+
+	// Codes this process has put or removed since the last shared-mode
+	// merge; only populated when SharedDir is set.
+	localPut map[string]bool
+	localDel map[string]bool
+
+	// NotifyExpire, when set, is called with each code removed by the
+	// expiry sweep (after the blob is gone). Assigned once before Serve
+	// starts accepting; not guarded by mu.
+	NotifyExpire func(code string)
+}
+
+// indexFlushInterval is how long index mutations may sit in memory before the
+// background flusher persists them.
+const indexFlushInterval = time.Second
+
+// StorageDuration is the default retention for new uploads; set from -ttl.
+var StorageDuration = 30 * time.Minute
+
+func NewStore(dataDir string) (*Store, error) {
+	dataDir = filepath.Clean(dataDir)
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+	st := &Store{
+		index:           make(map[string]indexEntry),
+		dataDir:         dataDir,
+		storageDuration: StorageDuration,
+		localPut:        make(map[string]bool),
+		localDel:        make(map[string]bool),
+	}
+	if SharedDir {
+		// Fail now, not on the first flush, if this platform cannot lock.
+		// The orphan sweep is skipped in shared mode: a .blob or staging
+		// .dat.tmp from a sibling's in-flight upload looks orphaned here.
+		release, err := lockIndexFile(dataDir)
+		if err != nil {
+			return nil, fmt.Errorf("shared data dir: %w", err)
+		}
+		err = st.loadIndex()
+		release()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if err := st.loadIndex(); err != nil {
+			return nil, err
+		}
+		if err := st.removeOrphanBlobs(); err != nil {
+			return nil, err
+		}
+	}
+	st.CleanupExpired()
+	go st.indexFlusher()
+	return st, nil
+}
+
+func (s *Store) blobPath(code string) string {
+	return filepath.Join(s.dataDir, code+".blob")
+}
+
+func (s *Store) DataPath(code string) string {
+	return filepath.Join(s.dataDir, code+".dat")
+}
+
+// TempDataPath is the staging name for an in-flight upload. Payloads are
+// written here and renamed to dataPath only once every chunk and validation
+// has passed, so a crash or disconnect mid-upload never leaves a partial
+// .dat that later code paths could mistake for a complete blob.
+func (s *Store) TempDataPath(code string) string {
+	return filepath.Join(s.dataDir, code+".dat.tmp")
+}
+
+func (s *Store) DataDir() string {
+	return s.dataDir
+}
+
+func (s *Store) indexPath() string {
+	return filepath.Join(s.dataDir, indexFilename)
+}
+
+func (s *Store) loadIndex() error {
+	f, err := os.Open(s.indexPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := gob.NewDecoder(f).Decode(&s.index); err == nil {
+		f.Close()
+		return nil
+	}
+	f.Close()
+	// Pre-accounting index: map of code to creation time. Convert once,
+	// filling sizes from the files; the flusher persists the new format.
+	s.index = make(map[string]indexEntry)
+	f, err = os.Open(s.indexPath())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	legacy := make(map[string]time.Time)
+	if err := gob.NewDecoder(f).Decode(&legacy); err != nil {
+		return err
+	}
+	for code, t := range legacy {
+		s.index[code] = indexEntry{CreatedAt: t, Size: s.diskSize(code)}
+	}
+	s.indexDirty = true
+	return nil
+}
+
+// diskSize returns the on-disk bytes of a stored code (.blob plus .dat).
+func (s *Store) diskSize(code string) int64 {
+	var size int64
+	if fi, err := os.Stat(s.blobPath(code)); err == nil {
+		size += fi.Size()
+	}
+	if fi, err := os.Stat(s.DataPath(code)); err == nil {
+		size += fi.Size()
+	}
+	return size
+}
+
+func (s *Store) removeOrphanBlobs() error {
+	entries, err := os.ReadDir(s.dataDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		if strings.HasSuffix(name, ".dat.tmp") {
+			// Staging file from an upload interrupted by a crash.
+			os.Remove(filepath.Join(s.dataDir, name))
+			continue
+		}
+		if (!strings.HasSuffix(name, ".blob") && !strings.HasSuffix(name, ".dat")) || len(name) != protocol.CodeLength+5 {
+			continue
+		}
+		code := name[:protocol.CodeLength]
+		s.mu.RLock()
+		_, inIndex := s.index[code]
+		s.mu.RUnlock()
+		if !inIndex {
+			path := filepath.Join(s.dataDir, name)
+			os.Remove(path)
+		}
+	}
+	return nil
+}
+
+// VerifyDir is the offline "server verify" maintenance command. It
+// walks dataDir, decodes every .blob, re-parses the chunk framing in the
+// .dat files, and checks sealed lengths against NumChunks/TotalPlainLen —
+// the only way for an operator to spot bit rot or a truncated file before a
+// client hits it. With quarantine=true corrupt blobs are flagged so a
+// running server never serves them; without it they are only reported.
+func VerifyDir(dataDir string, quarantine bool) error {
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return err
+	}
+	var checked, corrupt int
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".blob") || len(name) != protocol.CodeLength+5 {
+			continue
+		}
+		code := name[:protocol.CodeLength]
+		checked++
+		blobPath := filepath.Join(dataDir, name)
+		f, err := os.Open(blobPath)
+		if err != nil {
+			corrupt++
+			fmt.Printf("%s: CORRUPT (open metadata: %v)\n", code, err)
+			continue
+		}
+		var blob StoredBlob
+		err = gob.NewDecoder(f).Decode(&blob)
+		f.Close()
+		if err != nil {
+			corrupt++
+			fmt.Printf("%s: CORRUPT (decode metadata: %v)\n", code, err)
+			continue
+		}
+		if err := verifyBlobData(dataDir, code, &blob); err != nil {
+			corrupt++
+			fmt.Printf("%s: CORRUPT (%v)\n", code, err)
+			if quarantine && !blob.Quarantined {
+				blob.Quarantined = true
+				if werr := rewriteBlobFile(blobPath, &blob); werr != nil {
+					fmt.Fprintf(os.Stderr, "quarantine %s: %v\n", code, werr)
+				} else {
+					fmt.Printf("%s: quarantined\n", code)
+				}
+			}
+			continue
+		}
+		fmt.Printf("%s: ok (%s, %d bytes)\n", code, blob.Name, blob.TotalPlainLen)
+	}
+	fmt.Printf("\n%d blobs checked, %d corrupt\n", checked, corrupt)
+	return nil
+}
+
+// VerifyBlob runs the verify pass's payload validation for one stored blob,
+// so the online check command applies the same rules as the offline sweep.
+func (s *Store) VerifyBlob(code string, b *StoredBlob) error {
+	return verifyBlobData(s.dataDir, code, b)
+}
+
+// verifyBlobData validates the stored payload of one blob against its
+// metadata without decrypting anything.
+func verifyBlobData(dataDir, code string, b *StoredBlob) error {
+	dataPath := filepath.Join(dataDir, code+".dat")
+	switch {
+	case b.Chunked:
+		df, err := os.Open(dataPath)
+		if err != nil {
+			return fmt.Errorf("open data file: %v", err)
+		}
+		defer df.Close()
+		var plainCount uint64
+		header := make([]byte, 16)
+		for i := uint32(0); i < b.NumChunks; i++ {
+			if _, err := io.ReadFull(df, header); err != nil {
+				return fmt.Errorf("chunk %d: truncated header: %v", i, err)
+			}
+			sealedLen := binary.BigEndian.Uint32(header[12:16])
+			if sealedLen < 16 || sealedLen > 64*1024*1024 {
+				return fmt.Errorf("chunk %d: implausible sealed length %d", i, sealedLen)
+			}
+			if _, err := df.Seek(int64(sealedLen), io.SeekCurrent); err != nil {
+				return fmt.Errorf("chunk %d: seek: %v", i, err)
+			}
+			plainCount += uint64(sealedLen - 16)
+		}
+		// Seeking past EOF does not fail, so confirm the last chunk really
+		// ends at the file size.
+		pos, err := df.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		info, err := df.Stat()
+		if err != nil {
+			return err
+		}
+		if pos > info.Size() {
+			return fmt.Errorf("data file truncated: framing needs %d bytes, have %d", pos, info.Size())
+		}
+		if pos < info.Size() {
+			return fmt.Errorf("trailing garbage: %d bytes after last chunk", info.Size()-pos)
+		}
+		if plainCount != b.TotalPlainLen {
+			return fmt.Errorf("plaintext length mismatch: chunks sum to %d, metadata says %d", plainCount, b.TotalPlainLen)
+		}
+		return nil
+	case b.SealedInFile:
+		info, err := os.Stat(dataPath)
+		if err != nil {
+			return fmt.Errorf("stat data file: %v", err)
+		}
+		if uint64(info.Size()) != b.SealedLen {
+			return fmt.Errorf("sealed length mismatch: file is %d bytes, metadata says %d", info.Size(), b.SealedLen)
+		}
+		if b.SealedLen < 16 {
+			return fmt.Errorf("sealed payload shorter than a GCM tag: %d bytes", b.SealedLen)
+		}
+		return nil
+	case b.Chunks != nil:
+		var plainCount uint64
+		for i, c := range b.Chunks {
+			if len(c.Sealed) < 16 {
+				return fmt.Errorf("chunk %d: sealed length %d too short", i, len(c.Sealed))
+			}
+			plainCount += uint64(len(c.Sealed) - 16)
+		}
+		if plainCount != b.TotalPlainLen {
+			return fmt.Errorf("plaintext length mismatch: chunks sum to %d, metadata says %d", plainCount, b.TotalPlainLen)
+		}
+		return nil
+	default:
+		if len(b.Sealed) < 16 {
+			return fmt.Errorf("sealed payload shorter than a GCM tag: %d bytes", len(b.Sealed))
+		}
+		return nil
+	}
+}
+
+// rewriteBlobFile persists updated metadata in place (verify -quarantine).
+func rewriteBlobFile(path string, b *StoredBlob) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// indexFlusher persists the index shortly after each batch of mutations.
+// put/remove only flip a dirty flag under the mutex; the gob encode and disk
+// write happen here, against a snapshot, outside the critical section.
+func (s *Store) indexFlusher() {
+	for range time.Tick(indexFlushInterval) {
+		s.flushIndex()
+	}
+}
+
+func (s *Store) flushIndex() {
+	if SharedDir {
+		s.flushIndexShared()
+		return
+	}
+	s.mu.Lock()
+	if !s.indexDirty {
+		s.mu.Unlock()
+		return
+	}
+	s.indexDirty = false
+	snapshot := make(map[string]indexEntry, len(s.index))
+	for code, e := range s.index {
+		snapshot[code] = e
+	}
+	s.mu.Unlock()
+	f, err := os.Create(s.indexPath())
+	if err == nil {
+		err = gob.NewEncoder(f).Encode(snapshot)
+		if err == nil && DurableUploads {
+			err = f.Sync()
+		}
+		if cErr := f.Close(); err == nil {
+			err = cErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "persist index: %v\n", err)
+		s.mu.Lock()
+		s.indexDirty = true
+		s.mu.Unlock()
+	}
+}
+
+// flushIndexShared merges this process's puts and removes into the on-disk
+// index under the directory lock, instead of overwriting whatever a sibling
+// wrote last. The merged view is adopted as the in-memory index, which is
+// also how codes stored (or expired) by siblings become visible here. The
+// whole cycle runs under the store mutex — slower than the snapshot path
+// above, but read-merge-write with concurrent local mutation is not worth
+// the complexity for a once-a-second flush.
+func (s *Store) flushIndexShared() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.indexDirty {
+		return
+	}
+	release, err := lockIndexFile(s.dataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lock shared index: %v\n", err)
+		return
+	}
+	defer release()
+	base := make(map[string]indexEntry)
+	if f, err := os.Open(s.indexPath()); err == nil {
+		// A torn or unreadable index cannot happen under the lock; an
+		// undecodable one means a sibling never wrote the new format, and
+		// the merge below rebuilds it from our view.
+		_ = gob.NewDecoder(f).Decode(&base)
+		f.Close()
+	}
+	for code := range s.localPut {
+		if e, ok := s.index[code]; ok {
+			base[code] = e
+		}
+	}
+	for code := range s.localDel {
+		delete(base, code)
+	}
+	f, err := os.Create(s.indexPath())
+	if err == nil {
+		err = gob.NewEncoder(f).Encode(base)
+		if err == nil && DurableUploads {
+			err = f.Sync()
+		}
+		if cErr := f.Close(); err == nil {
+			err = cErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "persist shared index: %v\n", err)
+		return
+	}
+	s.index = base
+	s.localPut = make(map[string]bool)
+	s.localDel = make(map[string]bool)
+	s.indexDirty = false
+}
+
+func (s *Store) Put(code string, b *StoredBlob) error {
+	if !b.Chunked && b.Chunks == nil && !b.SealedInFile && len(b.Sealed) >= sealedFileThreshold {
+		tmpPath := s.TempDataPath(code)
+		if err := os.WriteFile(tmpPath, b.Sealed, 0644); err == nil {
+			if err := os.Rename(tmpPath, s.DataPath(code)); err == nil {
+				b.SealedInFile = true
+				b.SealedLen = uint64(len(b.Sealed))
+				b.Sealed = nil
+			} else {
+				os.Remove(tmpPath)
+			}
+		}
+	}
+	path := s.blobPath(code)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(b); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if DurableUploads {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			os.Remove(path)
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return err
+	}
+	size := s.diskSize(code)
+	s.mu.Lock()
+	s.index[code] = indexEntry{CreatedAt: b.CreatedAt, Size: size}
+	if SharedDir {
+		s.localPut[code] = true
+		delete(s.localDel, code)
+	}
+	s.indexDirty = true
+	s.mu.Unlock()
+	if DurableUploads {
+		// Ack must not outrun the index entry on disk.
+		s.flushIndex()
+	}
+	return nil
+}
+
+// LoadSealed returns the sealed payload of a non-chunked blob, reading it
+// back from the .dat file when put spilled it out of the metadata.
+func (s *Store) LoadSealed(code string, b *StoredBlob) ([]byte, error) {
+	if !b.SealedInFile {
+		return b.Sealed, nil
+	}
+	return os.ReadFile(s.DataPath(code))
+}
+
+func (s *Store) Get(code string) (*StoredBlob, bool) {
+	s.mu.RLock()
+	_, ok := s.index[code]
+	s.mu.RUnlock()
+	if !ok && !SharedDir {
+		return nil, false
+	}
+	// Shared mode falls through on an index miss: a sibling process may
+	// have stored the blob since our last merge.
+	f, err := os.Open(s.blobPath(code))
+	if err != nil {
+		return nil, false
+	}
+	var b StoredBlob
+	err = gob.NewDecoder(f).Decode(&b)
+	f.Close()
+	if err != nil {
+		// Corrupt metadata. Without this the .dat and index entry would
+		// linger until TTL and every download would get a bare NotFound.
+		fmt.Fprintf(os.Stderr, "corrupt metadata for code %s: %v – removing blob\n", code, err)
+		s.Remove(code)
+		return nil, false
+	}
+	if s.expired(&b, time.Now()) {
+		return nil, false
+	}
+	if !ok {
+		// Adopt the sibling's blob so the next lookup hits the index; not
+		// marked as a local put — the sibling's flush owns the entry.
+		s.mu.Lock()
+		s.index[code] = indexEntry{CreatedAt: b.CreatedAt, Size: s.diskSize(code)}
+		s.mu.Unlock()
+	}
+	return &b, true
+}
+
+// expiryGraceWindow absorbs small clock steps: an NTP correction of a few
+// seconds must not expire a blob a client is about to download.
+const expiryGraceWindow = time.Minute
+
+// TTL returns the store's default retention for uploads without an
+// explicit expiry.
+func (s *Store) TTL() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.storageDuration
+}
+
+// SetTTL changes the default retention at runtime (config reload). Existing
+// blobs without an explicit expiry pick it up on their next expiry check.
+func (s *Store) SetTTL(d time.Duration) {
+	s.mu.Lock()
+	s.storageDuration = d
+	s.mu.Unlock()
+}
+
+// Codes returns a snapshot of every stored code.
+func (s *Store) Codes() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	codes := make([]string, 0, len(s.index))
+	for code := range s.index {
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// ExpiryOf returns the absolute expiry of a blob. New uploads persist an
+// explicit ExpiresAt; blobs stored before expiry timestamps carry a zero
+// value and fall back to CreatedAt plus the server default. A CreatedAt in
+// the future (host clock stepped back since the upload) is clamped to now so
+// such blobs age out normally instead of outliving every restart.
+func (s *Store) ExpiryOf(b *StoredBlob) time.Time {
+	if !b.ExpiresAt.IsZero() {
+		return b.ExpiresAt
+	}
+	created := b.CreatedAt
+	if now := time.Now(); created.After(now) {
+		created = now
+	}
+	return created.Add(s.TTL())
+}
+
+// expired reports whether a blob should no longer be served as of now.
+// Pinned blobs never expire.
+func (s *Store) expired(b *StoredBlob, now time.Time) bool {
+	if b.Pinned {
+		return false
+	}
+	return now.After(s.ExpiryOf(b).Add(expiryGraceWindow))
+}
+
+// Quarantine marks a code as flagged by the scan hook; the blob stays on disk
+// for operator inspection but is never served again.
+func (s *Store) Quarantine(code string) error {
+	b, ok := s.Get(code)
+	if !ok {
+		return fmt.Errorf("code %s not found", code)
+	}
+	b.Quarantined = true
+	return s.Put(code, b)
+}
+
+func (s *Store) Remove(code string) {
+	metaPath := s.blobPath(code)
+	dataPath := s.DataPath(code)
+	_ = os.Remove(metaPath)
+	_ = os.Remove(dataPath)
+	s.mu.Lock()
+	delete(s.index, code)
+	if SharedDir {
+		s.localDel[code] = true
+		delete(s.localPut, code)
+	}
+	s.indexDirty = true
+	s.mu.Unlock()
+}
+
+// CleanupExpired removes expired and unreadable blobs and returns how many
+// codes were reclaimed.
+func (s *Store) CleanupExpired() int {
+	s.mu.RLock()
+	codes := make([]string, 0, len(s.index))
+	for code := range s.index {
+		codes = append(codes, code)
+	}
+	s.mu.RUnlock()
+	var expired []string
+	for _, code := range codes {
+		f, err := os.Open(s.blobPath(code))
+		if err != nil {
+			expired = append(expired, code)
+			continue
+		}
+		var b StoredBlob
+		err = gob.NewDecoder(f).Decode(&b)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "corrupt metadata for code %s: %v – removing blob\n", code, err)
+			expired = append(expired, code)
+			continue
+		}
+		if s.expired(&b, time.Now()) {
+			expired = append(expired, code)
+		}
+	}
+	for _, code := range expired {
+		s.Remove(code)
+		if s.NotifyExpire != nil {
+			s.NotifyExpire(code)
+		}
+	}
+	return len(expired)
+}
+
+// FindByPakeTag scans the index for the code whose lookup tag matches.
+func (s *Store) FindByPakeTag(tag []byte) (string, *StoredBlob, bool) {
+	s.mu.RLock()
+	var code string
+	for c := range s.index {
+		if hmac.Equal(protocol.PakeTag(c), tag) {
+			code = c
+			break
+		}
+	}
+	s.mu.RUnlock()
+	if code == "" {
+		return "", nil, false
+	}
+	blob, ok := s.Get(code)
+	return code, blob, ok
+}
+
+// Usage returns the number of stored codes and their on-disk bytes,
+// straight from the size-accounting index (no stat calls).
+func (st *Store) Usage() (count int, bytes int64) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	for _, e := range st.index {
+		count++
+		bytes += e.Size
+	}
+	return count, bytes
+}
+
+// Report renders the aggregate storage summary: code count, total
+// bytes, the largest codes, and a time-to-expiry histogram. Printed at
+// startup and served under /admin/stats so operators don't have to du the
+// data directory.
+func (st *Store) Report() string {
+	type codeSize struct {
+		code string
+		size int64
+	}
+	st.mu.RLock()
+	entries := make([]codeSize, 0, len(st.index))
+	var total int64
+	for code, e := range st.index {
+		entries = append(entries, codeSize{code, e.Size})
+		total += e.Size
+	}
+	st.mu.RUnlock()
+	var b strings.Builder
+	fmt.Fprintf(&b, "storage: %d codes, %s on disk\n", len(entries), protocol.FormatBytes(float64(total)))
+	sort.Slice(entries, func(i, j int) bool { return entries[i].size > entries[j].size })
+	top := len(entries)
+	if top > 5 {
+		top = 5
+	}
+	for _, e := range entries[:top] {
+		fmt.Fprintf(&b, "  largest: %s  %s\n", e.code, protocol.FormatBytes(float64(e.size)))
+	}
+	// Time-to-expiry histogram, from the per-blob expiry (custom -ttl and
+	// long-term uploads included).
+	var buckets [4]int // <1h, 1–6h, 6–24h, >24h
+	now := time.Now()
+	for _, e := range entries {
+		blob, ok := st.Get(e.code)
+		if !ok {
+			continue
+		}
+		switch left := st.ExpiryOf(blob).Sub(now); {
+		case left < time.Hour:
+			buckets[0]++
+		case left < 6*time.Hour:
+			buckets[1]++
+		case left < 24*time.Hour:
+			buckets[2]++
+		default:
+			buckets[3]++
+		}
+	}
+	fmt.Fprintf(&b, "  expiry: <1h=%d 1-6h=%d 6-24h=%d >24h=%d", buckets[0], buckets[1], buckets[2], buckets[3])
+	return b.String()
+}